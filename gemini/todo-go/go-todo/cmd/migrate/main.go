@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gemini/go-todo/internal/config"
+	"github.com/gemini/go-todo/internal/storage/sqlite"
+	"github.com/gemini/go-todo/migrations"
+)
+
+const usage = `usage: migrate [flags] <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  version     print the current schema version
+
+flags:
+`
+
+func main() {
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(loader, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(loader *config.Loader, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := sqlite.Open(cfg.SQLiteDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := sqlite.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		if err := m.Up(ctx); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		if err := m.Down(ctx, steps); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d (latest %d)\n", version, m.Latest())
+	return nil
+}
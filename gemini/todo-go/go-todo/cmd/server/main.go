@@ -2,32 +2,61 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 	"time"
+	_ "time/tzdata" // agenda time zones must resolve without system zoneinfo
 
+	"github.com/gemini/go-todo/internal/auth"
 	"github.com/gemini/go-todo/internal/config"
 	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/metrics"
 	"github.com/gemini/go-todo/internal/storage/sqlite"
 	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/tracing"
+	"github.com/gemini/go-todo/internal/user"
+	"github.com/gemini/go-todo/internal/webhook"
 	"github.com/gemini/go-todo/pkg/logger"
 	"github.com/go-chi/chi/v5"
 )
 
 func main() {
-	cfg, err := config.Load()
+	loader := config.NewLoader(flag.CommandLine)
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	cfg, err := loader.Load()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "failed to load config:\n%v\n", err)
 		os.Exit(1)
 	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print config: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var level slog.LevelVar
+	level.Set(logger.ParseLevel(cfg.LogLevel))
+	log := logger.New(&level)
+	slog.SetDefault(log)
+	log.Info("starting server", "addr", cfg.HTTPAddr, "tls", cfg.TLSCertFile != "")
 
-	log := logger.New(cfg.LogLevel)
-	log.Info("starting server", "addr", cfg.HTTPAddr)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TraceExporter)
+	if err != nil {
+		log.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	if err := os.MkdirAll(filepath.Dir(cfg.SQLiteDSN), 0755); err != nil {
 		log.Error("failed to create data directory", "error", err)
@@ -40,40 +69,194 @@ func main() {
 		os.Exit(1)
 	}
 	defer repo.Close()
+	db := repo.DB()
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	secret := []byte(cfg.AuthSecret)
+	if len(secret) == 0 {
+		log.Warn("AUTH_SECRET is not set; using a random secret, tokens will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Error("failed to generate auth secret", "error", err)
+			os.Exit(1)
+		}
+	}
+	tokens := auth.NewTokens(secret, cfg.TokenTTL)
 
-	service := todo.NewService(repo)
+	m := metrics.New()
+	m.RegisterDB("todos", db)
+
+	service := todo.NewService(m.InstrumentRepo(repo))
 	handler := httpHandler.NewHandler(service, log)
 
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go runPurger(purgeCtx, service, cfg.TrashRetention, cfg.TrashPurgeInterval, log)
+	authHandler := httpHandler.NewAuthHandler(user.NewService(repo.Users()), tokens, log)
+
+	healthHandler := httpHandler.NewHealthHandler(repo, log)
+	webhookHandler := httpHandler.NewWebhookHandler(webhook.NewService(repo.Webhooks()), log)
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	worker := webhook.NewWorker(repo.Webhooks(), log, webhook.WithClient(webhook.NewClient(cfg.WebhookAllowPrivate)))
+	go worker.Run(webhookCtx, cfg.WebhookInterval)
+
+	cors := httpHandler.NewCors(cfg.CORSAllowed)
+
 	r := chi.NewRouter()
-	r.Use(httpHandler.Cors(cfg.CORSAllowed))
+	r.Use(cors.Handler)
+	r.Use(httpHandler.RequestID(log))
+	r.Use(httpHandler.Trace())
+	r.Use(httpHandler.Instrument(m))
 	r.Use(httpHandler.RequestLogger(log))
 	r.Use(httpHandler.PanicRecoverer(log, handler))
-	handler.RegisterRoutes(r)
+	r.Method(http.MethodGet, "/metrics", m.Handler())
+	healthHandler.RegisterRoutes(r)
+	authHandler.RegisterRoutes(r)
+	r.Group(func(r chi.Router) {
+		r.Use(httpHandler.Authenticate(tokens, handler, httpHandler.AllowQueryToken(httpHandler.EventsPath)))
+		r.Use(httpHandler.Idempotency(repo.Idempotency(), cfg.IdempotencyTTL, log, handler))
+		handler.RegisterRoutes(r)
+		webhookHandler.RegisterRoutes(r)
+	})
 
 	srv := &http.Server{
-		Addr:    cfg.HTTPAddr,
-		Handler: r,
+		Addr:              cfg.HTTPAddr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
+	// Event streams never finish on their own.
+	srv.RegisterOnShutdown(service.CloseSubscriptions)
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if cfg.TLSCertFile != "" {
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("server failed", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	reloads := make(chan struct{}, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			requestReload(reloads)
+		}
+	}()
+	if cfg.WatchConfig {
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		if err := loader.Watch(watchCtx, func() { requestReload(reloads) }); err != nil {
+			log.Error("failed to watch config file", "error", err)
+			os.Exit(1)
+		}
+	}
+	go func() {
+		current := cfg
+		for range reloads {
+			current = reloadConfig(loader, current, &level, cors, log)
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Info("shutting down server")
+	log.Info("shutting down server", "drain_delay", cfg.DrainDelay)
+	// Fail readiness probes first, so that load balancers stop sending
+	// requests before the server stops accepting them.
+	healthHandler.Drain()
+	time.Sleep(cfg.DrainDelay)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGrace)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error("server shutdown failed", "error", err)
 		os.Exit(1)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("failed to flush traces", "error", err)
+	}
 
 	log.Info("server exited properly")
 }
+
+// requestReload asks for the configuration to be reloaded, unless a reload
+// is already pending.
+func requestReload(reloads chan<- struct{}) {
+	select {
+	case reloads <- struct{}{}:
+	default:
+	}
+}
+
+// reloadConfig loads the configuration again and applies the log level and
+// the CORS allowed origins, which are the settings that can change without a
+// restart. It returns the new configuration, or cfg if the new one is
+// invalid, in which case the server carries on unchanged.
+func reloadConfig(loader *config.Loader, cfg *config.Config, level *slog.LevelVar, cors *httpHandler.Cors, log *slog.Logger) *config.Config {
+	next, err := loader.Load()
+	if err != nil {
+		log.Error("rejected new config", "error", err)
+		return cfg
+	}
+
+	var applied, ignored []string
+	for _, key := range cfg.Changed(next) {
+		switch key {
+		case "log_level":
+			level.Set(logger.ParseLevel(next.LogLevel))
+		case "cors_allowed_origins":
+			cors.SetAllowedOrigins(next.CORSAllowed)
+		default:
+			ignored = append(ignored, key)
+			continue
+		}
+		applied = append(applied, key)
+	}
+	if len(ignored) > 0 {
+		log.Warn("config changes need a restart to take effect", "settings", ignored)
+	}
+	log.Info("reloaded config", "applied", applied)
+
+	// Keep the settings that were not applied, so that they are reported
+	// again on the next reload until the server restarts.
+	reloaded := *cfg
+	reloaded.LogLevel = next.LogLevel
+	reloaded.CORSAllowed = next.CORSAllowed
+	return &reloaded
+}
+
+// runPurger permanently deletes todos that have been in the trash for longer
+// than retention, at startup and then every interval until ctx is done.
+func runPurger(ctx context.Context, service *todo.Service, retention, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := service.PurgeTrash(ctx, retention)
+		if err != nil {
+			log.Error("failed to purge trash", "error", err)
+		} else if n > 0 {
+			log.Info("purged trash", "todos", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Package auth carries the authenticated user through request contexts and
+// issues and verifies the signed tokens clients authenticate with.
+package auth
+
+import "context"
+
+type contextKey struct{}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID.
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, contextKey{}, userID)
+}
+
+// UserID returns the authenticated user's ID from ctx, or 0 if there is none.
+func UserID(ctx context.Context) int64 {
+	id, _ := ctx.Value(contextKey{}).(int64)
+	return id
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	tokens := NewTokens([]byte("secret"), time.Hour)
+
+	t.Run("round-trips a user ID", func(t *testing.T) {
+		token, expires, err := tokens.Issue(42)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if time.Until(expires) <= 0 {
+			t.Errorf("expected expiry in the future, got %v", expires)
+		}
+
+		id, err := tokens.Verify(token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id != 42 {
+			t.Errorf("expected user 42, got %d", id)
+		}
+	})
+
+	t.Run("rejects a token signed with another secret", func(t *testing.T) {
+		token, _, _ := NewTokens([]byte("other"), time.Hour).Issue(42)
+		if _, err := tokens.Verify(token); err != ErrInvalidToken {
+			t.Errorf("expected error %v, got %v", ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("rejects an expired token", func(t *testing.T) {
+		token, _, _ := tokens.Issue(42)
+
+		later := NewTokens([]byte("secret"), time.Hour)
+		later.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		if _, err := later.Verify(token); err != ErrInvalidToken {
+			t.Errorf("expected error %v, got %v", ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("rejects garbage", func(t *testing.T) {
+		if _, err := tokens.Verify("not-a-token"); err != ErrInvalidToken {
+			t.Errorf("expected error %v, got %v", ErrInvalidToken, err)
+		}
+	})
+}
@@ -1,8 +1,20 @@
+// Package config loads the application configuration. Every setting can be
+// given in a configuration file, overridden by an environment variable and
+// overridden again by a command-line flag.
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration.
@@ -11,21 +23,420 @@ type Config struct {
 	SQLiteDSN   string
 	LogLevel    string
 	CORSAllowed []string
+	// AuthSecret signs access tokens. When empty, a random secret is
+	// generated at startup and tokens do not survive a restart.
+	AuthSecret string
+	TokenTTL   time.Duration
+	// TrashRetention is how long deleted todos stay in the trash before
+	// the purger, which runs every TrashPurgeInterval, removes them.
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// IdempotencyTTL is how long responses to requests made with an
+	// Idempotency-Key are kept for retries.
+	IdempotencyTTL time.Duration
+	// WebhookInterval is how often the outbox is dispatched and due
+	// webhook deliveries are attempted.
+	WebhookInterval time.Duration
+	// WebhookAllowPrivate lets webhooks be delivered to loopback, private
+	// and link-local addresses, which is useful in development only.
+	WebhookAllowPrivate bool
+	// TraceExporter is where spans are sent: "none", "otlp" or "stdout".
+	TraceExporter string
+	// DrainDelay is how long the server keeps serving after its readiness
+	// probe starts failing at shutdown, so load balancers can stop routing
+	// requests to it first.
+	DrainDelay time.Duration
+	// ShutdownGrace is how long in-flight requests get to finish once the
+	// server stops accepting connections.
+	ShutdownGrace time.Duration
+
+	// The timeouts of the HTTP server. Zero means no timeout.
+	// WriteTimeout is off by default because it would cut off the change
+	// feed's event streams.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// The sizes and lifetimes of the database connection pool. Zero means
+	// no limit, except for DBMaxIdleConns, where it keeps no idle
+	// connections.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+
+	// TLSCertFile and TLSKeyFile make the server serve HTTPS. Both or
+	// neither must be set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// WatchConfig reloads the configuration file whenever it changes, as
+	// well as on SIGHUP.
+	WatchConfig bool
 }
 
-// Load loads configuration from environment variables.
-func Load() (*Config, error) {
-	return &Config{
-		HTTPAddr:    getEnv("HTTP_ADDR", ":8080"),
-		SQLiteDSN:   getEnv("SQLITE_DSN", "./data/todos.db"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-		CORSAllowed: strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"), ","),
-	}, nil
+// Sources of setting values, from lowest to highest precedence.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// ConfigFileEnv names the environment variable holding the path of the
+// configuration file, which the --config flag overrides.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// Loader loads the configuration from a file, the environment and the
+// command-line flags it registers. Load can be called again to pick up
+// changes to the file.
+type Loader struct {
+	file  *string
+	flags map[string]*flagValue
+}
+
+// flagValue records whether a flag was set, so that flags only override
+// the other sources when given.
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(v string) error {
+	f.value, f.set = v, true
+	return nil
+}
+
+// IsBoolFlag lets boolean flags be given without a value.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// NewLoader creates a loader and registers --config and a flag for every
+// setting on fs. The flags are read by Load once fs has been parsed.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		file:  fs.String("config", "", "path of a YAML, TOML or JSON configuration file (env "+ConfigFileEnv+")"),
+		flags: make(map[string]*flagValue),
+	}
+	for _, s := range settings {
+		v := &flagValue{isBool: s.isBool}
+		l.flags[s.key] = v
+		fs.Var(v, s.flag(), fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env(), s.def))
+	}
+	return l
+}
+
+// Load layers the configuration: defaults, then the configuration file,
+// then environment variables, then flags. It reports every invalid
+// setting at once.
+func (l *Loader) Load() (*Config, error) {
+	values := make(map[string]value, len(settings))
+	for _, s := range settings {
+		values[s.key] = value{s.def, sourceDefault}
+	}
+
+	var errs []error
+	if path := l.File(); path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(file))
+		for key := range file {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := values[key]; !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+				continue
+			}
+			values[key] = value{file[key], sourceFile}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env()); ok {
+			values[s.key] = value{v, sourceEnv}
+		}
+		if f := l.flags[s.key]; f.set {
+			values[s.key] = value{f.value, sourceFlag}
+		}
+	}
+
+	cfg := &Config{}
+	for _, s := range settings {
+		v := values[s.key]
+		if err := s.parse(cfg, strings.TrimSpace(v.raw)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q (from %s): %w", s.key, v.raw, v.describe(s), err))
+		}
+	}
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// File returns the path of the configuration file, or "" if there is none.
+func (l *Loader) File() string {
+	if *l.file != "" {
+		return *l.file
+	}
+	return os.Getenv(ConfigFileEnv)
+}
+
+// value is the raw value of a setting and where it came from.
+type value struct {
+	raw    string
+	source string
+}
+
+func (v value) describe(s setting) string {
+	switch v.source {
+	case sourceEnv:
+		return "env " + s.env()
+	case sourceFlag:
+		return "flag --" + s.flag()
+	}
+	return v.source
+}
+
+// validate checks the constraints between settings.
+func (c *Config) validate() []error {
+	var errs []error
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file must be set together"))
+	}
+	for _, f := range []struct{ key, path string }{
+		{"tls_cert_file", c.TLSCertFile},
+		{"tls_key_file", c.TLSKeyFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", f.key, err))
+		}
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("db_max_idle_conns must not exceed db_max_open_conns"))
+	}
+	return errs
+}
+
+// Redacted returns a copy of the configuration with its secrets replaced.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.CORSAllowed = append([]string(nil), c.CORSAllowed...)
+	for _, s := range settings {
+		if s.secret && s.format(&r) != "" {
+			s.parse(&r, redacted)
+		}
+	}
+	return &r
+}
+
+const redacted = "[REDACTED]"
+
+// Print writes the configuration with its secrets redacted, in YAML that
+// can be loaded back as a configuration file.
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(c.Redacted().values()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Changed returns the keys of the settings that differ between c and other,
+// sorted.
+func (c *Config) Changed(other *Config) []string {
+	var keys []string
+	before, after := c.values(), other.values()
+	for _, s := range settings {
+		if before[s.key] != after[s.key] {
+			keys = append(keys, s.key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// values returns the settings of c by key, formatted as they would be
+// written in a configuration file.
+func (c *Config) values() map[string]string {
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.key] = s.format(c)
+	}
+	return values
+}
+
+// setting describes one configuration setting. Its environment variable is
+// its key in upper case, and its flag its key with dashes.
+type setting struct {
+	key    string
+	def    string
+	usage  string
+	secret bool
+	isBool bool
+	parse  func(c *Config, v string) error
+	format func(c *Config) string
+}
+
+func (s setting) env() string {
+	return strings.ToUpper(s.key)
+}
+
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+var settings = []setting{
+	str("http_addr", ":8080", "address the HTTP server listens on", func(c *Config) *string { return &c.HTTPAddr }, required),
+	str("sqlite_dsn", "./data/todos.db", "SQLite data source name", func(c *Config) *string { return &c.SQLiteDSN }, required),
+	str("log_level", "info", "log level: debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }, oneOf("debug", "info", "warn", "error")),
+	{
+		key:   "cors_allowed_origins",
+		def:   "http://localhost:3000",
+		usage: "comma-separated origins allowed to make cross-origin requests",
+		parse: func(c *Config, v string) error {
+			c.CORSAllowed = nil
+			for _, origin := range strings.Split(v, ",") {
+				if origin = strings.TrimSpace(origin); origin == "" {
+					return errors.New("must be a comma-separated list of origins")
+				}
+				c.CORSAllowed = append(c.CORSAllowed, origin)
+			}
+			return nil
+		},
+		format: func(c *Config) string { return strings.Join(c.CORSAllowed, ",") },
+	},
+	secret(str("auth_secret", "", "secret signing access tokens; random if empty", func(c *Config) *string { return &c.AuthSecret }, nil)),
+	duration("token_ttl", "24h", "how long access tokens stay valid", func(c *Config) *time.Duration { return &c.TokenTTL }, true),
+	duration("trash_retention", "720h", "how long deleted todos stay in the trash", func(c *Config) *time.Duration { return &c.TrashRetention }, true),
+	duration("trash_purge_interval", "1h", "how often the trash is purged", func(c *Config) *time.Duration { return &c.TrashPurgeInterval }, true),
+	duration("idempotency_ttl", "24h", "how long responses to requests with an Idempotency-Key are kept", func(c *Config) *time.Duration { return &c.IdempotencyTTL }, true),
+	duration("webhook_interval", "5s", "how often pending webhook deliveries are attempted", func(c *Config) *time.Duration { return &c.WebhookInterval }, true),
+	boolean("webhook_allow_private", "false", "deliver webhooks to loopback and private addresses; for development only", func(c *Config) *bool { return &c.WebhookAllowPrivate }),
+	str("trace_exporter", "none", "where trace spans are sent: none, otlp or stdout", func(c *Config) *string { return &c.TraceExporter }, oneOf("none", "otlp", "stdout")),
+	duration("drain_delay", "5s", "how long the server keeps serving after readiness fails at shutdown", func(c *Config) *time.Duration { return &c.DrainDelay }, false),
+	duration("shutdown_grace", "5s", "how long in-flight requests get to finish at shutdown", func(c *Config) *time.Duration { return &c.ShutdownGrace }, true),
+	duration("read_header_timeout", "5s", "how long the server waits for request headers; 0 for no limit", func(c *Config) *time.Duration { return &c.ReadHeaderTimeout }, false),
+	duration("read_timeout", "30s", "how long the server waits for a whole request; 0 for no limit", func(c *Config) *time.Duration { return &c.ReadTimeout }, false),
+	duration("write_timeout", "0s", "how long the server may take to write a response; 0 for no limit", func(c *Config) *time.Duration { return &c.WriteTimeout }, false),
+	duration("idle_timeout", "120s", "how long idle keep-alive connections stay open; 0 for no limit", func(c *Config) *time.Duration { return &c.IdleTimeout }, false),
+	integer("db_max_open_conns", "0", "most open database connections; 0 for no limit", func(c *Config) *int { return &c.DBMaxOpenConns }),
+	integer("db_max_idle_conns", "2", "most idle database connections", func(c *Config) *int { return &c.DBMaxIdleConns }),
+	duration("db_conn_max_lifetime", "0s", "how long a database connection may be reused; 0 for no limit", func(c *Config) *time.Duration { return &c.DBConnMaxLifetime }, false),
+	duration("db_conn_max_idle_time", "0s", "how long a database connection may be idle; 0 for no limit", func(c *Config) *time.Duration { return &c.DBConnMaxIdleTime }, false),
+	str("tls_cert_file", "", "path of the TLS certificate; serves HTTPS when set", func(c *Config) *string { return &c.TLSCertFile }, nil),
+	str("tls_key_file", "", "path of the TLS private key", func(c *Config) *string { return &c.TLSKeyFile }, nil),
+	boolean("watch_config", "false", "reload the configuration file when it changes", func(c *Config) *bool { return &c.WatchConfig }),
+}
+
+func str(key, def, usage string, field func(*Config) *string, check func(string) error) setting {
+	return setting{
+		key:   key,
+		def:   def,
+		usage: usage,
+		parse: func(c *Config, v string) error {
+			if check != nil {
+				if err := check(v); err != nil {
+					return err
+				}
+			}
+			*field(c) = v
+			return nil
+		},
+		format: func(c *Config) string { return *field(c) },
+	}
+}
+
+func duration(key, def, usage string, field func(*Config) *time.Duration, positive bool) setting {
+	return setting{
+		key:   key,
+		def:   def,
+		usage: usage,
+		parse: func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			switch {
+			case positive && (err != nil || d <= 0):
+				return errors.New("must be a positive duration such as 30s or 1h")
+			case err != nil || d < 0:
+				return errors.New("must be a non-negative duration such as 30s or 1h")
+			}
+			*field(c) = d
+			return nil
+		},
+		format: func(c *Config) string { return field(c).String() },
+	}
+}
+
+func integer(key, def, usage string, field func(*Config) *int) setting {
+	return setting{
+		key:   key,
+		def:   def,
+		usage: usage,
+		parse: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return errors.New("must be a non-negative integer")
+			}
+			*field(c) = n
+			return nil
+		},
+		format: func(c *Config) string { return strconv.Itoa(*field(c)) },
+	}
+}
+
+func boolean(key, def, usage string, field func(*Config) *bool) setting {
+	return setting{
+		key:    key,
+		def:    def,
+		usage:  usage,
+		isBool: true,
+		parse: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return errors.New("must be true or false")
+			}
+			*field(c) = b
+			return nil
+		},
+		format: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+	}
+}
+
+func secret(s setting) setting {
+	s.secret = true
+	return s
+}
+
+func required(v string) error {
+	if v == "" {
+		return errors.New("must not be empty")
+	}
+	return nil
 }
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
+func oneOf(allowed ...string) func(string) error {
+	return func(v string) error {
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
 	}
-	return fallback
 }
@@ -0,0 +1,199 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/config"
+)
+
+func load(t *testing.T, args ...string) (*config.Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	return loader.Load()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	writeFileAt(t, path, content)
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := load(t)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.HTTPAddr != ":8080" || cfg.ShutdownGrace != 5*time.Second || cfg.DBMaxIdleConns != 2 {
+			t.Errorf("unexpected defaults: %+v", cfg)
+		}
+	})
+
+	t.Run("flags override env, env overrides the file", func(t *testing.T) {
+		for _, file := range []struct{ name, content string }{
+			{"config.yaml", "log_level: warn\ntoken_ttl: 1h\ncors_allowed_origins:\n  - https://a.example\n  - https://b.example\ndb_max_open_conns: 10\n"},
+			{"config.toml", "log_level = \"warn\"\ntoken_ttl = \"1h\"\ncors_allowed_origins = [\"https://a.example\", \"https://b.example\"]\ndb_max_open_conns = 10\n"},
+			{"config.json", `{"log_level": "warn", "token_ttl": "1h", "cors_allowed_origins": ["https://a.example", "https://b.example"], "db_max_open_conns": 10}`},
+		} {
+			t.Run(file.name, func(t *testing.T) {
+				t.Setenv("CONFIG_FILE", writeFile(t, file.name, file.content))
+				t.Setenv("TOKEN_TTL", "2h")
+
+				cfg, err := load(t, "--log-level", "error")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if cfg.LogLevel != "error" {
+					t.Errorf("expected the flag to win, got log level %q", cfg.LogLevel)
+				}
+				if cfg.TokenTTL != 2*time.Hour {
+					t.Errorf("expected the env var to win, got token TTL %v", cfg.TokenTTL)
+				}
+				if cfg.DBMaxOpenConns != 10 {
+					t.Errorf("expected the file to be read, got %d open connections", cfg.DBMaxOpenConns)
+				}
+				if got := strings.Join(cfg.CORSAllowed, " "); got != "https://a.example https://b.example" {
+					t.Errorf("unexpected CORS origins %q", got)
+				}
+			})
+		}
+	})
+
+	t.Run("reports every problem", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "loud")
+		path := writeFile(t, "config.yaml", "trash_retention: 0s\ntrash_purge_interval: 0s\nsurprise: true\n")
+
+		_, err := load(t, "--config", path, "--db-max-idle-conns", "5", "--db-max-open-conns", "1", "--tls-key-file", path)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		for _, want := range []string{
+			`unknown setting "surprise"`,
+			`invalid log_level "loud" (from env LOG_LEVEL)`,
+			`invalid trash_retention "0s" (from file)`,
+			`invalid trash_purge_interval "0s" (from file)`,
+			"db_max_idle_conns must not exceed db_max_open_conns",
+			"tls_cert_file and tls_key_file must be set together",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error to contain %q, got:\n%v", want, err)
+			}
+		}
+	})
+
+	t.Run("unsupported file format", func(t *testing.T) {
+		_, err := load(t, "--config", writeFile(t, "config.ini", "log_level=warn"))
+		if err == nil || !strings.Contains(err.Error(), "unsupported format") {
+			t.Errorf("expected an unsupported format error, got %v", err)
+		}
+	})
+}
+
+func TestPrint(t *testing.T) {
+	t.Setenv("AUTH_SECRET", "hunter2")
+
+	cfg, err := load(t, "--http-addr", ":9090")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("expected the secret to be redacted:\n%s", out)
+	}
+	for _, want := range []string{"auth_secret: '[REDACTED]'", "http_addr: :9090"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, out)
+		}
+	}
+	if cfg.AuthSecret != "hunter2" {
+		t.Errorf("printing must not modify the config, got secret %q", cfg.AuthSecret)
+	}
+
+	// The printed configuration loads back.
+	t.Setenv("AUTH_SECRET", "")
+	reloaded, err := load(t, "--config", writeFile(t, "config.yaml", out))
+	if err != nil {
+		t.Fatalf("failed to load printed config: %v", err)
+	}
+	if reloaded.HTTPAddr != ":9090" {
+		t.Errorf("unexpected address %q", reloaded.HTTPAddr)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	before, err := load(t)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := load(t, "--log-level", "debug", "--cors-allowed-origins", "https://a.example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(before.Changed(after), ","); got != "cors_allowed_origins,log_level" {
+		t.Errorf("unexpected changed settings %q", got)
+	}
+	if got := before.Changed(before); len(got) != 0 {
+		t.Errorf("expected no changes, got %v", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := writeFile(t, "config.yaml", "log_level: info\n")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	if err := fs.Parse([]string{"--config", path, "--watch-config"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	if err := loader.Watch(ctx, func() { changed <- struct{}{} }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Writing another file in the same directory is no change.
+	writeFileAt(t, filepath.Join(filepath.Dir(path), "other.yaml"), "log_level: warn\n")
+	writeFileAt(t, path, "log_level: debug\n")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the change")
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogLevel != "debug" || !cfg.WatchConfig {
+		t.Errorf("unexpected config after change: %+v", cfg)
+	}
+	select {
+	case <-changed:
+		t.Error("expected a single change")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func writeFileAt(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
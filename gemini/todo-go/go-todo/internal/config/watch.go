@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleDelay is how long Watch waits for writes to the configuration file
+// to stop before reporting a change, so that an editor saving a file in
+// several steps causes a single reload.
+const settleDelay = 100 * time.Millisecond
+
+// Watch calls changed whenever the configuration file is written, created
+// or replaced, until ctx is done. The file's directory is watched rather
+// than the file itself, because many editors replace files instead of
+// writing to them.
+func (l *Loader) Watch(ctx context.Context, changed func()) error {
+	path := l.File()
+	if path == "" {
+		return errors.New("no config file to watch")
+	}
+	path = filepath.Clean(path)
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	go func() {
+		defer w.Close()
+
+		settle := time.NewTimer(settleDelay)
+		settle.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				settle.Stop()
+				return
+			case event := <-w.Events:
+				if filepath.Clean(event.Name) == path && event.Op != fsnotify.Chmod {
+					settle.Reset(settleDelay)
+				}
+			case <-w.Errors:
+				// The next event or SIGHUP reloads the file anyway.
+			case <-settle.C:
+				changed()
+			}
+		}
+	}()
+	return nil
+}
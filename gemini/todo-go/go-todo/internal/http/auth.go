@@ -0,0 +1,123 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gemini/go-todo/internal/user"
+	"github.com/go-chi/chi/v5"
+)
+
+// UserService defines the interface for registration and login.
+type UserService interface {
+	Register(ctx context.Context, email, password string) (*user.User, error)
+	Login(ctx context.Context, email, password string) (*user.User, error)
+}
+
+// TokenIssuer issues bearer tokens for authenticated users.
+type TokenIssuer interface {
+	Issue(userID int64) (string, time.Time, error)
+}
+
+// AuthHandler handles HTTP requests for registration and login.
+type AuthHandler struct {
+	users  UserService
+	tokens TokenIssuer
+	logger *slog.Logger
+}
+
+// NewAuthHandler creates a new HTTP handler for authentication.
+func NewAuthHandler(users UserService, tokens TokenIssuer, logger *slog.Logger) *AuthHandler {
+	return &AuthHandler{
+		users:  users,
+		tokens: tokens,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes registers the authentication routes.
+func (h *AuthHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/api/auth", func(r chi.Router) {
+		r.Post("/register", h.register)
+		r.Post("/login", h.login)
+	})
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (h *AuthHandler) register(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	u, err := h.users.Register(r.Context(), req.Email, req.Password)
+	if errors.Is(err, user.ErrInvalidEmail) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"email": "must be a valid email address"}})
+		return
+	}
+	if errors.Is(err, user.ErrPasswordTooShort) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"password": "is too short"}})
+		return
+	}
+	if errors.Is(err, user.ErrPasswordTooLong) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"password": "is too long"}})
+		return
+	}
+	if errors.Is(err, user.ErrEmailTaken) {
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "email_taken", "message": "email already registered"})
+		return
+	}
+	if err != nil {
+		logError(r, h.logger, "failed to register user", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+
+	h.JSON(w, r, http.StatusCreated, u)
+}
+
+func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	u, err := h.users.Login(r.Context(), req.Email, req.Password)
+	if errors.Is(err, user.ErrInvalidCredentials) {
+		h.JSON(w, r, http.StatusUnauthorized, map[string]string{"error": "invalid_credentials"})
+		return
+	}
+	if err != nil {
+		logError(r, h.logger, "failed to log in user", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+
+	token, expires, err := h.tokens.Issue(u.ID)
+	if err != nil {
+		logError(r, h.logger, "failed to issue token", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+
+	h.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_at":   expires,
+	})
+}
+
+// JSON writes a JSON response.
+func (h *AuthHandler) JSON(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	writeJSON(h.logger, w, r, code, data)
+}
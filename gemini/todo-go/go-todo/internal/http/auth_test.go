@@ -0,0 +1,156 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/user"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAuth(t *testing.T) {
+	repo := memory.NewRepo()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	tokens := auth.NewTokens([]byte("test secret"), time.Hour)
+	handler := httpHandler.NewHandler(todo.NewService(repo), logger)
+	authHandler := httpHandler.NewAuthHandler(user.NewService(repo.Users()), tokens, logger)
+
+	r := chi.NewRouter()
+	authHandler.RegisterRoutes(r)
+	r.Group(func(r chi.Router) {
+		r.Use(httpHandler.Authenticate(tokens, handler, httpHandler.AllowQueryToken(httpHandler.EventsPath)))
+		handler.RegisterRoutes(r)
+	})
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	login := func(email string) string {
+		t.Helper()
+		creds := `{"email": "` + email + `", "password": "correct horse"}`
+		if rr := do("POST", "/api/auth/register", "", creds); rr.Code != http.StatusCreated {
+			t.Fatalf("register returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+		}
+		rr := do("POST", "/api/auth/login", "", creds)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("login returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var resp struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.AccessToken == "" {
+			t.Fatalf("could not decode token: %v", err)
+		}
+		return resp.AccessToken
+	}
+
+	alice := login("alice@example.com")
+	bob := login("bob@example.com")
+
+	rr := do("POST", "/api/todos", alice, `{"title": "Alice's todo"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var created todo.Todo
+	json.NewDecoder(rr.Body).Decode(&created)
+	path := "/api/todos/" + strconv.FormatInt(created.ID, 10)
+
+	t.Run("rejects requests without a valid token", func(t *testing.T) {
+		for _, token := range []string{"", "bogus"} {
+			rr := do("GET", "/api/todos", token, "")
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+			}
+			if rr.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate header")
+			}
+		}
+	})
+
+	t.Run("rejects passwords bcrypt cannot hash", func(t *testing.T) {
+		body := `{"email": "carol@example.com", "password": "` + strings.Repeat("x", user.MaxPasswordLength+1) + `"}`
+		rr := do("POST", "/api/auth/register", "", body)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+		var resp struct {
+			Error   string            `json:"error"`
+			Details map[string]string `json:"details"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp.Error != "validation_error" || resp.Details["password"] == "" {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("rejects a wrong password", func(t *testing.T) {
+		rr := do("POST", "/api/auth/login", "", `{"email": "alice@example.com", "password": "wrong password"}`)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("lets the owner read the todo", func(t *testing.T) {
+		if rr := do("GET", path, alice, ""); rr.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("accepts a token in the query of the change feed only", func(t *testing.T) {
+		// The stream ends at once, since the request is cancelled.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest("GET", httpHandler.EventsPath+"?access_token="+alice, nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+
+		for _, method := range []string{"GET", "DELETE"} {
+			if rr := do(method, path+"?access_token="+alice, "", ""); rr.Code != http.StatusUnauthorized {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v", method, rr.Code, http.StatusUnauthorized)
+			}
+		}
+		if rr := do("GET", "/api/todos?access_token="+alice, "", ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("hides the todo from other users", func(t *testing.T) {
+		for _, method := range []string{"GET", "PUT", "PATCH", "DELETE"} {
+			rr := do(method, path, bob, `{"title": "Bob was here"}`)
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("%s returned wrong status code: got %v want %v", method, rr.Code, http.StatusNotFound)
+			}
+		}
+
+		rr := do("GET", "/api/todos", bob, "")
+		var todos []todo.Todo
+		json.NewDecoder(rr.Body).Decode(&todos)
+		if len(todos) != 0 {
+			t.Errorf("expected bob to see no todos, got %d", len(todos))
+		}
+	})
+}
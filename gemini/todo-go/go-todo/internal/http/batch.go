@@ -0,0 +1,151 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// errInvalidPatch marks update operations whose merge patch cannot be
+// applied.
+var errInvalidPatch = errors.New("invalid patch")
+
+// batchOperation is one operation of a batch request. Creates take the
+// fields of a new todo in Todo, updates a merge patch.
+type batchOperation struct {
+	Op      todo.Op         `json:"op"`
+	ID      int64           `json:"id"`
+	Version int64           `json:"version"`
+	Todo    json.RawMessage `json:"todo"`
+}
+
+// batchResult is the outcome of one batch operation.
+type batchResult struct {
+	Status  int               `json:"status"`
+	Todo    *todo.Todo        `json:"todo,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func (h *Handler) batchTodos(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Operations []batchOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if len(req.Operations) > todo.MaxBatchSize {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": todo.ErrBatchTooLarge.Error()})
+		return
+	}
+
+	ops := make([]todo.BatchOp, len(req.Operations))
+	for i, op := range req.Operations {
+		ops[i] = todo.BatchOp{Op: op.Op, ID: op.ID, Version: op.Version}
+		switch op.Op {
+		case todo.OpCreate:
+			var create createRequest
+			if err := json.Unmarshal(op.Todo, &create); err != nil {
+				h.batchFailed(w, r, len(ops), i, batchResult{Status: http.StatusBadRequest, Error: "invalid_request"})
+				return
+			}
+			ops[i].Patch = create.patch()
+		case todo.OpUpdate:
+			body := op.Todo
+			ops[i].PatchFunc = func(current *todo.Todo) (todo.Patch, error) {
+				p, err := patchTodoDoc(mergePatchType, body, current)
+				if err != nil {
+					return p, fmt.Errorf("%w: %v", errInvalidPatch, err)
+				}
+				return p, nil
+			}
+		}
+	}
+
+	todos, err := h.service.Batch(r.Context(), ops)
+	var batchErr *todo.BatchError
+	if errors.As(err, &batchErr) {
+		h.batchFailed(w, r, len(ops), batchErr.Index, h.batchError(r.Context(), batchErr.Err))
+		return
+	}
+	if err != nil {
+		logError(r, h.logger, "failed to apply batch", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+
+	results := make([]batchResult, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case todo.OpCreate:
+			results[i] = batchResult{Status: http.StatusCreated, Todo: todos[i]}
+		case todo.OpUpdate:
+			results[i] = batchResult{Status: http.StatusOK, Todo: todos[i]}
+		default:
+			results[i] = batchResult{Status: http.StatusNoContent}
+		}
+	}
+	h.JSON(w, r, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// batchFailed responds to a batch of n operations whose operation at index
+// failed with result. The other operations were not applied.
+func (h *Handler) batchFailed(w http.ResponseWriter, r *http.Request, n, index int, result batchResult) {
+	results := make([]batchResult, n)
+	for i := range results {
+		results[i] = batchResult{Status: http.StatusFailedDependency, Error: "not_applied"}
+	}
+	results[index] = result
+	h.JSON(w, r, result.Status, map[string]interface{}{"error": "batch_failed", "index": index, "results": results})
+}
+
+// batchError describes the failure of a batch operation.
+func (h *Handler) batchError(ctx context.Context, err error) batchResult {
+	switch {
+	case errors.Is(err, todo.ErrNotFound):
+		return batchResult{Status: http.StatusNotFound, Error: "not_found", Message: "todo not found"}
+	case errors.Is(err, todo.ErrConflict):
+		return batchResult{Status: http.StatusConflict, Error: "conflict", Message: "todo has been modified"}
+	case errors.Is(err, errInvalidPatch):
+		return batchResult{Status: http.StatusBadRequest, Error: "invalid_patch", Message: err.Error()}
+	case errors.Is(err, todo.ErrUnknownOp), errors.Is(err, todo.ErrDuplicateOp):
+		return batchResult{Status: http.StatusBadRequest, Error: "invalid_operation", Message: err.Error()}
+	case errors.Is(err, todo.ErrInvalid):
+		return batchResult{Status: http.StatusBadRequest, Error: "validation_error", Details: validationDetails(err)}
+	}
+	requestLogger(ctx, h.logger).ErrorContext(ctx, "failed to apply batch operation", "error", err)
+	return batchResult{Status: http.StatusInternalServerError, Error: "internal_error"}
+}
+
+// deleteTodos moves every todo matching the list filters to the trash,
+// for example all completed ones. At least one filter is required.
+func (h *Handler) deleteTodos(w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Query()) == 0 {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "deleting todos requires a filter"})
+		return
+	}
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": err.Error()})
+		return
+	}
+
+	deleted, err := h.service.DeleteTodos(r.Context(), opts)
+	switch {
+	case err == nil:
+		h.JSON(w, r, http.StatusOK, map[string]int{"deleted": deleted})
+	case errors.Is(err, todo.ErrConflict), errors.Is(err, todo.ErrNotFound):
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "conflict", "message": "todos have been modified"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": err.Error()})
+	default:
+		logError(r, h.logger, "failed to delete todos", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
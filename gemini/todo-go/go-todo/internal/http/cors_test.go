@@ -0,0 +1,36 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+)
+
+func TestCors(t *testing.T) {
+	cors := httpHandler.NewCors([]string{"https://a.example"})
+	h := cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	allowed := func(origin string) bool {
+		req := httptest.NewRequest("GET", "/api/todos", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	if !allowed("https://a.example") || allowed("https://b.example") {
+		t.Fatal("expected only https://a.example to be allowed")
+	}
+
+	t.Run("replaced origins apply to later requests", func(t *testing.T) {
+		cors.SetAllowedOrigins([]string{"https://b.example"})
+		if allowed("https://a.example") {
+			t.Error("expected https://a.example to be no longer allowed")
+		}
+		if !allowed("https://b.example") {
+			t.Error("expected https://b.example to be allowed")
+		}
+	})
+}
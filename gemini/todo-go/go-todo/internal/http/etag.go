@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// errPreconditionFailed is returned when an If-Match header matches no
+// current version of a todo.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// etag returns the strong entity tag for the current version of t.
+func etag(t *todo.Todo) string {
+	return `"` + strconv.FormatInt(t.Version, 10) + `"`
+}
+
+// entityTags is a parsed If-Match or If-None-Match header.
+type entityTags struct {
+	present  bool
+	any      bool
+	versions []int64
+}
+
+// parseEntityTags parses a list of entity tags. Weak and malformed tags never
+// match, since todo versions only have strong tags.
+func parseEntityTags(header string) entityTags {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return entityTags{}
+	}
+	tags := entityTags{present: true}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			tags.any = true
+			continue
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if v, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+			tags.versions = append(tags.versions, v)
+		}
+	}
+	return tags
+}
+
+func (e entityTags) matches(version int64) bool {
+	if e.any {
+		return true
+	}
+	for _, v := range e.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion resolves the If-Match header of r into the version a write
+// to the todo must be conditioned on. It returns 0 for unconditional writes
+// and errPreconditionFailed when no listed tag can match.
+func (h *Handler) expectedVersion(ctx context.Context, r *http.Request, id int64) (int64, error) {
+	ifMatch := parseEntityTags(r.Header.Get("If-Match"))
+	switch {
+	case !ifMatch.present || ifMatch.any:
+		return 0, nil
+	case len(ifMatch.versions) == 0:
+		return 0, errPreconditionFailed
+	case len(ifMatch.versions) == 1:
+		return ifMatch.versions[0], nil
+	}
+
+	current, err := h.service.GetTodo(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if !ifMatch.matches(current.Version) {
+		return 0, errPreconditionFailed
+	}
+	return current.Version, nil
+}
+
+// conflictStatus maps todo.ErrConflict to 412 for conditional requests and
+// to 409 for concurrent modifications detected without a precondition.
+func conflictStatus(r *http.Request) int {
+	if r.Header.Get("If-Match") != "" {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
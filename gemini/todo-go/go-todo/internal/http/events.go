@@ -0,0 +1,164 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// eventHeartbeat is how often idle event streams are kept alive.
+	eventHeartbeat = 15 * time.Second
+	// eventWriteTimeout bounds how long writing an event to a WebSocket
+	// may take.
+	eventWriteTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	// Clients authenticate with a bearer token rather than cookies, so a
+	// page on another origin cannot connect on behalf of a user. This holds
+	// as long as the access_token query parameter, which such a page could
+	// only fill in with a token it already has, is accepted on the change
+	// feed alone.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// todoEvents streams the changes to the user's todos, as server-sent
+// events or, for WebSocket upgrade requests, as WebSocket messages. A
+// client resumes after the last event it saw with the Last-Event-ID header
+// or the last_event_id query parameter.
+func (h *Handler) todoEvents(w http.ResponseWriter, r *http.Request) {
+	after, err := lastEventID(r)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_last_event_id"})
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		h.websocketEvents(w, r, after)
+		return
+	}
+	h.streamEvents(w, r, after)
+}
+
+// lastEventID reads the ID of the last event a resuming client saw.
+func lastEventID(r *http.Request) (int64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid event ID %q", v)
+	}
+	return id, nil
+}
+
+// streamEvents writes events as server-sent events. If the events after
+// the last one the client saw are no longer kept, a "reset" event tells it
+// to reload its todos first.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request, after int64) {
+	rc := http.NewResponseController(w)
+	sub := h.service.Subscribe(r.Context(), after)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if sub.Lost {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	if err := rc.Flush(); err != nil {
+		logError(r, h.logger, "failed to flush event stream", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				logError(r, h.logger, "failed to encode event", "error", err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// websocketEvents writes each event as a JSON text message. If the events
+// after the last one the client saw are no longer kept, a message of type
+// "reset" tells it to reload its todos first.
+func (h *Handler) websocketEvents(w http.ResponseWriter, r *http.Request, after int64) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has replied already.
+		return
+	}
+	defer conn.Close()
+	sub := h.service.Subscribe(r.Context(), after)
+	defer sub.Close()
+
+	// Reading handles pings and notices when the client goes away. Clients
+	// are not expected to send messages.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(v)
+	}
+	if sub.Lost {
+		if err := write(map[string]string{"type": "reset"}); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(eventWriteTimeout))
+				return
+			}
+			if err := write(e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
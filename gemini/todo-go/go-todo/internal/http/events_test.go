@@ -0,0 +1,139 @@
+package http_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+func TestHandler_Events(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	r.Use(httpHandler.RequestLogger(logger))
+	handler.RegisterRoutes(r)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	create := func(title string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/api/todos", "application/json", bytes.NewBufferString(`{"title": "`+title+`"}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	var first int64
+	t.Run("streams server-sent events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/todos/events", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %q", ct)
+		}
+
+		create("Streamed")
+		lines := readEvent(t, bufio.NewReader(resp.Body))
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "id: ") || lines[1] != "event: created" || !strings.Contains(lines[2], `"title":"Streamed"`) {
+			t.Fatalf("expected a created event, got %q", lines)
+		}
+		first, _ = strconv.ParseInt(strings.TrimPrefix(lines[0], "id: "), 10, 64)
+	})
+
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		create("Missed")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/todos/events", nil)
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(first, 10))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		lines := readEvent(t, bufio.NewReader(resp.Body))
+		if len(lines) != 3 || lines[0] != "id: "+strconv.FormatInt(first+1, 10) || !strings.Contains(lines[2], `"title":"Missed"`) {
+			t.Errorf("expected the missed event, got %q", lines)
+		}
+	})
+
+	t.Run("rejects an invalid Last-Event-ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/todos/events?last_event_id=x", nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sends events over a WebSocket", func(t *testing.T) {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/todos/events?last_event_id=" + strconv.FormatInt(first+1, 10)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer conn.Close()
+
+		create("Pushed")
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var e todo.Event
+		if err := conn.ReadJSON(&e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if e.ID != first+2 || e.Type != todo.ActionCreated || e.Todo == nil || e.Todo.Title != "Pushed" {
+			t.Errorf("expected a created event, got %+v", e)
+		}
+
+		service.CloseSubscriptions()
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("expected the connection to be closed, got %v", err)
+		}
+	})
+}
+
+// readEvent reads the lines of the next server-sent event, skipping
+// comments.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		if line == "" {
+			if len(lines) > 0 {
+				return lines
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+}
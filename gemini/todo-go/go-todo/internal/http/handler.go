@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gemini/go-todo/internal/todo"
 	"github.com/go-chi/chi/v5"
@@ -14,13 +18,37 @@ import (
 
 // TodoService defines the interface for todo-related operations.
 type TodoService interface {
-	CreateTodo(ctx context.Context, title, description string) (*todo.Todo, error)
-	ListTodos(ctx context.Context, completed *bool) ([]*todo.Todo, error)
+	CreateTodoWith(ctx context.Context, p todo.Patch) (*todo.Todo, error)
+	ListTodos(ctx context.Context, opts todo.ListOptions) (*todo.Page, error)
+	Agenda(ctx context.Context, loc *time.Location, days int) (*todo.Agenda, error)
 	GetTodo(ctx context.Context, id int64) (*todo.Todo, error)
-	UpdateTodo(ctx context.Context, id int64, title, description string, completed bool) (*todo.Todo, error)
-	DeleteTodo(ctx context.Context, id int64) error
+	PatchTodo(ctx context.Context, id, version int64, p todo.Patch) (*todo.Todo, error)
+	DeleteTodo(ctx context.Context, id, version int64) error
+	MoveTodo(ctx context.Context, id, version, after, before int64) (*todo.Todo, error)
+	RestoreTodo(ctx context.Context, id int64) (*todo.Todo, error)
+	TodoHistory(ctx context.Context, id int64) ([]todo.HistoryEntry, error)
+	Batch(ctx context.Context, ops []todo.BatchOp) ([]*todo.Todo, error)
+	DeleteTodos(ctx context.Context, opts todo.ListOptions) (int, error)
+	Subscribe(ctx context.Context, after int64) *todo.Subscription
+
+	CreateSubtask(ctx context.Context, parentID int64, p todo.Patch) (*todo.Todo, error)
+	ListSubtasks(ctx context.Context, parentID int64) ([]*todo.Todo, error)
+
+	ListTags(ctx context.Context) ([]todo.Tag, error)
+	CreateTag(ctx context.Context, name string) (*todo.Tag, error)
+	RenameTag(ctx context.Context, from, to string) error
+	DeleteTag(ctx context.Context, name string) error
+
+	ListProjects(ctx context.Context) ([]*todo.Project, error)
+	CreateProject(ctx context.Context, name string) (*todo.Project, error)
+	GetProject(ctx context.Context, id int64) (*todo.Project, error)
+	UpdateProject(ctx context.Context, id int64, p todo.ProjectPatch) (*todo.Project, error)
+	DeleteProject(ctx context.Context, id int64) error
 }
 
+// maxPatchSize limits the size of PATCH request bodies.
+const maxPatchSize = 1 << 20
+
 // Handler handles HTTP requests for todos.
 type Handler struct {
 	service TodoService
@@ -35,61 +63,272 @@ func NewHandler(service TodoService, logger *slog.Logger) *Handler {
 	}
 }
 
-// RegisterRoutes registers the todo routes.
-func (h *Handler) RegisterRoutes(r *chi.Mux) {
+// EventsPath is the path of the change feed. Authenticate should be given
+// AllowQueryToken(EventsPath), so that browsers can connect to it.
+const EventsPath = "/api/todos/events"
+
+// RegisterRoutes registers the todo routes. Todos are scoped to the user in
+// the request context, so the routes are normally mounted behind
+// Authenticate.
+func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Route("/api/todos", func(r chi.Router) {
 		r.Post("/", h.createTodo)
 		r.Get("/", h.listTodos)
+		r.Delete("/", h.deleteTodos)
+		r.Post("/batch", h.batchTodos)
+		r.Get("/agenda", h.agenda)
+		r.Get("/events", h.todoEvents)
+		r.Get("/trash", h.listTrash)
 		r.Get("/{id}", h.getTodo)
 		r.Put("/{id}", h.updateTodo)
+		r.Patch("/{id}", h.patchTodo)
 		r.Delete("/{id}", h.deleteTodo)
+		r.Post("/{id}/move", h.moveTodo)
+		r.Post("/{id}/restore", h.restoreTodo)
+		r.Get("/{id}/history", h.todoHistory)
+		r.Get("/{id}/subtasks", h.listSubtasks)
+		r.Post("/{id}/subtasks", h.createSubtask)
+	})
+	r.Route("/api/tags", func(r chi.Router) {
+		r.Get("/", h.listTags)
+		r.Post("/", h.createTag)
+		r.Put("/{name}", h.renameTag)
+		r.Delete("/{name}", h.deleteTag)
+	})
+	r.Route("/api/projects", func(r chi.Router) {
+		r.Get("/", h.listProjects)
+		r.Post("/", h.createProject)
+		r.Get("/{id}", h.getProject)
+		r.Patch("/{id}", h.updateProject)
+		r.Delete("/{id}", h.deleteProject)
 	})
 }
 
-func (h *Handler) createTodo(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
+// createRequest is the body of requests creating a todo or subtask.
+type createRequest struct {
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	Tags         []string         `json:"tags"`
+	DueAt        *time.Time       `json:"due_at"`
+	Priority     *int             `json:"priority"`
+	ProjectID    *int64           `json:"project_id"`
+	AutoComplete *bool            `json:"auto_complete"`
+	Recurrence   *todo.Recurrence `json:"recurrence"`
+}
+
+func (req createRequest) patch() todo.Patch {
+	p := todo.Patch{
+		Title:        &req.Title,
+		Description:  &req.Description,
+		DueAt:        req.DueAt,
+		Priority:     req.Priority,
+		ProjectID:    req.ProjectID,
+		AutoComplete: req.AutoComplete,
+		Recurrence:   req.Recurrence,
 	}
+	if req.Tags != nil {
+		p.Tags = &req.Tags
+	}
+	return p
+}
 
+func (h *Handler) createTodo(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
 		return
 	}
 
-	createdTodo, err := h.service.CreateTodo(r.Context(), req.Title, req.Description)
+	createdTodo, err := h.service.CreateTodoWith(r.Context(), req.patch())
 	if errors.Is(err, todo.ErrInvalid) {
-		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"title": "is required"}})
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
 		return
 	}
 	if err != nil {
-		h.logger.Error("failed to create todo", "error", err)
+		logError(r, h.logger, "failed to create todo", "error", err)
 		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
 		return
 	}
 
+	w.Header().Set("ETag", etag(createdTodo))
 	h.JSON(w, r, http.StatusCreated, createdTodo)
 }
 
 func (h *Handler) listTodos(w http.ResponseWriter, r *http.Request) {
-	var completed *bool
-	if completedStr := r.URL.Query().Get("completed"); completedStr != "" {
-		c, err := strconv.ParseBool(completedStr)
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": err.Error()})
+		return
+	}
+	h.listPage(w, r, opts)
+}
+
+// listPage writes a page of the todos matching opts, linking to the next
+// page if there is one.
+func (h *Handler) listPage(w http.ResponseWriter, r *http.Request, opts todo.ListOptions) {
+	page, err := h.service.ListTodos(r.Context(), opts)
+	if errors.Is(err, todo.ErrInvalidCursor) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "invalid cursor"})
+		return
+	}
+	if errors.Is(err, todo.ErrInvalidTag) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "invalid tag"})
+		return
+	}
+	if errors.Is(err, todo.ErrInvalidQuery) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "q must contain a word"})
+		return
+	}
+	if errors.Is(err, todo.ErrInvalid) {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "invalid sort field"})
+		return
+	}
+	if err != nil {
+		logError(r, h.logger, "failed to list todos", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+
+	if page.NextCursor != "" {
+		q := r.URL.Query()
+		q.Set("cursor", page.NextCursor)
+		next := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	h.JSON(w, r, http.StatusOK, page.Todos)
+}
+
+// parseListOptions reads the list filters, ordering and pagination
+// parameters from the query string.
+func parseListOptions(q url.Values) (todo.ListOptions, error) {
+	// Subtasks are listed under their parent.
+	var topLevel int64
+	opts := todo.ListOptions{ParentID: &topLevel}
+
+	if v := q.Get("completed"); v != "" {
+		c, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("completed must be a boolean")
+		}
+		opts.Completed = &c
+	}
+
+	times := []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+		{"updated_after", &opts.UpdatedAfter},
+		{"updated_before", &opts.UpdatedBefore},
+		{"due_after", &opts.DueAfter},
+		{"due_before", &opts.DueBefore},
+	}
+	for _, p := range times {
+		if v := q.Get(p.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be an RFC 3339 timestamp", p.param)
+			}
+			*p.dst = &t
+		}
+	}
+
+	if v := q.Get("overdue"); v != "" {
+		o, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("overdue must be a boolean")
+		}
+		opts.Overdue = &o
+	}
+
+	if v := q.Get("project_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return opts, fmt.Errorf("project_id must be a project ID, or 0 for todos outside any project")
+		}
+		opts.ProjectID = &id
+	}
+	if v := q.Get("include_archived"); v != "" {
+		a, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("include_archived must be a boolean")
+		}
+		opts.IncludeArchived = a
+	}
+
+	opts.Tags = q["tag"]
+	switch q.Get("tag_mode") {
+	case "", "any":
+	case "all":
+		opts.MatchAllTags = true
+	default:
+		return opts, fmt.Errorf("tag_mode must be any or all")
+	}
+
+	opts.Query = q.Get("q")
+
+	if v := q.Get("sort"); v != "" {
+		opts.Sort = todo.SortField(v)
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("order must be asc or desc")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return opts, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := todo.DecodeCursor(v)
 		if err != nil {
-			h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param"})
+			return opts, err
+		}
+		opts.After = c
+	}
+
+	return opts, nil
+}
+
+func (h *Handler) agenda(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	loc := time.UTC
+	if v := q.Get("tz"); v != "" {
+		l, err := time.LoadLocation(v)
+		if err != nil {
+			h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "tz must be an IANA time zone"})
 			return
 		}
-		completed = &c
+		loc = l
 	}
 
-	todos, err := h.service.ListTodos(r.Context(), completed)
+	var days int
+	if v := q.Get("days"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 1 {
+			h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": "days must be a positive integer"})
+			return
+		}
+		days = d
+	}
+
+	agenda, err := h.service.Agenda(r.Context(), loc, days)
 	if err != nil {
-		h.logger.Error("failed to list todos", "error", err)
+		logError(r, h.logger, "failed to build agenda", "error", err)
 		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
 		return
 	}
-
-	h.JSON(w, r, http.StatusOK, todos)
+	h.JSON(w, r, http.StatusOK, agenda)
 }
 
 func (h *Handler) getTodo(w http.ResponseWriter, r *http.Request) {
@@ -105,11 +344,16 @@ func (h *Handler) getTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err != nil {
-		h.logger.Error("failed to get todo", "error", err)
+		logError(r, h.logger, "failed to get todo", "error", err)
 		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
 		return
 	}
 
+	w.Header().Set("ETag", etag(t))
+	if parseEntityTags(r.Header.Get("If-None-Match")).matches(t.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	h.JSON(w, r, http.StatusOK, t)
 }
 
@@ -120,10 +364,18 @@ func (h *Handler) updateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Tags, due date, priority, project, auto-completion and recurrence are
+	// optional on PUT and left unchanged when omitted.
 	var req struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Completed   bool   `json:"completed"`
+		Title        string           `json:"title"`
+		Description  string           `json:"description"`
+		Completed    bool             `json:"completed"`
+		Tags         *[]string        `json:"tags"`
+		DueAt        *time.Time       `json:"due_at"`
+		Priority     *int             `json:"priority"`
+		ProjectID    *int64           `json:"project_id"`
+		AutoComplete *bool            `json:"auto_complete"`
+		Recurrence   *todo.Recurrence `json:"recurrence"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -131,21 +383,108 @@ func (h *Handler) updateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updatedTodo, err := h.service.UpdateTodo(r.Context(), id, req.Title, req.Description, req.Completed)
+	var updatedTodo *todo.Todo
+	version, err := h.expectedVersion(r.Context(), r, id)
+	if err == nil {
+		updatedTodo, err = h.service.PatchTodo(r.Context(), id, version, todo.Patch{
+			Title:        &req.Title,
+			Description:  &req.Description,
+			Completed:    &req.Completed,
+			Tags:         req.Tags,
+			DueAt:        req.DueAt,
+			Priority:     req.Priority,
+			ProjectID:    req.ProjectID,
+			AutoComplete: req.AutoComplete,
+			Recurrence:   req.Recurrence,
+		})
+	}
+	switch {
+	case err == nil:
+		w.Header().Set("ETag", etag(updatedTodo))
+		h.JSON(w, r, http.StatusOK, updatedTodo)
+	case errors.Is(err, todo.ErrNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+	case errors.Is(err, errPreconditionFailed), errors.Is(err, todo.ErrConflict):
+		h.JSON(w, r, conflictStatus(r), map[string]string{"error": "conflict", "message": "todo has been modified"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to update todo", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+func (h *Handler) patchTodo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.JSON(w, r, http.StatusRequestEntityTooLarge, map[string]string{"error": "request_too_large", "message": fmt.Sprintf("patch must not exceed %d bytes", tooLarge.Limit)})
+		return
+	}
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	current, err := h.service.GetTodo(r.Context(), id)
 	if errors.Is(err, todo.ErrNotFound) {
 		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
 		return
 	}
+	if err != nil {
+		logError(r, h.logger, "failed to get todo", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+
+	if ifMatch := parseEntityTags(r.Header.Get("If-Match")); ifMatch.present && !ifMatch.matches(current.Version) {
+		h.JSON(w, r, http.StatusPreconditionFailed, map[string]string{"error": "conflict", "message": "todo has been modified"})
+		return
+	}
+
+	patch, err := patchTodoDoc(r.Header.Get("Content-Type"), body, current)
+	if errors.Is(err, errUnsupportedPatch) {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		h.JSON(w, r, http.StatusUnsupportedMediaType, map[string]string{"error": "unsupported_media_type"})
+		return
+	}
+	if errors.Is(err, errPatchTestFailed) {
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "patch_test_failed", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_patch", "message": err.Error()})
+		return
+	}
+
+	// The patch was computed against current, so it may only be applied to
+	// that version.
+	updatedTodo, err := h.service.PatchTodo(r.Context(), id, current.Version, patch)
+	if errors.Is(err, todo.ErrNotFound) {
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+		return
+	}
+	if errors.Is(err, todo.ErrConflict) {
+		h.JSON(w, r, conflictStatus(r), map[string]string{"error": "conflict", "message": "todo has been modified"})
+		return
+	}
 	if errors.Is(err, todo.ErrInvalid) {
-		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"title": "is required"}})
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
 		return
 	}
 	if err != nil {
-		h.logger.Error("failed to update todo", "error", err)
+		logError(r, h.logger, "failed to patch todo", "error", err)
 		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
 		return
 	}
 
+	w.Header().Set("ETag", etag(updatedTodo))
 	h.JSON(w, r, http.StatusOK, updatedTodo)
 }
 
@@ -156,27 +495,55 @@ func (h *Handler) deleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.service.DeleteTodo(r.Context(), id)
-	if errors.Is(err, todo.ErrNotFound) {
-		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
-		return
+	version, err := h.expectedVersion(r.Context(), r, id)
+	if err == nil {
+		err = h.service.DeleteTodo(r.Context(), id, version)
 	}
-	if err != nil {
-		h.logger.Error("failed to delete todo", "error", err)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, todo.ErrNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+	case errors.Is(err, errPreconditionFailed), errors.Is(err, todo.ErrConflict):
+		h.JSON(w, r, conflictStatus(r), map[string]string{"error": "conflict", "message": "todo has been modified"})
+	default:
+		logError(r, h.logger, "failed to delete todo", "error", err)
 		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
-		return
 	}
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// validationDetails describes which field of a todo failed validation.
+func validationDetails(err error) map[string]string {
+	switch {
+	case errors.Is(err, todo.ErrInvalidTag):
+		return map[string]string{"tags": fmt.Sprintf("must be 1 to %d characters without commas", todo.MaxTagLength)}
+	case errors.Is(err, todo.ErrNestedSubtask):
+		return map[string]string{"parent_id": "must not be a subtask"}
+	case errors.Is(err, todo.ErrInvalidRecurrence):
+		return map[string]string{"recurrence": "must have a supported rule and time zone and a due date"}
+	case errors.Is(err, todo.ErrInvalidMove):
+		return map[string]string{"position": "after and before must be other todos, in that order"}
+	case errors.Is(err, todo.ErrUnknownProject):
+		return map[string]string{"project_id": "must be the ID of one of your projects"}
+	case errors.Is(err, todo.ErrInvalidProjectName):
+		return map[string]string{"name": fmt.Sprintf("must be 1 to %d characters", todo.MaxProjectNameLength)}
+	case errors.Is(err, todo.ErrInvalidPriority):
+		return map[string]string{"priority": fmt.Sprintf("must be between %d and %d", todo.PriorityNone, todo.PriorityHigh)}
+	}
+	return map[string]string{"title": "is required"}
 }
 
 // JSON writes a JSON response.
 func (h *Handler) JSON(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	writeJSON(h.logger, w, r, code, data)
+}
+
+func writeJSON(logger *slog.Logger, w http.ResponseWriter, r *http.Request, code int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			h.logger.Error("failed to write json response", "error", err)
+			logError(r, logger, "failed to write json response", "error", err)
 		}
 	}
 }
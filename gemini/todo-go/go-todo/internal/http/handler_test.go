@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gemini/go-todo/internal/storage/memory"
@@ -96,3 +97,631 @@ func TestHandler_GetTodo(t *testing.T) {
 		}
 	})
 }
+
+func TestHandler_ListTodos(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	for _, title := range []string{"one", "two", "three"} {
+		service.CreateTodo(context.Background(), title, "")
+	}
+
+	t.Run("links to the next page", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/todos?limit=2", nil)
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var todos []todo.Todo
+		if err := json.NewDecoder(rr.Body).Decode(&todos); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(todos) != 2 {
+			t.Errorf("expected 2 todos, got %d", len(todos))
+		}
+
+		link := rr.Header().Get("Link")
+		if !strings.HasPrefix(link, "</api/todos?") || !strings.HasSuffix(link, `>; rel="next"`) {
+			t.Fatalf("unexpected Link header %q", link)
+		}
+
+		next := strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", next, nil))
+
+		todos = nil
+		if err := json.NewDecoder(rr.Body).Decode(&todos); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(todos) != 1 || todos[0].Title != "three" {
+			t.Errorf("expected the last todo on the second page, got %+v", todos)
+		}
+		if link := rr.Header().Get("Link"); link != "" {
+			t.Errorf("expected no Link header on the last page, got %q", link)
+		}
+	})
+
+	t.Run("returns bad request for an invalid cursor", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/todos?cursor=bogus", nil)
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestHandler_PatchTodo(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	created, _ := service.CreateTodo(context.Background(), "Keep me", "And me")
+	path := "/api/todos/" + strconv.FormatInt(created.ID, 10)
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("applies a merge patch", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"completed": true}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+
+		var updated todo.Todo
+		if err := json.NewDecoder(rr.Body).Decode(&updated); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if !updated.Completed || updated.Title != "Keep me" || updated.Description != "And me" {
+			t.Errorf("expected only completed to change, got %+v", updated)
+		}
+	})
+
+	t.Run("removes a field with a null merge patch", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"description": null}`)
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.Description != "" || updated.Title != "Keep me" {
+			t.Errorf("expected description to be cleared, got %+v", updated)
+		}
+	})
+
+	t.Run("replaces fields left out when empty", func(t *testing.T) {
+		rr := patch("application/json-patch+json", `[
+			{"op": "test", "path": "/project_id", "value": 0},
+			{"op": "replace", "path": "/description", "value": "Back again"}
+		]`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+		}
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.Description != "Back again" {
+			t.Errorf("expected description %q, got %q", "Back again", updated.Description)
+		}
+	})
+
+	t.Run("applies a json patch", func(t *testing.T) {
+		rr := patch("application/json-patch+json", `[
+			{"op": "test", "path": "/title", "value": "Keep me"},
+			{"op": "replace", "path": "/title", "value": "Renamed"}
+		]`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.Title != "Renamed" {
+			t.Errorf("expected title %q, got %q", "Renamed", updated.Title)
+		}
+	})
+
+	t.Run("returns conflict when a json patch test fails", func(t *testing.T) {
+		rr := patch("application/json-patch+json", `[{"op": "test", "path": "/title", "value": "Nope"}]`)
+		if status := rr.Code; status != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+		}
+	})
+
+	t.Run("rejects read-only fields", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"id": 42}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("validates the patched todo", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"title": null}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("rejects unsupported media types", func(t *testing.T) {
+		rr := patch("text/plain", `completed=true`)
+		if status := rr.Code; status != http.StatusUnsupportedMediaType {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnsupportedMediaType)
+		}
+	})
+
+	t.Run("rejects oversized patches", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"title": "`+strings.Repeat("x", 1<<20)+`"}`)
+		if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+		}
+	})
+}
+
+func TestHandler_ConditionalRequests(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	created, _ := service.CreateTodo(context.Background(), "Versioned", "")
+	path := "/api/todos/" + strconv.FormatInt(created.ID, 10)
+
+	do := func(method, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("GET", "", nil)
+	tag := rr.Header().Get("ETag")
+	if tag != `"1"` {
+		t.Fatalf("expected ETag %q, got %q", `"1"`, tag)
+	}
+
+	t.Run("returns not modified for a matching If-None-Match", func(t *testing.T) {
+		rr := do("GET", "", map[string]string{"If-None-Match": tag})
+		if status := rr.Code; status != http.StatusNotModified {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotModified)
+		}
+	})
+
+	t.Run("updates with a matching If-Match", func(t *testing.T) {
+		rr := do("PUT", `{"title": "Tab one"}`, map[string]string{"If-Match": tag})
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if got := rr.Header().Get("ETag"); got != `"2"` {
+			t.Errorf("expected ETag %q, got %q", `"2"`, got)
+		}
+	})
+
+	t.Run("rejects a stale If-Match", func(t *testing.T) {
+		for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+			rr := do(method, `{"title": "Tab two"}`, map[string]string{"If-Match": tag})
+			if status := rr.Code; status != http.StatusPreconditionFailed {
+				t.Errorf("%s returned wrong status code: got %v want %v", method, status, http.StatusPreconditionFailed)
+			}
+		}
+
+		current, _ := service.GetTodo(context.Background(), created.ID)
+		if current.Title != "Tab one" {
+			t.Errorf("expected stale writes to be rejected, got title %q", current.Title)
+		}
+	})
+
+	t.Run("deletes with a matching If-Match", func(t *testing.T) {
+		rr := do("DELETE", "", map[string]string{"If-Match": `"1", "2"`})
+		if status := rr.Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+		}
+	})
+}
+
+func TestHandler_DueDates(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/api/todos", "application/json", `{"title": "Late", "due_at": "2020-01-01T09:00:00Z", "priority": 3}`)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var late todo.Todo
+	json.NewDecoder(rr.Body).Decode(&late)
+
+	t.Run("groups the agenda", func(t *testing.T) {
+		rr := do("GET", "/api/todos/agenda?tz=America/New_York", "", "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var agenda todo.Agenda
+		json.NewDecoder(rr.Body).Decode(&agenda)
+		if len(agenda.Overdue) != 1 || agenda.Overdue[0].ID != late.ID {
+			t.Errorf("expected the late todo to be overdue, got %+v", agenda)
+		}
+	})
+
+	t.Run("rejects an unknown time zone", func(t *testing.T) {
+		if status := do("GET", "/api/todos/agenda?tz=Mars/Olympus", "", "").Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("rejects an out of range priority", func(t *testing.T) {
+		rr := do("POST", "/api/todos", "application/json", `{"title": "Bad", "priority": 9}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("rejects a recurrence without a due date", func(t *testing.T) {
+		rr := do("POST", "/api/todos", "application/json", `{"title": "Weekly", "recurrence": {"rule": "FREQ=WEEKLY"}}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("sets a recurrence with a merge patch", func(t *testing.T) {
+		rr := do("PATCH", "/api/todos/"+strconv.FormatInt(late.ID, 10), "application/merge-patch+json", `{"recurrence": {"rule": "FREQ=YEARLY"}}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.Recurrence == nil || updated.Recurrence.Occurrence != 1 {
+			t.Errorf("expected a recurrence at occurrence 1, got %+v", updated.Recurrence)
+		}
+	})
+
+	t.Run("clears the due date with a merge patch", func(t *testing.T) {
+		rr := do("PATCH", "/api/todos/"+strconv.FormatInt(late.ID, 10), "application/merge-patch+json", `{"due_at": null, "recurrence": null}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.DueAt != nil || updated.Priority != todo.PriorityHigh {
+			t.Errorf("expected only the due date to be cleared, got %+v", updated)
+		}
+	})
+}
+
+func TestHandler_Subtasks(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	parent, _ := service.CreateTodo(context.Background(), "Trip", "")
+	path := "/api/todos/" + strconv.FormatInt(parent.ID, 10) + "/subtasks"
+
+	rr := do("POST", path, `{"title": "Book hotel"}`)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var sub todo.Todo
+	json.NewDecoder(rr.Body).Decode(&sub)
+	if sub.ParentID != parent.ID {
+		t.Errorf("expected parent_id %d, got %d", parent.ID, sub.ParentID)
+	}
+
+	t.Run("lists subtasks under their parent only", func(t *testing.T) {
+		var subtasks []todo.Todo
+		json.NewDecoder(do("GET", path, "").Body).Decode(&subtasks)
+		if len(subtasks) != 1 {
+			t.Errorf("expected 1 subtask, got %d", len(subtasks))
+		}
+
+		var todos []todo.Todo
+		json.NewDecoder(do("GET", "/api/todos", "").Body).Decode(&todos)
+		if len(todos) != 1 || todos[0].Progress == nil || todos[0].Progress.Total != 1 {
+			t.Errorf("expected only the parent with its progress, got %+v", todos)
+		}
+	})
+
+	t.Run("rejects nested subtasks", func(t *testing.T) {
+		rr := do("POST", "/api/todos/"+strconv.FormatInt(sub.ID, 10)+"/subtasks", `{"title": "Nested"}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("returns not found for a missing parent", func(t *testing.T) {
+		if status := do("GET", "/api/todos/999/subtasks", "").Code; status != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+	})
+}
+
+func TestHandler_MoveTodo(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first, _ := service.CreateTodo(context.Background(), "First", "")
+	second, _ := service.CreateTodo(context.Background(), "Second", "")
+	movePath := "/api/todos/" + strconv.FormatInt(second.ID, 10) + "/move"
+
+	t.Run("moves a todo before another", func(t *testing.T) {
+		rr := do("POST", movePath, `{"before": `+strconv.FormatInt(first.ID, 10)+`}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"2"` {
+			t.Errorf("expected ETag %q, got %q", `"2"`, etag)
+		}
+
+		var todos []todo.Todo
+		json.NewDecoder(do("GET", "/api/todos?sort=position", "").Body).Decode(&todos)
+		if len(todos) != 2 || todos[0].ID != second.ID {
+			t.Errorf("expected %q first, got %+v", "Second", todos)
+		}
+	})
+
+	t.Run("rejects a move without neighbours", func(t *testing.T) {
+		if status := do("POST", movePath, `{}`).Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("rejects a position in a patch", func(t *testing.T) {
+		rr := do("PATCH", "/api/todos/"+strconv.FormatInt(first.ID, 10), `{"position": "0"}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestHandler_Trash(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	deleted, _ := service.CreateTodo(context.Background(), "Deleted", "")
+	service.CreateTodo(context.Background(), "Kept", "")
+	path := "/api/todos/" + strconv.FormatInt(deleted.ID, 10)
+
+	if status := do("DELETE", path).Code; status != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+
+	t.Run("lists deleted todos in the trash only", func(t *testing.T) {
+		var todos []todo.Todo
+		json.NewDecoder(do("GET", "/api/todos").Body).Decode(&todos)
+		if len(todos) != 1 || todos[0].Title != "Kept" {
+			t.Errorf("expected only %q, got %+v", "Kept", todos)
+		}
+		json.NewDecoder(do("GET", "/api/todos/trash").Body).Decode(&todos)
+		if len(todos) != 1 || todos[0].ID != deleted.ID || todos[0].DeletedAt == nil {
+			t.Errorf("expected the deleted todo in the trash, got %+v", todos)
+		}
+	})
+
+	t.Run("restores a todo", func(t *testing.T) {
+		rr := do("POST", path+"/restore")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if status := do("GET", path).Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if status := do("POST", path+"/restore").Code; status != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+	})
+}
+
+func TestHandler_TodoHistory(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	created, _ := service.CreateTodo(context.Background(), "Draft", "")
+	path := "/api/todos/" + strconv.FormatInt(created.ID, 10)
+
+	req := httptest.NewRequest("PATCH", path, strings.NewReader(`{"title":"Final"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	t.Run("returns the changes to a todo", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", path+"/history", nil))
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var entries []todo.HistoryEntry
+		json.NewDecoder(rr.Body).Decode(&entries)
+		if len(entries) != 2 || entries[1].Action != todo.ActionUpdated || string(entries[1].Changes["title"].New) != `"Final"` {
+			t.Errorf("expected the title change in the history, got %+v", entries)
+		}
+	})
+
+	t.Run("returns not found for unknown todos", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/todos/999/history", nil))
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+	})
+}
+
+func TestHandler_Search(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	service.CreateTodo(context.Background(), "Buy milk", "")
+	service.CreateTodo(context.Background(), "Write report", "")
+
+	t.Run("filters the list by a search query", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/todos?q=milk", nil))
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var todos []todo.Todo
+		json.NewDecoder(rr.Body).Decode(&todos)
+		if len(todos) != 1 || todos[0].Match == nil || todos[0].Match.Snippet != "Buy <mark>milk</mark>" {
+			t.Errorf("expected the matching todo with a snippet, got %+v", todos)
+		}
+	})
+
+	t.Run("rejects a query without words", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/todos?q=%3F", nil))
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestHandler_Batch(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	a, _ := service.CreateTodo(context.Background(), "A", "")
+	b, _ := service.CreateTodo(context.Background(), "B", "")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	type results struct {
+		Index   int `json:"index"`
+		Results []struct {
+			Status int        `json:"status"`
+			Todo   *todo.Todo `json:"todo"`
+		} `json:"results"`
+	}
+
+	t.Run("reports the result of each operation", func(t *testing.T) {
+		rr := do("POST", "/api/todos/batch", `{"operations": [
+			{"op": "create", "todo": {"title": "C"}},
+			{"op": "update", "id": `+strconv.FormatInt(a.ID, 10)+`, "todo": {"completed": true}}
+		]}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var got results
+		json.NewDecoder(rr.Body).Decode(&got)
+		if len(got.Results) != 2 || got.Results[0].Status != http.StatusCreated || got.Results[1].Todo == nil || !got.Results[1].Todo.Completed {
+			t.Errorf("expected a created and a completed todo, got %+v", got.Results)
+		}
+	})
+
+	t.Run("fails as a whole", func(t *testing.T) {
+		rr := do("POST", "/api/todos/batch", `{"operations": [
+			{"op": "delete", "id": `+strconv.FormatInt(b.ID, 10)+`},
+			{"op": "update", "id": 999, "todo": {"title": "X"}}
+		]}`)
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+		var got results
+		json.NewDecoder(rr.Body).Decode(&got)
+		if got.Index != 1 || len(got.Results) != 2 || got.Results[0].Status != http.StatusFailedDependency {
+			t.Errorf("expected operation 1 to fail and 0 not to be applied, got %+v", got)
+		}
+		if _, err := service.GetTodo(context.Background(), b.ID); err != nil {
+			t.Errorf("expected the delete to be rolled back, got %v", err)
+		}
+	})
+
+	t.Run("deletes completed todos", func(t *testing.T) {
+		if status := do("DELETE", "/api/todos", "").Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+		rr := do("DELETE", "/api/todos?completed=true", "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var got map[string]int
+		json.NewDecoder(rr.Body).Decode(&got)
+		if got["deleted"] != 1 {
+			t.Errorf("expected 1 todo deleted, got %v", got)
+		}
+	})
+}
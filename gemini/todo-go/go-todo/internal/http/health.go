@@ -0,0 +1,139 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// readinessTimeout bounds the dependency checks of a readiness probe.
+const readinessTimeout = 2 * time.Second
+
+// Database is the database the server needs to be ready.
+type Database interface {
+	Ping(ctx context.Context) error
+	// SchemaVersion returns the version of the last migration applied.
+	SchemaVersion(ctx context.Context) (int, error)
+}
+
+// HealthHandler serves the liveness and readiness probes and the build
+// information of the server.
+type HealthHandler struct {
+	db       Database
+	logger   *slog.Logger
+	draining atomic.Bool
+	build    buildInfo
+}
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version      string `json:"version"`
+	GoVersion    string `json:"go_version"`
+	Revision     string `json:"revision,omitempty"`
+	RevisionTime string `json:"revision_time,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+}
+
+// NewHealthHandler creates a new HTTP handler for health checks.
+func NewHealthHandler(db Database, logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		db:     db,
+		logger: logger,
+		build:  readBuildInfo(),
+	}
+}
+
+// RegisterRoutes registers the health check routes, which need no
+// authentication.
+func (h *HealthHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/healthz", h.healthz)
+	r.Get("/readyz", h.readyz)
+	r.Get("/version", h.version)
+}
+
+// Drain makes the readiness probe fail from now on, so that load balancers
+// stop sending requests before the server shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// healthz reports that the process is alive and serving requests.
+func (h *HealthHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	h.JSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether the server can serve requests: it is not shutting
+// down and its database is reachable. The response lists the outcome of
+// each check and the failing ones.
+func (h *HealthHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		h.JSON(w, r, http.StatusServiceUnavailable, map[string]string{"status": "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := struct {
+		Status        string            `json:"status"`
+		SchemaVersion int               `json:"schema_version,omitempty"`
+		Checks        map[string]string `json:"checks"`
+		Failing       []string          `json:"failing,omitempty"`
+	}{Status: "ready", Checks: map[string]string{}}
+
+	err := h.db.Ping(ctx)
+	if err == nil {
+		resp.SchemaVersion, err = h.db.SchemaVersion(ctx)
+	}
+	if err != nil {
+		logError(r, h.logger, "readiness check failed", "check", "sqlite", "error", err)
+		resp.Checks["sqlite"] = err.Error()
+		resp.Failing = append(resp.Failing, "sqlite")
+	} else {
+		resp.Checks["sqlite"] = "ok"
+	}
+
+	code := http.StatusOK
+	if len(resp.Failing) > 0 {
+		resp.Status = "not_ready"
+		code = http.StatusServiceUnavailable
+	}
+	h.JSON(w, r, code, resp)
+}
+
+// version reports the build information of the binary.
+func (h *HealthHandler) version(w http.ResponseWriter, r *http.Request) {
+	h.JSON(w, r, http.StatusOK, h.build)
+}
+
+// readBuildInfo reads the module version and the version control
+// information the Go toolchain embeds in the binary.
+func readBuildInfo() buildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return buildInfo{Version: "unknown"}
+	}
+	b := buildInfo{Version: info.Main.Version, GoVersion: info.GoVersion}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.RevisionTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// JSON writes a JSON response.
+func (h *HealthHandler) JSON(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(h.logger, w, r, code, data)
+}
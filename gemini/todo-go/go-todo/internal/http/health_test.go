@@ -0,0 +1,86 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/sqlite"
+	"github.com/go-chi/chi/v5"
+)
+
+// brokenDB is a database that cannot be reached.
+type brokenDB struct{}
+
+func (brokenDB) Ping(ctx context.Context) error { return errors.New("database is locked") }
+
+func (brokenDB) SchemaVersion(ctx context.Context) (int, error) { return 0, nil }
+
+func TestHealthHandler(t *testing.T) {
+	repo, err := sqlite.NewRepo(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatalf("failed to create repo: %v", err)
+	}
+	defer repo.Close()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	serve := func(handler *httpHandler.HealthHandler, path string) (int, map[string]interface{}) {
+		r := chi.NewRouter()
+		handler.RegisterRoutes(r)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		return rr.Code, body
+	}
+
+	t.Run("reports liveness and the build", func(t *testing.T) {
+		handler := httpHandler.NewHealthHandler(repo, logger)
+		if code, body := serve(handler, "/healthz"); code != http.StatusOK || body["status"] != "ok" {
+			t.Errorf("unexpected liveness response %v %v", code, body)
+		}
+		if code, body := serve(handler, "/version"); code != http.StatusOK || body["go_version"] == "" {
+			t.Errorf("unexpected version response %v %v", code, body)
+		}
+	})
+
+	t.Run("is ready with a reachable database", func(t *testing.T) {
+		code, body := serve(httpHandler.NewHealthHandler(repo, logger), "/readyz")
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", code, http.StatusOK)
+		}
+		if version, _ := body["schema_version"].(float64); version < 15 {
+			t.Errorf("expected the schema version, got %v", body)
+		}
+	})
+
+	t.Run("reports failing dependencies", func(t *testing.T) {
+		code, body := serve(httpHandler.NewHealthHandler(brokenDB{}, logger), "/readyz")
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("handler returned wrong status code: got %v want %v", code, http.StatusServiceUnavailable)
+		}
+		if failing, _ := body["failing"].([]interface{}); len(failing) != 1 || failing[0] != "sqlite" {
+			t.Errorf("expected sqlite to be failing, got %v", body)
+		}
+	})
+
+	t.Run("fails readiness while draining", func(t *testing.T) {
+		handler := httpHandler.NewHealthHandler(repo, logger)
+		handler.Drain()
+		if code, body := serve(handler, "/readyz"); code != http.StatusServiceUnavailable || body["status"] != "shutting_down" {
+			t.Errorf("unexpected readiness response %v %v", code, body)
+		}
+		if code, _ := serve(handler, "/healthz"); code != http.StatusOK {
+			t.Errorf("expected the server to stay live while draining, got %v", code)
+		}
+	})
+}
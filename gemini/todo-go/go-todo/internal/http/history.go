@@ -0,0 +1,30 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) todoHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	entries, err := h.service.TodoHistory(r.Context(), id)
+	if errors.Is(err, todo.ErrNotFound) {
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+		return
+	}
+	if err != nil {
+		logError(r, h.logger, "failed to get todo history", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+	h.JSON(w, r, http.StatusOK, entries)
+}
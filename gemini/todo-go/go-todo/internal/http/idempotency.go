@@ -0,0 +1,163 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/idempotency"
+)
+
+// idempotencyLock is how long a request with an Idempotency-Key may take
+// before its key is given up on and free for a retry. Reservations are left
+// behind when the server stops mid-request or fails to store a response.
+const idempotencyLock = time.Minute
+
+// maxIdempotentSize limits the size of request bodies sent with an
+// Idempotency-Key, which are read in full to fingerprint the request.
+const maxIdempotentSize = 1 << 20
+
+// Idempotency makes POST requests sent with an "Idempotency-Key" header
+// safe to retry. The first response to a key is stored for ttl, per user in
+// the request context, and replayed with an "Idempotent-Replayed: true"
+// header for retries. Reusing a key for a different request fails with 422,
+// and retrying while the first request is in progress with 409, for up to
+// a minute. Server errors are not stored, so the request can be retried.
+func Idempotency(store idempotency.Store, ttl time.Duration, logger Logger, renderer JSONer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > idempotency.MaxKeyLength {
+				renderer.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_idempotency_key", "message": "Idempotency-Key is too long"})
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentSize))
+			if err != nil {
+				renderer.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			rec := &idempotency.Record{
+				UserID:      auth.UserID(r.Context()),
+				Key:         key,
+				Fingerprint: fingerprint(r, body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+				LockedUntil: now.Add(idempotencyLock),
+			}
+			stored, err := store.Reserve(r.Context(), rec)
+			if err != nil {
+				logError(r, logger, "failed to reserve idempotency key", "error", err)
+				renderer.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+				return
+			}
+			if stored != nil {
+				replay(w, r, stored, rec.Fingerprint, renderer)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK, preset: w.Header().Clone()}
+			// The outcome is stored even if the client has gone away.
+			ctx := context.WithoutCancel(r.Context())
+			defer func() {
+				// A panic or server error leaves nothing to replay.
+				if p := recover(); p != nil {
+					release(ctx, store, rec, logger)
+					panic(p)
+				}
+				if rw.status >= 500 {
+					release(ctx, store, rec, logger)
+					return
+				}
+				rec.Status, rec.Header, rec.Body = rw.status, rw.header(), rw.body.Bytes()
+				if err := store.Complete(ctx, rec); err != nil {
+					requestLogger(ctx, logger).ErrorContext(ctx, "failed to store idempotent response", "error", err)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// replay answers a request with the response stored for its key.
+func replay(w http.ResponseWriter, r *http.Request, stored *idempotency.Record, fingerprint string, renderer JSONer) {
+	if stored.Fingerprint != fingerprint {
+		renderer.JSON(w, r, http.StatusUnprocessableEntity, map[string]string{"error": "idempotency_key_reused", "message": "Idempotency-Key was used for a different request"})
+		return
+	}
+	if !stored.Completed() {
+		w.Header().Set("Retry-After", "1")
+		renderer.JSON(w, r, http.StatusConflict, map[string]string{"error": "request_in_progress", "message": "a request with this Idempotency-Key is in progress"})
+		return
+	}
+
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+// release frees the key of a request that failed, so it can be retried.
+func release(ctx context.Context, store idempotency.Store, rec *idempotency.Record, logger Logger) {
+	if err := store.Release(ctx, rec); err != nil {
+		requestLogger(ctx, logger).ErrorContext(ctx, "failed to release idempotency key", "error", err)
+	}
+}
+
+// fingerprint identifies a request by its method, URL and body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter records the response it writes.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	// preset holds the headers set before the handler ran, which belong to
+	// the current request rather than the stored response.
+	preset      http.Header
+	wroteHeader bool
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// header returns the response headers the handler set.
+func (rw *recordingWriter) header() http.Header {
+	h := make(http.Header)
+	for name, values := range rw.Header() {
+		if _, ok := rw.preset[name]; !ok {
+			h[name] = values
+		}
+	}
+	return h
+}
@@ -0,0 +1,183 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/idempotency"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestIdempotency(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	r.Use(httpHandler.Idempotency(repo.Idempotency(), time.Hour, logger, handler))
+	handler.RegisterRoutes(r)
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/todos", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	count := func() int {
+		page, _ := service.ListTodos(context.Background(), todo.ListOptions{})
+		return len(page.Todos)
+	}
+
+	t.Run("replays the first response to a retry", func(t *testing.T) {
+		first := do("create-1", `{"title": "Once"}`)
+		if first.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", first.Code, http.StatusCreated)
+		}
+		retry := do("create-1", `{"title": "Once"}`)
+		if retry.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", retry.Code, http.StatusCreated)
+		}
+		if retry.Body.String() != first.Body.String() || retry.Header().Get("ETag") != first.Header().Get("ETag") {
+			t.Errorf("expected the first response, got %q", retry.Body.String())
+		}
+		if retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("expected the retry to be marked as replayed")
+		}
+		if n := count(); n != 1 {
+			t.Errorf("expected 1 todo, got %d", n)
+		}
+	})
+
+	t.Run("rejects reuse of a key for a different request", func(t *testing.T) {
+		if rr := do("create-1", `{"title": "Other"}`); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("scopes keys to the user", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/todos", bytes.NewBufferString(`{"title": "Once"}`))
+		req.Header.Set("Idempotency-Key", "create-1")
+		req = req.WithContext(auth.WithUserID(req.Context(), 2))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("expected a new todo for another user, got %v", rr.Code)
+		}
+	})
+
+	t.Run("performs requests without a key", func(t *testing.T) {
+		before := count()
+		do("", `{"title": "Twice"}`)
+		do("", `{"title": "Twice"}`)
+		if n := count(); n != before+2 {
+			t.Errorf("expected %d todos, got %d", before+2, n)
+		}
+	})
+
+	t.Run("replays client errors", func(t *testing.T) {
+		if rr := do("invalid", `{"title": ""}`); rr.Code != http.StatusBadRequest {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+		if rr := do("invalid", `{"title": ""}`); rr.Code != http.StatusBadRequest || rr.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("expected the validation error to be replayed, got %v", rr.Code)
+		}
+	})
+}
+
+func TestIdempotency_FailedAndConcurrentRequests(t *testing.T) {
+	repo := memory.NewRepo()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(todo.NewService(repo), logger)
+
+	calls := 0
+	started, unblock := make(chan struct{}), make(chan struct{})
+	r := chi.NewRouter()
+	r.Use(httpHandler.Idempotency(repo.Idempotency(), time.Hour, logger, handler))
+	r.Post("/fail", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	// A request outliving its lock, whose key another request takes over.
+	later := time.Now().Add(2 * time.Minute)
+	newer := &idempotency.Record{UserID: 0, Key: "key-/overtaken", Fingerprint: "newer", CreatedAt: later, ExpiresAt: later.Add(time.Hour), LockedUntil: later.Add(time.Minute)}
+	r.Post("/overtaken", func(w http.ResponseWriter, r *http.Request) {
+		if stored, err := repo.Idempotency().Reserve(r.Context(), newer); err != nil || stored != nil {
+			t.Errorf("expected the key to be taken over, got %+v, %v", stored, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Post("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-unblock
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	do := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Idempotency-Key", "key-"+path)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("performs a retry of a server error again", func(t *testing.T) {
+		do("/fail")
+		if rr := do("/fail"); rr.Code != http.StatusServiceUnavailable || calls != 2 {
+			t.Errorf("expected the request to be performed twice, got %d calls", calls)
+		}
+	})
+
+	t.Run("rejects a retry of a request in progress", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- do("/slow") }()
+		<-started
+		if rr := do("/slow"); rr.Code != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+		}
+		close(unblock)
+		if rr := <-done; rr.Code != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+		}
+		if rr := do("/slow"); rr.Code != http.StatusNoContent || rr.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("expected the completed response to be replayed, got %v", rr.Code)
+		}
+	})
+
+	t.Run("leaves a key taken over alone", func(t *testing.T) {
+		if rr := do("/overtaken"); rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+		}
+		stored, err := repo.Idempotency().Reserve(context.Background(), newer)
+		if err != nil || stored == nil || stored.Fingerprint != "newer" || stored.Completed() {
+			t.Errorf("expected the newer reservation in progress, got %+v, %v", stored, err)
+		}
+	})
+
+	t.Run("performs a retry of an abandoned request again", func(t *testing.T) {
+		// A request that never completed, as if the server had stopped.
+		past := time.Now().Add(-2 * time.Minute)
+		stale := &idempotency.Record{UserID: 0, Key: "key-/fail", Fingerprint: "stale", CreatedAt: past, ExpiresAt: past.Add(time.Hour), LockedUntil: past.Add(time.Minute)}
+		if stored, err := repo.Idempotency().Reserve(context.Background(), stale); err != nil || stored != nil {
+			t.Fatalf("expected the key to be reserved, got %+v, %v", stored, err)
+		}
+		calls = 0
+		if rr := do("/fail"); rr.Code != http.StatusServiceUnavailable || calls != 1 {
+			t.Errorf("expected the request to be performed, got status %v and %d calls", rr.Code, calls)
+		}
+	})
+}
@@ -1,11 +1,23 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // JSONer is an interface for writing JSON responses.
@@ -13,10 +25,11 @@ type JSONer interface {
 	JSON(w http.ResponseWriter, r *http.Request, code int, data interface{})
 }
 
-// Logger is an interface for logging.
+// Logger is an interface for logging. The request context is passed on
+// so that log records carry the request's trace.
 type Logger interface {
-	Error(msg string, args ...any)
-	Info(msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
 }
 
 // RequestLogger logs requests.
@@ -26,7 +39,7 @@ func RequestLogger(logger Logger) func(http.Handler) http.Handler {
 			start := time.Now()
 			ww := &responseWriter{w, http.StatusOK}
 			defer func() {
-				logger.Info("request",
+				requestLogger(r.Context(), logger).InfoContext(r.Context(), "request",
 					"method", r.Method,
 					"path", r.URL.Path,
 					"status", ww.status,
@@ -38,6 +51,65 @@ func RequestLogger(logger Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// RequestObserver records the requests served.
+type RequestObserver interface {
+	ObserveRequest(method, route string, status int, d time.Duration)
+}
+
+// Instrument records every request with the chi route pattern that served
+// it, so that requests for different todos count toward the same route.
+// Requests no route matched are recorded as "unmatched".
+func Instrument(observer RequestObserver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := &responseWriter{w, http.StatusOK}
+			defer func() {
+				observer.ObserveRequest(r.Method, routePattern(r), ww.status, time.Since(start))
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// Trace starts a server span for every request through the global tracer
+// provider, continuing the trace of the W3C traceparent header if there is
+// one. Spans are named after the method and the chi route pattern, and
+// responses with a 5xx status mark them as failed.
+func Trace() func(http.Handler) http.Handler {
+	tracer := otel.Tracer("github.com/gemini/go-todo/internal/http")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)),
+			)
+			defer span.End()
+
+			ww := &responseWriter{w, http.StatusOK}
+			defer func() {
+				route := routePattern(r)
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(ww.status))
+				if ww.status >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, http.StatusText(ww.status))
+				}
+			}()
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
+
+// routePattern returns the chi route pattern that served r, or "unmatched"
+// if no route matched.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	status int
@@ -48,13 +120,29 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Hijack lets WebSocket connections through, which need the underlying
+// connection.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap lets an http.ResponseController flush event streams through the
+// underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // PanicRecoverer recovers from panics.
 func PanicRecoverer(logger Logger, renderer JSONer) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
-					logger.Error("panic recovered", "error", err, "stack", string(debug.Stack()))
+					logError(r, logger, "panic recovered", "error", err, "stack", string(debug.Stack()))
 					renderer.JSON(w, r, http.StatusInternalServerError, map[string]string{
 						"error":   "internal_error",
 						"message": "An unexpected error occurred",
@@ -66,15 +154,93 @@ func PanicRecoverer(logger Logger, renderer JSONer) func(http.Handler) http.Hand
 	}
 }
 
-// Cors sets up CORS.
-func Cors(allowedOrigins []string) func(http.Handler) http.Handler {
-	c := cors.New(cors.Options{
+// TokenVerifier verifies bearer tokens and returns the user they belong to.
+type TokenVerifier interface {
+	Verify(token string) (int64, error)
+}
+
+// AuthOption configures Authenticate.
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	queryTokenPaths map[string]bool
+}
+
+// AllowQueryToken lets GET requests to the given paths without an
+// Authorization header pass the token as an access_token query parameter,
+// since browsers cannot set headers on EventSource and WebSocket
+// connections. It is limited to those paths because tokens in URLs end up
+// in access logs, browser history and Referer headers.
+func AllowQueryToken(paths ...string) AuthOption {
+	return func(o *authOptions) {
+		for _, p := range paths {
+			o.queryTokenPaths[p] = true
+		}
+	}
+}
+
+// Authenticate requires a valid "Authorization: Bearer <token>" header and
+// stores the token's user in the request context.
+func Authenticate(verifier TokenVerifier, renderer JSONer, opts ...AuthOption) func(http.Handler) http.Handler {
+	o := &authOptions{queryTokenPaths: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if scheme == "" && r.Method == http.MethodGet && o.queryTokenPaths[r.URL.Path] {
+				scheme, token = "Bearer", r.URL.Query().Get("access_token")
+			}
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				renderer.JSON(w, r, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+
+			userID, err := verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				renderer.JSON(w, r, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "message": "invalid or expired token"})
+				return
+			}
+
+			setRequestUser(r.Context(), userID)
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+		})
+	}
+}
+
+// Cors sets up CORS. Its allowed origins can be replaced while it is
+// serving requests.
+type Cors struct {
+	cors atomic.Pointer[cors.Cors]
+}
+
+// NewCors creates a CORS middleware allowing allowedOrigins.
+func NewCors(allowedOrigins []string) *Cors {
+	c := &Cors{}
+	c.SetAllowedOrigins(allowedOrigins)
+	return c
+}
+
+// SetAllowedOrigins replaces the allowed origins. Requests already being
+// handled keep the origins they started with.
+func (c *Cors) SetAllowedOrigins(allowedOrigins []string) {
+	c.cors.Store(cors.New(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", "Idempotency-Key", "X-Request-ID"},
+		ExposedHeaders:   []string{"Link", "ETag", "Idempotent-Replayed", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           300,
+	}))
+}
+
+// Handler is the middleware.
+func (c *Cors) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.cors.Load().Handler(next).ServeHTTP(w, r)
 	})
-	return c.Handler
 }
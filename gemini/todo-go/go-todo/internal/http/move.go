@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+// moveTodo moves a todo in the manual order between the todos with the IDs
+// given as after and before. Either may be omitted to place the todo right
+// next to the other.
+func (h *Handler) moveTodo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	var req struct {
+		After  int64 `json:"after"`
+		Before int64 `json:"before"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	var moved *todo.Todo
+	version, err := h.expectedVersion(r.Context(), r, id)
+	if err == nil {
+		moved, err = h.service.MoveTodo(r.Context(), id, version, req.After, req.Before)
+	}
+	switch {
+	case err == nil:
+		w.Header().Set("ETag", etag(moved))
+		h.JSON(w, r, http.StatusOK, moved)
+	case errors.Is(err, todo.ErrNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+	case errors.Is(err, errPreconditionFailed), errors.Is(err, todo.ErrConflict):
+		h.JSON(w, r, conflictStatus(r), map[string]string{"error": "conflict", "message": "todo has been modified"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to move todo", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
@@ -0,0 +1,446 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+var (
+	errUnsupportedPatch = errors.New("unsupported patch media type")
+	errPatchTestFailed  = errors.New("test failed")
+)
+
+// readOnlyFields are todo fields a patch may not change.
+var readOnlyFields = []string{"id", "parent_id", "position", "progress", "created_at", "updated_at", "version"}
+
+// patchableFields are todo fields a patch may set.
+var patchableFields = []string{"title", "description", "completed", "tags", "due_at", "priority", "project_id", "auto_complete", "recurrence"}
+
+// omittedFields holds the values of the patchable fields the JSON form of a
+// todo leaves out when empty. The document patches apply to has them, so a
+// JSON patch can replace or test them.
+var omittedFields = map[string]interface{}{"description": "", "project_id": float64(0)}
+
+// patchTodoDoc applies an RFC 7396 merge patch or RFC 6902 JSON patch body
+// to the JSON form of current and returns the resulting field changes.
+func patchTodoDoc(contentType string, body []byte, current *todo.Todo) (todo.Patch, error) {
+	var p todo.Patch
+
+	mediaType := ""
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return p, errUnsupportedPatch
+		}
+		mediaType = mt
+	}
+
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return p, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return p, err
+	}
+	for f, v := range omittedFields {
+		if _, ok := doc[f]; !ok {
+			doc[f] = v
+		}
+	}
+
+	var patched interface{}
+	switch mediaType {
+	case mergePatchType, "application/json", "":
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return p, fmt.Errorf("invalid merge patch: %w", err)
+		}
+		if _, ok := patch.(map[string]interface{}); !ok {
+			return p, errors.New("merge patch must be a JSON object")
+		}
+		patched = mergePatch(deepCopy(doc), patch)
+	case jsonPatchType:
+		var ops []patchOp
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return p, fmt.Errorf("invalid json patch: %w", err)
+		}
+		if patched, err = applyJSONPatch(deepCopy(doc), ops); err != nil {
+			return p, err
+		}
+	default:
+		return p, errUnsupportedPatch
+	}
+
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return p, errors.New("patch must leave the todo a JSON object")
+	}
+	return diffTodoDoc(doc, result)
+}
+
+// diffTodoDoc turns the difference between two JSON forms of a todo into a
+// todo.Patch, rejecting changes to read-only or unknown fields.
+func diffTodoDoc(before, after map[string]interface{}) (todo.Patch, error) {
+	var p todo.Patch
+
+	for _, f := range readOnlyFields {
+		if !reflect.DeepEqual(before[f], after[f]) {
+			return p, fmt.Errorf("field %q is read-only", f)
+		}
+	}
+	known := make(map[string]bool)
+	for _, f := range append(readOnlyFields, patchableFields...) {
+		known[f] = true
+	}
+	for f := range after {
+		if !known[f] {
+			return p, fmt.Errorf("unknown field %q", f)
+		}
+	}
+
+	raw, err := json.Marshal(after)
+	if err != nil {
+		return p, err
+	}
+	var fields struct {
+		Title        string           `json:"title"`
+		Description  string           `json:"description"`
+		Completed    bool             `json:"completed"`
+		Tags         []string         `json:"tags"`
+		DueAt        *time.Time       `json:"due_at"`
+		Priority     int              `json:"priority"`
+		ProjectID    int64            `json:"project_id"`
+		AutoComplete bool             `json:"auto_complete"`
+		Recurrence   *todo.Recurrence `json:"recurrence"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return p, fmt.Errorf("invalid field value: %w", err)
+	}
+
+	if !reflect.DeepEqual(before["title"], after["title"]) {
+		p.Title = &fields.Title
+	}
+	if !reflect.DeepEqual(before["description"], after["description"]) {
+		p.Description = &fields.Description
+	}
+	if !reflect.DeepEqual(before["completed"], after["completed"]) {
+		p.Completed = &fields.Completed
+	}
+	if !reflect.DeepEqual(before["tags"], after["tags"]) {
+		if fields.Tags == nil {
+			fields.Tags = []string{}
+		}
+		p.Tags = &fields.Tags
+	}
+	if !reflect.DeepEqual(before["due_at"], after["due_at"]) {
+		p.DueAt = fields.DueAt
+		p.ClearDueAt = fields.DueAt == nil
+	}
+	if !reflect.DeepEqual(before["priority"], after["priority"]) {
+		p.Priority = &fields.Priority
+	}
+	if !reflect.DeepEqual(before["project_id"], after["project_id"]) {
+		p.ProjectID = &fields.ProjectID
+	}
+	if !reflect.DeepEqual(before["auto_complete"], after["auto_complete"]) {
+		p.AutoComplete = &fields.AutoComplete
+	}
+	if !reflect.DeepEqual(before["recurrence"], after["recurrence"]) {
+		p.Recurrence = fields.Recurrence
+		p.ClearRecurrence = fields.Recurrence == nil
+	}
+	return p, nil
+}
+
+// mergePatch applies an RFC 7396 merge patch to target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+type patchOp struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies an RFC 6902 JSON patch to doc. Operations are
+// applied in order and the first failure aborts the whole patch.
+func applyJSONPatch(doc interface{}, ops []patchOp) (interface{}, error) {
+	var err error
+	for i, op := range ops {
+		if doc, err = applyPatchOp(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op patchOp) (interface{}, error) {
+	value := func() (interface{}, error) {
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		var v interface{}
+		err := json.Unmarshal(*op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "remove":
+		doc, _, err := pointerRemove(doc, op.Path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err = pointerRemove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "move":
+		if op.From != op.Path && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, v, err := pointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "copy":
+		v, err := pointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, deepCopy(v))
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := pointerGet(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, errPatchTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, n int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > n || (!allowEnd && i == n) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, ptr string) (interface{}, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", ptr)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", ptr)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd inserts v at ptr and returns the (possibly new) document root.
+func pointerAdd(doc interface{}, ptr string, v interface{}) (interface{}, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return v, nil
+	}
+	return addAt(doc, tokens, v)
+}
+
+func addAt(node interface{}, tokens []string, v interface{}) (interface{}, error) {
+	t := tokens[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(tokens) == 1 {
+			n[t] = v
+			return n, nil
+		}
+		child, ok := n[t]
+		if !ok {
+			return nil, fmt.Errorf("path segment %q does not exist", t)
+		}
+		c, err := addAt(child, tokens[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		n[t] = c
+		return n, nil
+	case []interface{}:
+		if len(tokens) == 1 {
+			i, err := arrayIndex(t, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = v
+			return n, nil
+		}
+		i, err := arrayIndex(t, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		c, err := addAt(n[i], tokens[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = c
+		return n, nil
+	}
+	return nil, fmt.Errorf("path segment %q does not exist", t)
+}
+
+// pointerRemove deletes the value at ptr, returning the new root and the
+// removed value.
+func pointerRemove(doc interface{}, ptr string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	return removeAt(doc, tokens)
+}
+
+func removeAt(node interface{}, tokens []string) (interface{}, interface{}, error) {
+	t := tokens[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[t]
+		if !ok {
+			return nil, nil, fmt.Errorf("path segment %q does not exist", t)
+		}
+		if len(tokens) == 1 {
+			delete(n, t)
+			return n, child, nil
+		}
+		c, removed, err := removeAt(child, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[t] = c
+		return n, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(t, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tokens) == 1 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		c, removed, err := removeAt(n[i], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = c
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("path segment %q does not exist", t)
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, e := range n {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, e := range n {
+			s[i] = deepCopy(e)
+		}
+		return s
+	}
+	return v
+}
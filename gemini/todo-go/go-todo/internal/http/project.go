@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) listProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := h.service.ListProjects(r.Context())
+	if err != nil {
+		logError(r, h.logger, "failed to list projects", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+	h.JSON(w, r, http.StatusOK, projects)
+}
+
+func (h *Handler) createProject(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	project, err := h.service.CreateProject(r.Context(), req.Name)
+	switch {
+	case err == nil:
+		h.JSON(w, r, http.StatusCreated, project)
+	case errors.Is(err, todo.ErrProjectExists):
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "project_exists", "message": "project already exists"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to create project", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+func (h *Handler) getProject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	project, err := h.service.GetProject(r.Context(), id)
+	switch {
+	case err == nil:
+		h.JSON(w, r, http.StatusOK, project)
+	case errors.Is(err, todo.ErrProjectNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "project not found"})
+	default:
+		logError(r, h.logger, "failed to get project", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+// updateProject renames, archives or unarchives a project. Fields missing
+// from the body are left unchanged.
+func (h *Handler) updateProject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	var req struct {
+		Name     *string `json:"name"`
+		Archived *bool   `json:"archived"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	project, err := h.service.UpdateProject(r.Context(), id, todo.ProjectPatch{Name: req.Name, Archived: req.Archived})
+	switch {
+	case err == nil:
+		h.JSON(w, r, http.StatusOK, project)
+	case errors.Is(err, todo.ErrProjectNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "project not found"})
+	case errors.Is(err, todo.ErrProjectExists):
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "project_exists", "message": "project already exists"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to update project", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+func (h *Handler) deleteProject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	err = h.service.DeleteProject(r.Context(), id)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, todo.ErrProjectNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "project not found"})
+	default:
+		logError(r, h.logger, "failed to delete project", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
@@ -0,0 +1,129 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandler_Projects(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/api/projects", "application/json", `{"name": "Garden"}`)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var project todo.Project
+	json.NewDecoder(rr.Body).Decode(&project)
+	projectPath := "/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	rr = do("POST", "/api/todos", "application/json", `{"title": "Mow", "project_id": `+strconv.FormatInt(project.ID, 10)+`}`)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var mow todo.Todo
+	json.NewDecoder(rr.Body).Decode(&mow)
+	do("POST", "/api/todos", "application/json", `{"title": "Call mum"}`)
+
+	list := func(query string) []todo.Todo {
+		t.Helper()
+		rr := do("GET", "/api/todos?"+query, "", "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var todos []todo.Todo
+		json.NewDecoder(rr.Body).Decode(&todos)
+		return todos
+	}
+
+	t.Run("validates projects", func(t *testing.T) {
+		if status := do("POST", "/api/projects", "application/json", `{"name": "Garden"}`).Code; status != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+		}
+		if status := do("POST", "/api/projects", "application/json", `{"name": " "}`).Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+		rr := do("POST", "/api/todos", "application/json", `{"title": "Lost", "project_id": 999}`)
+		var body struct {
+			Details map[string]string `json:"details"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		if _, ok := body.Details["project_id"]; rr.Code != http.StatusBadRequest || !ok {
+			t.Errorf("expected a validation error for project_id, got %v %v", rr.Code, body.Details)
+		}
+	})
+
+	t.Run("filters by project", func(t *testing.T) {
+		if todos := list("project_id=" + strconv.FormatInt(project.ID, 10)); len(todos) != 1 || todos[0].ID != mow.ID {
+			t.Errorf("expected only %q, got %+v", "Mow", todos)
+		}
+		if todos := list("project_id=0"); len(todos) != 1 || todos[0].Title != "Call mum" {
+			t.Errorf("expected only %q, got %+v", "Call mum", todos)
+		}
+		if status := do("GET", "/api/todos?project_id=garden", "", "").Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("archives a project", func(t *testing.T) {
+		rr := do("PATCH", projectPath, "application/json", `{"archived": true}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if todos := list(""); len(todos) != 1 {
+			t.Errorf("expected 1 todo outside the archived project, got %d", len(todos))
+		}
+		if todos := list("include_archived=true"); len(todos) != 2 {
+			t.Errorf("expected 2 todos including archived ones, got %d", len(todos))
+		}
+		do("PATCH", projectPath, "application/json", `{"archived": false}`)
+		if todos := list(""); len(todos) != 2 {
+			t.Errorf("expected 2 todos after unarchiving, got %d", len(todos))
+		}
+	})
+
+	t.Run("moves a todo out of its project with a merge patch", func(t *testing.T) {
+		rr := do("PATCH", "/api/todos/"+strconv.FormatInt(mow.ID, 10), "application/merge-patch+json", `{"project_id": null}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.ProjectID != 0 {
+			t.Errorf("expected no project, got %d", updated.ProjectID)
+		}
+	})
+
+	t.Run("deletes a project", func(t *testing.T) {
+		if status := do("DELETE", projectPath, "", "").Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+		}
+		if status := do("GET", projectPath, "", "").Code; status != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+	})
+}
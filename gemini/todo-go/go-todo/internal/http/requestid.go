@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gemini/go-todo/pkg/logger"
+	"github.com/go-chi/chi/v5"
+)
+
+// RequestIDHeader carries the ID of a request, which clients may set and
+// which every response echoes.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// requestInfo describes a request to its log records. The route and user
+// are only known once the request has been routed and authenticated, so
+// they are read when a record is logged.
+type requestInfo struct {
+	id     string
+	rctx   *chi.Context
+	userID atomic.Int64
+}
+
+type requestInfoKey struct{}
+
+// RequestID assigns every request an ID, taken from its X-Request-ID header
+// if that holds 1 to 128 printable characters and generated otherwise, and
+// sets the header on the response. It stores a logger in the request
+// context, which pkg/logger.FromContext returns, that adds the request ID,
+// route pattern and authenticated user to every record.
+func RequestID(base *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			info := &requestInfo{id: id, rctx: chi.RouteContext(r.Context())}
+			ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+			ctx = logger.NewContext(ctx, slog.New(requestHandler{base.Handler(), info}))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// setRequestUser records the authenticated user of the request in ctx.
+func setRequestUser(ctx context.Context, userID int64) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userID.Store(userID)
+	}
+}
+
+// requestLogger returns the logger RequestID stored in ctx, or fallback for
+// requests that did not pass through RequestID.
+func requestLogger(ctx context.Context, fallback Logger) Logger {
+	if _, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return logger.FromContext(ctx)
+	}
+	return fallback
+}
+
+// logError logs an error while handling r.
+func logError(r *http.Request, fallback Logger, msg string, args ...any) {
+	requestLogger(r.Context(), fallback).ErrorContext(r.Context(), msg, args...)
+}
+
+// requestHandler adds the request ID, route pattern and user to records.
+type requestHandler struct {
+	slog.Handler
+	info *requestInfo
+}
+
+func (h requestHandler) Handle(ctx context.Context, rec slog.Record) error {
+	rec.AddAttrs(slog.String("request_id", h.info.id))
+	if h.info.rctx != nil && h.info.rctx.RoutePattern() != "" {
+		rec.AddAttrs(slog.String("route", h.info.rctx.RoutePattern()))
+	}
+	if id := h.info.userID.Load(); id != 0 {
+		rec.AddAttrs(slog.Int64("user_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs), h.info}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name), h.info}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
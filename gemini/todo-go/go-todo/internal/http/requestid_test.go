@@ -0,0 +1,90 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/pkg/logger"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewJSONHandler(&buf, nil))
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+	handler := httpHandler.NewHandler(todo.NewService(memory.NewRepo()), base)
+
+	r := chi.NewRouter()
+	r.Use(httpHandler.RequestID(base))
+	r.Use(httpHandler.RequestLogger(base))
+	r.Group(func(r chi.Router) {
+		r.Use(httpHandler.Authenticate(tokens, handler))
+		r.Get("/api/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Info("handling")
+		})
+	})
+
+	token, _, err := tokens.Issue(7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	do := func(requestID string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/api/things/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if requestID != "" {
+			req.Header.Set(httpHandler.RequestIDHeader, requestID)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		var records []map[string]interface{}
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var rec map[string]interface{}
+			if err := dec.Decode(&rec); err != nil {
+				t.Fatalf("could not decode log record: %v", err)
+			}
+			records = append(records, rec)
+		}
+		return rr, records
+	}
+
+	t.Run("honours the inbound request ID", func(t *testing.T) {
+		rr, records := do("abc-123")
+		if got := rr.Header().Get(httpHandler.RequestIDHeader); got != "abc-123" {
+			t.Errorf("expected request ID %q, got %q", "abc-123", got)
+		}
+		if len(records) != 2 {
+			t.Fatalf("expected 2 log records, got %d", len(records))
+		}
+		for _, rec := range records {
+			if rec["request_id"] != "abc-123" || rec["route"] != "/api/things/{id}" || rec["user_id"] != float64(7) {
+				t.Errorf("expected the request ID, route and user in %v", rec)
+			}
+		}
+	})
+
+	t.Run("generates missing and invalid request IDs", func(t *testing.T) {
+		for _, id := range []string{"", "has spaces", strings.Repeat("x", 129)} {
+			rr, records := do(id)
+			got := rr.Header().Get(httpHandler.RequestIDHeader)
+			if got == "" || got == id {
+				t.Errorf("expected a generated request ID for %q, got %q", id, got)
+			}
+			if len(records) == 0 || records[0]["request_id"] != got {
+				t.Errorf("expected records with request ID %q, got %v", got, records)
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) listSubtasks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	subtasks, err := h.service.ListSubtasks(r.Context(), id)
+	if errors.Is(err, todo.ErrNotFound) {
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+		return
+	}
+	if err != nil {
+		logError(r, h.logger, "failed to list subtasks", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+	h.JSON(w, r, http.StatusOK, subtasks)
+}
+
+func (h *Handler) createSubtask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	subtask, err := h.service.CreateSubtask(r.Context(), id, req.patch())
+	switch {
+	case err == nil:
+		w.Header().Set("ETag", etag(subtask))
+		h.JSON(w, r, http.StatusCreated, subtask)
+	case errors.Is(err, todo.ErrNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not found"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to create subtask", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
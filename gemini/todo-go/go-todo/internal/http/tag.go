@@ -0,0 +1,84 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) listTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.service.ListTags(r.Context())
+	if err != nil {
+		logError(r, h.logger, "failed to list tags", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+	h.JSON(w, r, http.StatusOK, tags)
+}
+
+func (h *Handler) createTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	tag, err := h.service.CreateTag(r.Context(), req.Name)
+	switch {
+	case err == nil:
+		h.JSON(w, r, http.StatusCreated, tag)
+	case errors.Is(err, todo.ErrTagExists):
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "tag_exists", "message": "tag already exists"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to create tag", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+func (h *Handler) renameTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	err := h.service.RenameTag(r.Context(), chi.URLParam(r, "name"), req.Name)
+	switch {
+	case err == nil:
+		name, _ := todo.NormalizeTag(req.Name)
+		h.JSON(w, r, http.StatusOK, todo.Tag{Name: name})
+	case errors.Is(err, todo.ErrTagNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "tag not found"})
+	case errors.Is(err, todo.ErrTagExists):
+		h.JSON(w, r, http.StatusConflict, map[string]string{"error": "tag_exists", "message": "tag already exists"})
+	case errors.Is(err, todo.ErrInvalid):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": validationDetails(err)})
+	default:
+		logError(r, h.logger, "failed to rename tag", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+func (h *Handler) deleteTag(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteTag(r.Context(), chi.URLParam(r, "name"))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, todo.ErrTagNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "tag not found"})
+	default:
+		logError(r, h.logger, "failed to delete tag", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
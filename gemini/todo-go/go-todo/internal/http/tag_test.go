@@ -0,0 +1,122 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandler_Tags(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/api/todos", `{"title": "Both", "tags": ["Home", "errand"]}`)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var both todo.Todo
+	json.NewDecoder(rr.Body).Decode(&both)
+	do("POST", "/api/todos", `{"title": "Home", "tags": ["home"]}`)
+	do("POST", "/api/todos", `{"title": "Untagged"}`)
+
+	list := func(query string) []todo.Todo {
+		t.Helper()
+		rr := do("GET", "/api/todos?"+query, "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var todos []todo.Todo
+		json.NewDecoder(rr.Body).Decode(&todos)
+		return todos
+	}
+
+	t.Run("filters by tag", func(t *testing.T) {
+		if todos := list("tag=home"); len(todos) != 2 {
+			t.Errorf("expected 2 todos, got %d", len(todos))
+		}
+		if todos := list("tag=home&tag=errand&tag_mode=all"); len(todos) != 1 || todos[0].Title != "Both" {
+			t.Errorf("expected only %q, got %+v", "Both", todos)
+		}
+	})
+
+	t.Run("rejects an invalid tag", func(t *testing.T) {
+		rr := do("POST", "/api/todos", `{"title": "Bad", "tags": ["a,b"]}`)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+		var body struct {
+			Details map[string]string `json:"details"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		if _, ok := body.Details["tags"]; !ok {
+			t.Errorf("expected details for tags, got %v", body.Details)
+		}
+	})
+
+	t.Run("keeps tags on a PUT without tags", func(t *testing.T) {
+		rr := do("PUT", "/api/todos/"+strconv.FormatInt(both.ID, 10), `{"title": "Both again"}`)
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if len(updated.Tags) != 2 {
+			t.Errorf("expected tags to be kept, got %v", updated.Tags)
+		}
+	})
+
+	t.Run("patches tags", func(t *testing.T) {
+		req := httptest.NewRequest("PATCH", "/api/todos/"+strconv.FormatInt(both.ID, 10),
+			bytes.NewBufferString(`[{"op": "add", "path": "/tags/-", "value": "later"}]`))
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		var updated todo.Todo
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if len(updated.Tags) != 3 {
+			t.Errorf("expected 3 tags, got %v", updated.Tags)
+		}
+	})
+
+	t.Run("manages tags", func(t *testing.T) {
+		if status := do("POST", "/api/tags", `{"name": "home"}`).Code; status != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+		}
+		if status := do("PUT", "/api/tags/home", `{"name": "house"}`).Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if status := do("DELETE", "/api/tags/errand", "").Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+		}
+		if status := do("DELETE", "/api/tags/errand", "").Code; status != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+
+		var tags []todo.Tag
+		json.NewDecoder(do("GET", "/api/tags", "").Body).Decode(&tags)
+		if len(tags) != 2 || tags[0] != (todo.Tag{Name: "house", Count: 2}) || tags[1] != (todo.Tag{Name: "later", Count: 1}) {
+			t.Errorf("unexpected tags %+v", tags)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/sqlite"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTrace(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	tp := tracing.Install(exp)
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+
+	repo, err := sqlite.NewRepo(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatalf("failed to create repo: %v", err)
+	}
+	defer repo.Close()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	service := todo.NewService(repo)
+	handler := httpHandler.NewHandler(service, logger)
+
+	r := chi.NewRouter()
+	r.Use(httpHandler.Trace())
+	handler.RegisterRoutes(r)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/api/todos", bytes.NewBufferString(`{"title": "Traced"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	spans := exp.GetSpans()
+	names := make(map[string]bool)
+	for _, span := range spans {
+		names[span.Name] = true
+		if got := span.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("expected span %q to continue trace %s, got %s", span.Name, traceID, got)
+		}
+	}
+	for _, want := range []string{"POST /api/todos", "todo.Service.CreateTodoWith", "sqlite transaction", "INSERT"} {
+		if !names[want] {
+			t.Errorf("expected a span named %q, got %v", want, names)
+		}
+	}
+
+	t.Run("opens one span per service call", func(t *testing.T) {
+		exp.Reset()
+		created, err := service.CreateTodo(context.Background(), "Traced", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.UpdateTodo(context.Background(), created.ID, "Traced", "", true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, span := range exp.GetSpans() {
+			if strings.HasPrefix(span.Name, "todo.Service.") {
+				names = append(names, span.Name)
+			}
+		}
+		if got := strings.Join(names, " "); got != "todo.Service.CreateTodo todo.Service.UpdateTodo" {
+			t.Errorf("unexpected service spans %q", got)
+		}
+	})
+
+	t.Run("marks failed lookups", func(t *testing.T) {
+		exp.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/todos/999", nil))
+		for _, span := range exp.GetSpans() {
+			if span.Name == "todo.Service.GetTodo" {
+				if span.Status.Code != codes.Error {
+					t.Errorf("expected the span to record the error, got %+v", span.Status)
+				}
+				return
+			}
+		}
+		t.Errorf("expected a span for the service call")
+	})
+}
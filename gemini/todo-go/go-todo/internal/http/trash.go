@@ -0,0 +1,47 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+)
+
+// listTrash lists deleted todos. It accepts the filters, ordering and
+// pagination parameters of the todo listing, and includes the todos of
+// archived projects.
+func (h *Handler) listTrash(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_query_param", "message": err.Error()})
+		return
+	}
+	// Subtasks deleted on their own are listed too. Those deleted together
+	// with their parent are restored with it and left out.
+	opts.ParentID = nil
+	opts.Trashed = true
+	opts.IncludeArchived = true
+	h.listPage(w, r, opts)
+}
+
+func (h *Handler) restoreTodo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return
+	}
+
+	restored, err := h.service.RestoreTodo(r.Context(), id)
+	switch {
+	case err == nil:
+		w.Header().Set("ETag", etag(restored))
+		h.JSON(w, r, http.StatusOK, restored)
+	case errors.Is(err, todo.ErrNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "todo not in trash"})
+	default:
+		logError(r, h.logger, "failed to restore todo", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gemini/go-todo/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// WebhookService defines the interface for managing webhook subscriptions.
+type WebhookService interface {
+	ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error)
+	CreateSubscription(ctx context.Context, url string, events []string) (*webhook.Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*webhook.Subscription, error)
+	UpdateSubscription(ctx context.Context, id int64, p webhook.Patch) (*webhook.Subscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	ListAttempts(ctx context.Context, id int64, limit int) ([]webhook.Attempt, error)
+}
+
+// WebhookHandler handles HTTP requests for webhook subscriptions.
+type WebhookHandler struct {
+	service WebhookService
+	logger  *slog.Logger
+}
+
+// NewWebhookHandler creates a new HTTP handler for webhook subscriptions.
+func NewWebhookHandler(service WebhookService, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes registers the webhook routes.
+func (h *WebhookHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/api/webhooks", func(r chi.Router) {
+		r.Get("/", h.list)
+		r.Post("/", h.create)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", h.get)
+			r.Patch("/", h.update)
+			r.Delete("/", h.delete)
+			r.Get("/deliveries", h.deliveries)
+		})
+	})
+}
+
+func (h *WebhookHandler) list(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.service.ListSubscriptions(r.Context())
+	if err != nil {
+		logError(r, h.logger, "failed to list webhooks", "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+		return
+	}
+	h.JSON(w, r, http.StatusOK, subs)
+}
+
+// create subscribes a URL. The response is the only one carrying the
+// subscription's signing secret.
+func (h *WebhookHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	sub, err := h.service.CreateSubscription(r.Context(), req.URL, req.Events)
+	h.respond(w, r, http.StatusCreated, sub, err, "failed to create webhook")
+}
+
+func (h *WebhookHandler) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetSubscription(r.Context(), id)
+	h.respond(w, r, http.StatusOK, sub, err, "failed to get webhook")
+}
+
+// update changes the URL, event types or active state of a subscription.
+// Fields missing from the body are left unchanged.
+func (h *WebhookHandler) update(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL    *string   `json:"url"`
+		Events *[]string `json:"events"`
+		Active *bool     `json:"active"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	sub, err := h.service.UpdateSubscription(r.Context(), id, webhook.Patch{URL: req.URL, Events: req.Events, Active: req.Active})
+	h.respond(w, r, http.StatusOK, sub, err, "failed to update webhook")
+}
+
+func (h *WebhookHandler) delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.DeleteSubscription(r.Context(), id)
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.respond(w, r, http.StatusNoContent, nil, err, "failed to delete webhook")
+}
+
+// deliveries returns the delivery log of a subscription, newest first.
+func (h *WebhookHandler) deliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+
+	limit := webhook.MaxLogEntries
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > webhook.MaxLogEntries {
+			h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"limit": "must be between 1 and " + strconv.Itoa(webhook.MaxLogEntries)}})
+			return
+		}
+		limit = n
+	}
+
+	attempts, err := h.service.ListAttempts(r.Context(), id, limit)
+	h.respond(w, r, http.StatusOK, attempts, err, "failed to list webhook deliveries")
+}
+
+func (h *WebhookHandler) id(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.JSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid_id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respond writes data with the given status code, or the response matching
+// err.
+func (h *WebhookHandler) respond(w http.ResponseWriter, r *http.Request, code int, data interface{}, err error, msg string) {
+	switch {
+	case err == nil:
+		h.JSON(w, r, code, data)
+	case errors.Is(err, webhook.ErrNotFound):
+		h.JSON(w, r, http.StatusNotFound, map[string]string{"error": "not_found", "message": "webhook not found"})
+	case errors.Is(err, webhook.ErrInvalidURL):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"url": "must be an absolute http or https URL"}})
+	case errors.Is(err, webhook.ErrUnknownEvent):
+		h.JSON(w, r, http.StatusBadRequest, map[string]interface{}{"error": "validation_error", "details": map[string]string{"events": "must be some of " + strings.Join(webhook.EventTypes(), ", ")}})
+	default:
+		logError(r, h.logger, msg, "error", err)
+		h.JSON(w, r, http.StatusInternalServerError, map[string]string{"error": "internal_error"})
+	}
+}
+
+// JSON writes a JSON response.
+func (h *WebhookHandler) JSON(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	writeJSON(h.logger, w, r, code, data)
+}
@@ -0,0 +1,123 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	repo := memory.NewRepo()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := httpHandler.NewWebhookHandler(webhook.NewService(repo.Webhooks()), logger)
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/api/webhooks", `{"url": "https://example.com/hook", "events": ["created", "deleted"]}`)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var created webhook.Subscription
+	json.NewDecoder(rr.Body).Decode(&created)
+	if created.Secret == "" || !created.Active || len(created.Events) != 2 {
+		t.Errorf("unexpected subscription %+v", created)
+	}
+	path := "/api/webhooks/" + strconv.FormatInt(created.ID, 10)
+
+	t.Run("validates subscriptions", func(t *testing.T) {
+		for body, field := range map[string]string{
+			`{"url": "ftp://example.com"}`:                         "url",
+			`{"url": "https://example.com", "events": ["opened"]}`: "events",
+		} {
+			rr := do("POST", "/api/webhooks", body)
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+			}
+			var resp struct {
+				Details map[string]string `json:"details"`
+			}
+			json.NewDecoder(rr.Body).Decode(&resp)
+			if _, ok := resp.Details[field]; !ok {
+				t.Errorf("expected details for %s, got %v", field, resp.Details)
+			}
+		}
+	})
+
+	t.Run("hides the secret after creation", func(t *testing.T) {
+		rr := do("GET", path, "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var got map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&got)
+		if _, ok := got["secret"]; ok {
+			t.Errorf("expected no secret, got %v", got)
+		}
+
+		rr = do("GET", "/api/webhooks", "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var list []map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&list)
+		if len(list) != 1 {
+			t.Fatalf("expected 1 subscription, got %v", list)
+		}
+		if _, ok := list[0]["secret"]; ok {
+			t.Errorf("expected no secret in the list, got %v", list[0])
+		}
+	})
+
+	t.Run("updates a subscription", func(t *testing.T) {
+		rr := do("PATCH", path, `{"active": false}`)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var updated webhook.Subscription
+		json.NewDecoder(rr.Body).Decode(&updated)
+		if updated.Active || updated.URL != created.URL || len(updated.Events) != 2 {
+			t.Errorf("unexpected subscription %+v", updated)
+		}
+	})
+
+	t.Run("lists deliveries", func(t *testing.T) {
+		rr := do("GET", path+"/deliveries", "")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if body := rr.Body.String(); body != "[]\n" {
+			t.Errorf("expected an empty log, got %s", body)
+		}
+		if status := do("GET", path+"/deliveries?limit=0", "").Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("deletes a subscription", func(t *testing.T) {
+		if status := do("DELETE", path, "").Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+		}
+		if status := do("GET", path, "").Code; status != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+		}
+	})
+}
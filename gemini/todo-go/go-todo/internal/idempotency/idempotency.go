@@ -0,0 +1,67 @@
+// Package idempotency stores the responses to requests made with an
+// Idempotency-Key, so that retries of a request are answered with the
+// response to the first attempt instead of being performed again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// MaxKeyLength is the length of the longest key accepted.
+const MaxKeyLength = 255
+
+// ErrNotFound is returned when a client has no record for a key.
+var ErrNotFound = errors.New("idempotency key not found")
+
+// Record is what is kept of the first request a client made with a key.
+type Record struct {
+	UserID int64
+	Key    string
+	// Fingerprint identifies the request, so the key cannot be reused for
+	// a different one.
+	Fingerprint string
+	// Status, Header and Body hold the response. Status is 0 while the
+	// request is in progress.
+	Status    int
+	Header    http.Header
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// LockedUntil is when a request in progress is given up on, because
+	// the server stopped or failed to store its response. The key is then
+	// free to be reserved again.
+	LockedUntil time.Time
+}
+
+// Completed reports whether the response to the request has been stored.
+func (r *Record) Completed() bool {
+	return r.Status != 0
+}
+
+// Abandoned reports whether the request is still in progress at the given
+// time although its lock has expired.
+func (r *Record) Abandoned(at time.Time) bool {
+	return !r.Completed() && !r.LockedUntil.After(at)
+}
+
+// Store stores idempotency records. Records are scoped to a client, and
+// expired records behave as if they did not exist.
+type Store interface {
+	// Reserve stores rec for a request in progress, unless the client has
+	// an unexpired record for the key already, which it returns instead.
+	// It returns nil if it stored rec. Records expire, and abandoned
+	// records are replaced, relative to rec.CreatedAt.
+	Reserve(ctx context.Context, rec *Record) (*Record, error)
+	// Complete stores the response to the request that reserved a key
+	// with rec. Reservations are told apart by their CreatedAt, and
+	// Complete returns ErrNotFound if the reservation is gone because it
+	// expired or another request took over the abandoned key.
+	Complete(ctx context.Context, rec *Record) error
+	// Release deletes the reservation made with rec, so that a retry
+	// performs the request again. Like Complete, it returns ErrNotFound if
+	// the reservation is gone.
+	Release(ctx context.Context, rec *Record) error
+}
@@ -0,0 +1,90 @@
+// Package metrics collects Prometheus metrics about HTTP requests,
+// repository operations, the database connection pool and the Go runtime.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the application's collectors in a registry of its own.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	repoDuration    *prometheus.HistogramVec
+}
+
+// New creates the collectors and registers them, along with the Go runtime
+// and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_operation_duration_seconds",
+			Help:    "Todo repository operation latency by operation and outcome.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation", "outcome"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.repoDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RegisterDB collects the connection pool statistics of db, labelled with
+// the database name.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRequest records a request served for the given route pattern.
+func (m *Metrics) ObserveRequest(method, route string, status int, d time.Duration) {
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(d.Seconds())
+}
+
+// observeRepo records a repository operation that started at start and
+// returned *errp, and is meant to be deferred. Errors the service expects,
+// such as missing todos and version conflicts, are not failures of the
+// repository and are counted apart from them.
+func (m *Metrics) observeRepo(op string, start time.Time, errp *error) {
+	outcome := "ok"
+	switch err := *errp; {
+	case err == nil:
+	case errors.Is(err, todo.ErrNotFound), errors.Is(err, todo.ErrConflict),
+		errors.Is(err, todo.ErrProjectNotFound), errors.Is(err, todo.ErrProjectExists),
+		errors.Is(err, todo.ErrTagNotFound), errors.Is(err, todo.ErrTagExists),
+		errors.Is(err, todo.ErrInvalid), errors.Is(err, todo.ErrInvalidCursor):
+		outcome = "rejected"
+	default:
+		outcome = "error"
+	}
+	m.repoDuration.WithLabelValues(op, outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	httpHandler "github.com/gemini/go-todo/internal/http"
+	"github.com/gemini/go-todo/internal/metrics"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/go-chi/chi/v5"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	m.RegisterDB("todos", db)
+
+	service := todo.NewService(m.InstrumentRepo(memory.NewRepo()))
+	created, err := service.CreateTodo(context.Background(), "Measure", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetTodo(context.Background(), created.ID+1); err == nil {
+		t.Fatal("expected an error for a missing todo")
+	}
+
+	r := chi.NewRouter()
+	r.Use(httpHandler.Instrument(m))
+	r.Get("/api/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Method(http.MethodGet, "/metrics", m.Handler())
+
+	for _, path := range []string{"/api/todos/1", "/api/todos/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	body, _ := io.ReadAll(rr.Body)
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/api/todos/{id}",status="404"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/api/todos/{id}"} 2`,
+		`repository_operation_duration_seconds_count{operation="create",outcome="ok"} 1`,
+		`repository_operation_duration_seconds_count{operation="tx",outcome="ok"} 1`,
+		`repository_operation_duration_seconds_count{operation="find_by_id",outcome="rejected"} 1`,
+		`go_sql_open_connections{db_name="todos"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+}
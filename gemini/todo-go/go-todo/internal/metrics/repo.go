@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// Repo is a todo.Repository that times the operations of the repository it
+// wraps, including those run in its transactions.
+type Repo struct {
+	repo    todo.Repository
+	metrics *Metrics
+}
+
+// InstrumentRepo wraps repo to record the duration of its operations.
+func (m *Metrics) InstrumentRepo(repo todo.Repository) *Repo {
+	return &Repo{repo: repo, metrics: m}
+}
+
+// WithTx times the whole transaction as well as each operation in it.
+func (r *Repo) WithTx(ctx context.Context, fn func(repo todo.Repository) error) (err error) {
+	defer r.metrics.observeRepo("tx", time.Now(), &err)
+	return r.repo.WithTx(ctx, func(tx todo.Repository) error {
+		return fn(&Repo{repo: tx, metrics: r.metrics})
+	})
+}
+
+func (r *Repo) Create(ctx context.Context, t *todo.Todo) (err error) {
+	defer r.metrics.observeRepo("create", time.Now(), &err)
+	return r.repo.Create(ctx, t)
+}
+
+func (r *Repo) FindAll(ctx context.Context, opts todo.ListOptions) (_ []*todo.Todo, err error) {
+	defer r.metrics.observeRepo("find_all", time.Now(), &err)
+	return r.repo.FindAll(ctx, opts)
+}
+
+func (r *Repo) FindByID(ctx context.Context, ownerID, id int64) (_ *todo.Todo, err error) {
+	defer r.metrics.observeRepo("find_by_id", time.Now(), &err)
+	return r.repo.FindByID(ctx, ownerID, id)
+}
+
+func (r *Repo) Update(ctx context.Context, t *todo.Todo) (err error) {
+	defer r.metrics.observeRepo("update", time.Now(), &err)
+	return r.repo.Update(ctx, t)
+}
+
+func (r *Repo) Delete(ctx context.Context, ownerID, id, version int64, at time.Time) (err error) {
+	defer r.metrics.observeRepo("delete", time.Now(), &err)
+	return r.repo.Delete(ctx, ownerID, id, version, at)
+}
+
+func (r *Repo) Restore(ctx context.Context, ownerID, id int64, at time.Time) (err error) {
+	defer r.metrics.observeRepo("restore", time.Now(), &err)
+	return r.repo.Restore(ctx, ownerID, id, at)
+}
+
+func (r *Repo) Purge(ctx context.Context, before time.Time) (_ int64, err error) {
+	defer r.metrics.observeRepo("purge", time.Now(), &err)
+	return r.repo.Purge(ctx, before)
+}
+
+func (r *Repo) Apply(ctx context.Context, writes []todo.Write, at time.Time) (err error) {
+	defer r.metrics.observeRepo("apply", time.Now(), &err)
+	return r.repo.Apply(ctx, writes, at)
+}
+
+func (r *Repo) History(ctx context.Context, ownerID, id int64) (_ []todo.HistoryEntry, err error) {
+	defer r.metrics.observeRepo("history", time.Now(), &err)
+	return r.repo.History(ctx, ownerID, id)
+}
+
+func (r *Repo) AppendOutbox(ctx context.Context, events []todo.Event) (err error) {
+	defer r.metrics.observeRepo("append_outbox", time.Now(), &err)
+	return r.repo.AppendOutbox(ctx, events)
+}
+
+func (r *Repo) ListTags(ctx context.Context, ownerID int64) (_ []todo.Tag, err error) {
+	defer r.metrics.observeRepo("list_tags", time.Now(), &err)
+	return r.repo.ListTags(ctx, ownerID)
+}
+
+func (r *Repo) CreateTag(ctx context.Context, ownerID int64, name string) (err error) {
+	defer r.metrics.observeRepo("create_tag", time.Now(), &err)
+	return r.repo.CreateTag(ctx, ownerID, name)
+}
+
+func (r *Repo) RenameTag(ctx context.Context, ownerID int64, from, to string) (err error) {
+	defer r.metrics.observeRepo("rename_tag", time.Now(), &err)
+	return r.repo.RenameTag(ctx, ownerID, from, to)
+}
+
+func (r *Repo) DeleteTag(ctx context.Context, ownerID int64, name string) (err error) {
+	defer r.metrics.observeRepo("delete_tag", time.Now(), &err)
+	return r.repo.DeleteTag(ctx, ownerID, name)
+}
+
+func (r *Repo) ListProjects(ctx context.Context, ownerID int64) (_ []*todo.Project, err error) {
+	defer r.metrics.observeRepo("list_projects", time.Now(), &err)
+	return r.repo.ListProjects(ctx, ownerID)
+}
+
+func (r *Repo) CreateProject(ctx context.Context, p *todo.Project) (err error) {
+	defer r.metrics.observeRepo("create_project", time.Now(), &err)
+	return r.repo.CreateProject(ctx, p)
+}
+
+func (r *Repo) FindProject(ctx context.Context, ownerID, id int64) (_ *todo.Project, err error) {
+	defer r.metrics.observeRepo("find_project", time.Now(), &err)
+	return r.repo.FindProject(ctx, ownerID, id)
+}
+
+func (r *Repo) UpdateProject(ctx context.Context, p *todo.Project) (err error) {
+	defer r.metrics.observeRepo("update_project", time.Now(), &err)
+	return r.repo.UpdateProject(ctx, p)
+}
+
+func (r *Repo) DeleteProject(ctx context.Context, ownerID, id int64) (err error) {
+	defer r.metrics.observeRepo("delete_project", time.Now(), &err)
+	return r.repo.DeleteProject(ctx, ownerID, id)
+}
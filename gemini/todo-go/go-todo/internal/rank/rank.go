@@ -0,0 +1,154 @@
+// Package rank generates lexicographic ranks for manually ordered lists.
+//
+// A rank is a string of base-62 digits that does not end in the lowest digit.
+// Ranks compare with plain byte-wise string comparison, and another rank can
+// always be generated between any two, so moving an item only rewrites the
+// item itself. Ranks generated at either end of a list count up or down
+// rather than halve the remaining space, so they grow with the logarithm of
+// the number of items rather than in a straight line.
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits are the rank digits in ascending byte order.
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ErrInvalidBounds is returned when a bound is not a valid rank or the
+// bounds are not in ascending order.
+var ErrInvalidBounds = errors.New("rank: invalid bounds")
+
+// Between returns a rank that sorts after a and before b. An empty a stands
+// for the start of the list and an empty b for its end, so Between(last, "")
+// appends and Between("", first) prepends.
+func Between(a, b string) (string, error) {
+	if a != "" && !Valid(a) || b != "" && (!Valid(b) || a >= b) {
+		return "", ErrInvalidBounds
+	}
+	switch {
+	case a != "" && b == "":
+		return after(a), nil
+	case a == "" && b != "":
+		return before(b), nil
+	}
+	return midpoint(a, b), nil
+}
+
+// Valid reports whether s is a rank.
+func Valid(s string) bool {
+	if s == "" || s[len(s)-1] == digits[0] {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(digits, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// midpoint returns a rank between a and b, which are in order. Digits missing
+// from the end of a read as the lowest digit, and an empty b has no upper
+// bound.
+func midpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(suffix(a, n), b[n:])
+		}
+	}
+
+	lo, hi := 0, len(digits)
+	if a != "" {
+		lo = strings.IndexByte(digits, a[0])
+	}
+	if b != "" {
+		hi = strings.IndexByte(digits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(digits[(lo+hi)/2])
+	}
+
+	// The first digits are adjacent. If b continues, its first digit alone
+	// already sorts between the two; otherwise extend a.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(digits[lo]) + midpoint(suffix(a, 1), "")
+}
+
+// after returns a rank after a. A rank starting with k highest digits has
+// an integer part of the k+1 digits following them; after counts it up,
+// which eventually carries into one more highest digit and a longer
+// integer part.
+func after(a string) string {
+	k := leading(a, digits[len(digits)-1])
+	head := integer(a, k)
+	// The first digit of the integer part is not the highest, so this
+	// cannot overflow.
+	i := len(head) - 1
+	for head[i] == digits[len(digits)-1] {
+		head[i] = digits[0]
+		i--
+	}
+	head[i] = digits[strings.IndexByte(digits, head[i])+1]
+	return strings.TrimRight(a[:k]+string(head), digits[:1])
+}
+
+// before returns a rank before b, counting the integer part following k
+// lowest digits down as after counts up.
+func before(b string) string {
+	k := leading(b, digits[0])
+	head := integer(b, k)
+	i := len(head) - 1
+	for head[i] == digits[0] {
+		head[i] = digits[len(digits)-1]
+		i--
+	}
+	head[i] = digits[strings.IndexByte(digits, head[i])-1]
+	r := strings.TrimRight(b[:k]+string(head), digits[:1])
+	if r == "" {
+		// b was the lowest rank with a one-digit integer part; continue with
+		// the highest of two digits.
+		return strings.Repeat(digits[:1], k+1) + strings.Repeat(digits[len(digits)-1:], k+2)
+	}
+	return r
+}
+
+// leading returns the number of times s starts with d.
+func leading(s string, d byte) int {
+	n := 0
+	for n < len(s) && s[n] == d {
+		n++
+	}
+	return n
+}
+
+// integer returns the k+1 digits of s following its first k, with missing
+// digits read as the lowest digit.
+func integer(s string, k int) []byte {
+	head := make([]byte, k+1)
+	for i := range head {
+		head[i] = digitAt(s, k+i)
+	}
+	return head
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+func suffix(s string, i int) string {
+	if i < len(s) {
+		return s[i:]
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package rank_test
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/gemini/go-todo/internal/rank"
+)
+
+func TestBetween(t *testing.T) {
+	t.Run("generates ranks between the bounds", func(t *testing.T) {
+		tests := []struct{ a, b string }{
+			{"", ""},
+			{"V", ""},
+			{"", "V"},
+			{"V", "W"},
+			{"V", "V1"},
+			{"z", ""},
+			{"", "01"},
+			{"0000000009V", "0000000010V"},
+			{"000000001", "0000000010V"},
+			{"Vzzz", "W"},
+			{"0000000009V", ""},
+			{"", "0000000001V"},
+			{"zzzzzzzzzz", ""},
+			{"", "1"},
+			{"yz", ""},
+		}
+		for _, tt := range tests {
+			got, err := rank.Between(tt.a, tt.b)
+			if err != nil {
+				t.Errorf("Between(%q, %q): unexpected error: %v", tt.a, tt.b, err)
+				continue
+			}
+			if !rank.Valid(got) || got <= tt.a || tt.b != "" && got >= tt.b {
+				t.Errorf("Between(%q, %q) = %q, which is not a rank between them", tt.a, tt.b, got)
+			}
+		}
+	})
+
+	t.Run("rejects invalid bounds", func(t *testing.T) {
+		for _, tt := range []struct{ a, b string }{
+			{"W", "V"},
+			{"V", "V"},
+			{"V0", ""},
+			{"", "a-b"},
+		} {
+			if _, err := rank.Between(tt.a, tt.b); !errors.Is(err, rank.ErrInvalidBounds) {
+				t.Errorf("Between(%q, %q): expected error %v, got %v", tt.a, tt.b, rank.ErrInvalidBounds, err)
+			}
+		}
+	})
+
+	t.Run("keeps ranks short at either end", func(t *testing.T) {
+		var last, first string
+		for i := 0; i < 5000; i++ {
+			next, err := rank.Between(last, "")
+			if err != nil || !rank.Valid(next) || next <= last || len(next) > 5 {
+				t.Fatalf("appending after %q: got %q, %v", last, next, err)
+			}
+			prev, err := rank.Between("", first)
+			if err != nil || !rank.Valid(prev) || first != "" && prev >= first || len(prev) > 5 {
+				t.Fatalf("prepending before %q: got %q, %v", first, prev, err)
+			}
+			last, first = next, prev
+		}
+	})
+
+	t.Run("keeps a list in order under random moves", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(1))
+		var list []string
+		for i := 0; i < 2000; i++ {
+			at := rnd.Intn(len(list) + 1)
+			var a, b string
+			if at > 0 {
+				a = list[at-1]
+			}
+			if at < len(list) {
+				b = list[at]
+			}
+			r, err := rank.Between(a, b)
+			if err != nil {
+				t.Fatalf("Between(%q, %q): unexpected error: %v", a, b, err)
+			}
+			list = append(list[:at], append([]string{r}, list[at:]...)...)
+		}
+		if !sort.StringsAreSorted(list) {
+			t.Error("expected the ranks to sort in list order")
+		}
+	})
+}
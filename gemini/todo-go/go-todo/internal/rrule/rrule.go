@@ -0,0 +1,475 @@
+// Package rrule implements the subset of iCalendar (RFC 5545) recurrence
+// rules used for repeating todos: FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT
+// and UNTIL.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRule is returned when a rule cannot be parsed or uses parts
+// outside the supported subset.
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// Frequency is the base period of a rule.
+type Frequency int
+
+const (
+	Daily Frequency = iota + 1
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencies = map[string]Frequency{
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+func (f Frequency) String() string {
+	switch f {
+	case Daily:
+		return "DAILY"
+	case Weekly:
+		return "WEEKLY"
+	case Monthly:
+		return "MONTHLY"
+	case Yearly:
+		return "YEARLY"
+	}
+	return strconv.Itoa(int(f))
+}
+
+// WeekdayNum is a BYDAY entry. N selects the Nth such weekday of the month,
+// counting from the end when negative; zero selects every such weekday.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+var weekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (w WeekdayNum) String() string {
+	if w.N == 0 {
+		return weekdays[w.Day]
+	}
+	return strconv.Itoa(w.N) + weekdays[w.Day]
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	// Count limits the number of occurrences. Rule does not know which
+	// occurrence it is asked about, so callers enforce it.
+	Count int
+	// Until is the last instant an occurrence may fall on. When
+	// UntilIsDate is set only its date is significant, and it is compared
+	// with dates of occurrences in their own location.
+	Until       time.Time
+	UntilIsDate bool
+}
+
+// maxIterations bounds the search for the next occurrence of rules that
+// rarely or never match, such as the 31st of every other February.
+const maxIterations = 1000
+
+// Parse parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH". An
+// optional "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	r := &Rule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate %s", ErrInvalidRule, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			var ok bool
+			if r.Freq, ok = frequencies[value]; !ok {
+				err = fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = positive(value)
+		case "COUNT":
+			r.Count, err = positive(value)
+		case "UNTIL":
+			err = r.parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseByMonthDay(value)
+		default:
+			err = fmt.Errorf("unsupported part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	return r, nil
+}
+
+func positive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive integer", s)
+	}
+	return n, nil
+}
+
+func (r *Rule) parseUntil(s string) error {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		r.Until = t
+		return nil
+	}
+	if t, err := time.Parse("20060102", s); err == nil {
+		r.Until, r.UntilIsDate = t, true
+		return nil
+	}
+	return fmt.Errorf("UNTIL %q must be a UTC date-time or a date", s)
+}
+
+func parseByDay(s string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, v := range strings.Split(s, ",") {
+		if len(v) < 2 {
+			return nil, fmt.Errorf("invalid BYDAY %q", v)
+		}
+		day := -1
+		for i, name := range weekdays {
+			if strings.HasSuffix(v, name) {
+				day = i
+			}
+		}
+		if day < 0 {
+			return nil, fmt.Errorf("invalid BYDAY %q", v)
+		}
+		w := WeekdayNum{Day: time.Weekday(day)}
+		if prefix := v[:len(v)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n < -5 || n > 5 {
+				return nil, fmt.Errorf("invalid BYDAY %q", v)
+			}
+			w.N = n
+		}
+		days = append(days, w)
+	}
+	return days, nil
+}
+
+func parseByMonthDay(s string) ([]int, error) {
+	var days []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n == 0 || n < -31 || n > 31 {
+			return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+		}
+		days = append(days, n)
+	}
+	return days, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Freq == 0 {
+		return errors.New("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return errors.New("BYMONTHDAY requires FREQ=MONTHLY")
+	}
+	if len(r.ByDay) > 0 && r.Freq == Yearly {
+		return errors.New("BYDAY is not supported with FREQ=YEARLY")
+	}
+	for _, w := range r.ByDay {
+		if w.N != 0 && r.Freq != Monthly {
+			return errors.New("numbered BYDAY requires FREQ=MONTHLY")
+		}
+	}
+	return nil
+}
+
+// String returns the canonical form of the rule.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, w := range r.ByDay {
+			days[i] = w.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.UntilIsDate {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence after t of the series that starts at
+// start, the DTSTART of RFC 5545. Occurrences fall on the wall clock time of
+// start in start's location, so a daily 09:00 rule stays at 09:00 across
+// daylight saving changes, and INTERVAL counts periods from start. Dates
+// that do not exist, such as February 30, are skipped rather than clamped.
+// The second result is false when the rule has no further occurrences.
+func (r *Rule) Next(start, t time.Time) (time.Time, bool) {
+	t = t.In(start.Location())
+
+	var next time.Time
+	var ok bool
+	switch r.Freq {
+	case Daily:
+		next, ok = r.nextDaily(start, t)
+	case Weekly:
+		next, ok = r.nextWeekly(start, t)
+	case Monthly:
+		next, ok = r.nextMonthly(start, t)
+	case Yearly:
+		next, ok = r.nextYearly(start, t)
+	}
+	if !ok || r.after(next) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// after reports whether t lies after Until.
+func (r *Rule) after(t time.Time) bool {
+	if r.Until.IsZero() {
+		return false
+	}
+	if r.UntilIsDate {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).After(r.Until)
+	}
+	return t.After(r.Until)
+}
+
+// at returns the given date at the wall clock time of start in its
+// location. A wall clock time skipped by a daylight saving change is moved
+// forward by the length of the gap. One that occurs twice refers to the
+// first instant, as RFC 5545 requires, whereas time.Date picks the second.
+func at(start time.Time, y int, m time.Month, d int) time.Time {
+	next := time.Date(y, m, d, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+
+	zoneStart, _ := next.ZoneBounds()
+	if zoneStart.IsZero() {
+		return next
+	}
+	_, offset := next.Zone()
+	_, prevOffset := zoneStart.Add(-time.Nanosecond).Zone()
+	if prevOffset > offset {
+		earlier := next.Add(-time.Duration(prevOffset-offset) * time.Second)
+		if earlier.Before(zoneStart) && earlier.Hour() == next.Hour() && earlier.Minute() == next.Minute() {
+			return earlier
+		}
+	}
+	return next
+}
+
+// candidate reports whether next is an occurrence worth returning.
+func candidate(start, t, next time.Time) bool {
+	return next.After(t) && !next.Before(start)
+}
+
+// civilDay numbers the calendar date of t, ignoring its time of day.
+func civilDay(t time.Time) int {
+	y, m, d := t.Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// firstPeriod returns the first multiple of interval that is not past n,
+// the number of periods between start and t, so the search starts near t
+// rather than at start.
+func firstPeriod(n, interval int) int {
+	if n <= 0 {
+		return 0
+	}
+	return n / interval * interval
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func (r *Rule) matchesWeekday(d time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, w := range r.ByDay {
+		if w.Day == d {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) nextDaily(start, t time.Time) (time.Time, bool) {
+	y, m, d := start.Date()
+	day := firstPeriod(civilDay(t)-civilDay(start), r.Interval)
+	for i := 0; i < maxIterations; i, day = i+1, day+r.Interval {
+		next := at(start, y, m, d+day)
+		if candidate(start, t, next) && r.matchesWeekday(next.Weekday()) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *Rule) nextWeekly(start, t time.Time) (time.Time, bool) {
+	days := []int{weekIndex(start.Weekday())}
+	if len(r.ByDay) > 0 {
+		days = days[:0]
+		for _, w := range r.ByDay {
+			days = append(days, weekIndex(w.Day))
+		}
+		sort.Ints(days)
+	}
+
+	// Weeks start on Monday, the RFC 5545 default for WKST.
+	y, m, d := start.Date()
+	monday := d - weekIndex(start.Weekday())
+	week := firstPeriod((civilDay(t)-civilDay(start)+weekIndex(start.Weekday()))/7, r.Interval)
+	for i := 0; i < maxIterations; i, week = i+1, week+r.Interval {
+		for _, day := range days {
+			next := at(start, y, m, monday+7*week+day)
+			if candidate(start, t, next) {
+				return next, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// weekIndex numbers weekdays from Monday.
+func weekIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+func (r *Rule) nextMonthly(start, t time.Time) (time.Time, bool) {
+	y, m, _ := start.Date()
+	ty, tm, _ := t.Date()
+	month := firstPeriod((ty-y)*12+int(tm-m), r.Interval)
+	for i := 0; i < maxIterations; i, month = i+1, month+r.Interval {
+		first := time.Date(y, m+time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		for _, d := range r.monthDays(start, first.Year(), first.Month()) {
+			next := at(start, first.Year(), first.Month(), d)
+			if candidate(start, t, next) {
+				return next, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// monthDays returns the sorted days of a month on which the rule occurs.
+// Without BYMONTHDAY or BYDAY that is the day of the month of start.
+func (r *Rule) monthDays(start time.Time, y int, m time.Month) []int {
+	n := daysIn(y, m)
+
+	var byMonthDay map[int]bool
+	if len(r.ByMonthDay) > 0 {
+		byMonthDay = make(map[int]bool)
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = n + 1 + d
+			}
+			if d >= 1 && d <= n {
+				byMonthDay[d] = true
+			}
+		}
+	}
+
+	var byDay map[int]bool
+	if len(r.ByDay) > 0 {
+		byDay = make(map[int]bool)
+		first := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		for _, w := range r.ByDay {
+			// Days of the month falling on w.Day, in order.
+			var matches []int
+			for d := 1 + (int(w.Day)-int(first)+7)%7; d <= n; d += 7 {
+				matches = append(matches, d)
+			}
+			switch {
+			case w.N == 0:
+				for _, d := range matches {
+					byDay[d] = true
+				}
+			case w.N > 0 && w.N <= len(matches):
+				byDay[matches[w.N-1]] = true
+			case w.N < 0 && -w.N <= len(matches):
+				byDay[matches[len(matches)+w.N]] = true
+			}
+		}
+	}
+
+	var days []int
+	for d := 1; d <= n; d++ {
+		switch {
+		case byMonthDay == nil && byDay == nil:
+			if d == start.Day() {
+				days = append(days, d)
+			}
+		case (byMonthDay == nil || byMonthDay[d]) && (byDay == nil || byDay[d]):
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+func (r *Rule) nextYearly(start, t time.Time) (time.Time, bool) {
+	y, m, d := start.Date()
+	year := firstPeriod(t.Year()-y, r.Interval)
+	for i := 0; i < maxIterations; i, year = i+1, year+r.Interval {
+		if d > daysIn(y+year, m) {
+			continue
+		}
+		next := at(start, y+year, m, d)
+		if candidate(start, t, next) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
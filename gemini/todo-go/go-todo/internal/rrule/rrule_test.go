@@ -0,0 +1,216 @@
+package rrule_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/rrule"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	return loc
+}
+
+// occurrences returns up to n occurrences after start of the series
+// starting at start.
+func occurrences(t *testing.T, rule string, start time.Time, n int) []time.Time {
+	t.Helper()
+	r, err := rrule.Parse(rule)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []time.Time
+	for cur := start; len(got) < n; {
+		next, ok := r.Next(start, cur)
+		if !ok {
+			break
+		}
+		got = append(got, next)
+		cur = next
+	}
+	return got
+}
+
+func checkDates(t *testing.T, got []time.Time, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d occurrences, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if s := got[i].Format("2006-01-02 15:04 MST"); s != want[i] {
+			t.Errorf("occurrence %d: expected %s, got %s", i, want[i], s)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("canonicalizes valid rules", func(t *testing.T) {
+		tests := map[string]string{
+			"freq=daily": "FREQ=DAILY",
+			"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH":  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			"FREQ=MONTHLY;BYDAY=-1FR;COUNT=3":           "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			"FREQ=MONTHLY;BYMONTHDAY=-1;UNTIL=20241231": "FREQ=MONTHLY;BYMONTHDAY=-1;UNTIL=20241231",
+			"FREQ=YEARLY;INTERVAL=1":                    "FREQ=YEARLY",
+		}
+		for in, want := range tests {
+			r, err := rrule.Parse(in)
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", in, err)
+				continue
+			}
+			if got := r.String(); got != want {
+				t.Errorf("%q: expected %q, got %q", in, want, got)
+			}
+		}
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		for _, in := range []string{
+			"",
+			"INTERVAL=2",
+			"FREQ=HOURLY",
+			"FREQ=DAILY;INTERVAL=0",
+			"FREQ=DAILY;FREQ=WEEKLY",
+			"FREQ=DAILY;COUNT=2;UNTIL=20240101",
+			"FREQ=WEEKLY;BYDAY=1MO",
+			"FREQ=WEEKLY;BYMONTHDAY=1",
+			"FREQ=MONTHLY;BYMONTHDAY=32",
+			"FREQ=MONTHLY;BYDAY=XX",
+			"FREQ=YEARLY;BYMONTH=2",
+		} {
+			if _, err := rrule.Parse(in); !errors.Is(err, rrule.ErrInvalidRule) {
+				t.Errorf("%q: expected error %v, got %v", in, rrule.ErrInvalidRule, err)
+			}
+		}
+	})
+}
+
+func TestRule_Next(t *testing.T) {
+	utc := func(y int, m time.Month, d, h int) time.Time {
+		return time.Date(y, m, d, h, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("daily with an interval", func(t *testing.T) {
+		got := occurrences(t, "FREQ=DAILY;INTERVAL=3", utc(2024, 2, 27, 9), 3)
+		checkDates(t, got, "2024-03-01 09:00 UTC", "2024-03-04 09:00 UTC", "2024-03-07 09:00 UTC")
+	})
+
+	t.Run("daily on weekdays only", func(t *testing.T) {
+		// 2024-03-08 is a Friday.
+		got := occurrences(t, "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", utc(2024, 3, 8, 9), 2)
+		checkDates(t, got, "2024-03-11 09:00 UTC", "2024-03-12 09:00 UTC")
+	})
+
+	t.Run("weekly on several days every other week", func(t *testing.T) {
+		// 2024-03-04 is a Monday.
+		got := occurrences(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=TH,MO", utc(2024, 3, 4, 9), 4)
+		checkDates(t, got, "2024-03-07 09:00 UTC", "2024-03-18 09:00 UTC", "2024-03-21 09:00 UTC", "2024-04-01 09:00 UTC")
+	})
+
+	t.Run("weekly on the weekday of the current occurrence", func(t *testing.T) {
+		got := occurrences(t, "FREQ=WEEKLY", utc(2024, 12, 27, 9), 2)
+		checkDates(t, got, "2025-01-03 09:00 UTC", "2025-01-10 09:00 UTC")
+	})
+
+	t.Run("monthly on the 31st skips shorter months", func(t *testing.T) {
+		got := occurrences(t, "FREQ=MONTHLY", utc(2024, 1, 31, 9), 4)
+		checkDates(t, got, "2024-03-31 09:00 UTC", "2024-05-31 09:00 UTC", "2024-07-31 09:00 UTC", "2024-08-31 09:00 UTC")
+	})
+
+	t.Run("monthly on the last day", func(t *testing.T) {
+		got := occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=-1", utc(2024, 1, 31, 9), 3)
+		checkDates(t, got, "2024-02-29 09:00 UTC", "2024-03-31 09:00 UTC", "2024-04-30 09:00 UTC")
+	})
+
+	t.Run("monthly on the 30th skips February", func(t *testing.T) {
+		got := occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=30", utc(2023, 1, 30, 9), 2)
+		checkDates(t, got, "2023-03-30 09:00 UTC", "2023-04-30 09:00 UTC")
+	})
+
+	t.Run("monthly on the last Friday", func(t *testing.T) {
+		got := occurrences(t, "FREQ=MONTHLY;BYDAY=-1FR", utc(2024, 1, 1, 9), 3)
+		checkDates(t, got, "2024-01-26 09:00 UTC", "2024-02-23 09:00 UTC", "2024-03-29 09:00 UTC")
+	})
+
+	t.Run("monthly on the fifth Monday skips months without one", func(t *testing.T) {
+		got := occurrences(t, "FREQ=MONTHLY;BYDAY=5MO", utc(2024, 1, 1, 9), 2)
+		checkDates(t, got, "2024-01-29 09:00 UTC", "2024-04-29 09:00 UTC")
+	})
+
+	t.Run("yearly on February 29 waits for leap years", func(t *testing.T) {
+		got := occurrences(t, "FREQ=YEARLY", utc(2024, 2, 29, 9), 2)
+		checkDates(t, got, "2028-02-29 09:00 UTC", "2032-02-29 09:00 UTC")
+	})
+
+	t.Run("stops after UNTIL", func(t *testing.T) {
+		got := occurrences(t, "FREQ=DAILY;UNTIL=20240303", utc(2024, 3, 1, 23), 5)
+		checkDates(t, got, "2024-03-02 23:00 UTC", "2024-03-03 23:00 UTC")
+
+		got = occurrences(t, "FREQ=DAILY;UNTIL=20240303T120000Z", utc(2024, 3, 1, 23), 5)
+		checkDates(t, got, "2024-03-02 23:00 UTC")
+	})
+
+	t.Run("counts intervals from the start", func(t *testing.T) {
+		r, _ := rrule.Parse("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO")
+		start := utc(2024, 3, 4, 9)
+		// Asked from a Wednesday in an off week, the next Monday is skipped.
+		next, ok := r.Next(start, utc(2024, 3, 13, 12))
+		if !ok || !next.Equal(utc(2024, 3, 18, 9)) {
+			t.Errorf("expected %v, got %v", utc(2024, 3, 18, 9), next)
+		}
+
+		r, _ = rrule.Parse("FREQ=MONTHLY;INTERVAL=3")
+		next, ok = r.Next(utc(2023, 1, 15, 9), utc(2024, 2, 20, 0))
+		if !ok || !next.Equal(utc(2024, 4, 15, 9)) {
+			t.Errorf("expected %v, got %v", utc(2024, 4, 15, 9), next)
+		}
+	})
+
+	t.Run("gives up on rules that never match", func(t *testing.T) {
+		got := occurrences(t, "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30", utc(2024, 2, 1, 9), 1)
+		checkDates(t, got)
+	})
+}
+
+func TestRule_NextAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	newYork := mustLoad(t, "America/New_York")
+
+	t.Run("keeps the wall clock time when clocks spring forward", func(t *testing.T) {
+		got := occurrences(t, "FREQ=DAILY", time.Date(2024, 3, 30, 9, 0, 0, 0, berlin), 2)
+		checkDates(t, got, "2024-03-31 09:00 CEST", "2024-04-01 09:00 CEST")
+		if d := got[0].Sub(time.Date(2024, 3, 30, 9, 0, 0, 0, berlin)); d != 23*time.Hour {
+			t.Errorf("expected a 23 hour day, got %v", d)
+		}
+	})
+
+	t.Run("keeps the wall clock time when clocks fall back", func(t *testing.T) {
+		got := occurrences(t, "FREQ=WEEKLY", time.Date(2024, 10, 28, 9, 0, 0, 0, newYork), 1)
+		checkDates(t, got, "2024-11-04 09:00 EST")
+	})
+
+	t.Run("moves a skipped time past the gap only on that day", func(t *testing.T) {
+		got := occurrences(t, "FREQ=DAILY", time.Date(2024, 3, 30, 2, 30, 0, 0, berlin), 2)
+		checkDates(t, got, "2024-03-31 03:30 CEST", "2024-04-01 02:30 CEST")
+	})
+
+	t.Run("uses the first of a repeated time", func(t *testing.T) {
+		got := occurrences(t, "FREQ=DAILY", time.Date(2024, 10, 26, 2, 30, 0, 0, berlin), 1)
+		checkDates(t, got, "2024-10-27 02:30 CEST")
+		if want := time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC); !got[0].Equal(want) {
+			t.Errorf("expected %v, got %v", want, got[0].UTC())
+		}
+	})
+
+	t.Run("keeps the month-end in local time", func(t *testing.T) {
+		// 23:30 in New York on the last day is already the next month in UTC.
+		got := occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=-1", time.Date(2024, 10, 31, 23, 30, 0, 0, newYork), 2)
+		checkDates(t, got, "2024-11-30 23:30 EST", "2024-12-31 23:30 EST")
+	})
+}
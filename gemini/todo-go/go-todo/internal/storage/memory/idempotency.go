@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/gemini/go-todo/internal/idempotency"
+)
+
+// IdempotencyStore is an in-memory implementation of the
+// idempotency.Store.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	records map[idempotencyKey]*idempotency.Record
+}
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+func newIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{records: make(map[idempotencyKey]*idempotency.Record)}
+}
+
+// Reserve stores rec for a request in progress unless the client has an
+// unexpired record for the key that is not abandoned. Expired records of
+// all clients are deleted on the way.
+func (s *IdempotencyStore) Reserve(ctx context.Context, rec *idempotency.Record) (*idempotency.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, stored := range s.records {
+		if !stored.ExpiresAt.After(rec.CreatedAt) {
+			delete(s.records, k)
+		}
+	}
+	k := idempotencyKey{rec.UserID, rec.Key}
+	if stored, ok := s.records[k]; ok && !stored.Abandoned(rec.CreatedAt) {
+		return cloneRecord(stored), nil
+	}
+	s.records[k] = cloneRecord(rec)
+	return nil, nil
+}
+
+// Complete stores the response to the request that reserved a key with rec.
+func (s *IdempotencyStore) Complete(ctx context.Context, rec *idempotency.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{rec.UserID, rec.Key}
+	stored, ok := s.records[k]
+	if !ok || !stored.CreatedAt.Equal(rec.CreatedAt) {
+		return idempotency.ErrNotFound
+	}
+	c := cloneRecord(rec)
+	c.Fingerprint, c.CreatedAt, c.ExpiresAt, c.LockedUntil = stored.Fingerprint, stored.CreatedAt, stored.ExpiresAt, stored.LockedUntil
+	s.records[k] = c
+	return nil
+}
+
+// Release deletes the reservation made with rec.
+func (s *IdempotencyStore) Release(ctx context.Context, rec *idempotency.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{rec.UserID, rec.Key}
+	if stored, ok := s.records[k]; !ok || !stored.CreatedAt.Equal(rec.CreatedAt) {
+		return idempotency.ErrNotFound
+	}
+	delete(s.records, k)
+	return nil
+}
+
+// cloneRecord copies a record so callers cannot mutate stored state.
+func cloneRecord(rec *idempotency.Record) *idempotency.Record {
+	c := *rec
+	c.Header = rec.Header.Clone()
+	c.Body = bytes.Clone(rec.Body)
+	return &c
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/webhook"
+)
+
+// outboxEvent is an event in the outbox.
+type outboxEvent struct {
+	webhook.Event
+	dispatched bool
+}
+
+// AppendOutbox stores events in the outbox.
+func (r *Repo) AppendOutbox(ctx context.Context, events []todo.Event) error {
+	defer r.lock()()
+
+	for _, e := range events {
+		b, err := json.Marshal(e.Todo)
+		if err != nil {
+			return err
+		}
+		r.outbox = append(r.outbox, &outboxEvent{Event: webhook.Event{
+			ID:        r.nextOutboxID,
+			OwnerID:   e.OwnerID,
+			Type:      e.Type,
+			Todo:      b,
+			CreatedAt: e.At,
+		}})
+		r.nextOutboxID++
+	}
+	return nil
+}
+
+// outboxEvent finds an event in the outbox by its ID. The caller must hold
+// r.mu.
+func (s *store) outboxEvent(id int64) (*outboxEvent, bool) {
+	for _, e := range s.outbox {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// pruneOutbox drops the dispatched events no delivery needs. The caller
+// must hold r.mu.
+func (s *store) pruneOutbox() {
+	needed := make(map[int64]bool)
+	for _, d := range s.webhooks.deliveries {
+		needed[d.Event.ID] = true
+	}
+	outbox := s.outbox[:0]
+	for _, e := range s.outbox {
+		if !e.dispatched || needed[e.ID] {
+			outbox = append(outbox, e)
+		}
+	}
+	s.outbox = outbox
+}
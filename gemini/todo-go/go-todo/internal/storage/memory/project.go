@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// ListProjects returns the owner's projects by name.
+func (r *Repo) ListProjects(ctx context.Context, ownerID int64) ([]*todo.Project, error) {
+	defer r.rlock()()
+
+	var projects []*todo.Project
+	for _, p := range r.projects {
+		if p.OwnerID == ownerID {
+			c := *p
+			projects = append(projects, &c)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Name < projects[j].Name
+	})
+	return projects, nil
+}
+
+// CreateProject creates a new project.
+func (r *Repo) CreateProject(ctx context.Context, p *todo.Project) error {
+	defer r.lock()()
+
+	if r.nameTaken(p) {
+		return todo.ErrProjectExists
+	}
+	p.ID = r.nextProjectID
+	r.nextProjectID++
+	c := *p
+	r.projects[p.ID] = &c
+	return nil
+}
+
+// FindProject finds an owner's project by its ID.
+func (r *Repo) FindProject(ctx context.Context, ownerID, id int64) (*todo.Project, error) {
+	defer r.rlock()()
+
+	p, ok := r.projects[id]
+	if !ok || p.OwnerID != ownerID {
+		return nil, todo.ErrProjectNotFound
+	}
+	c := *p
+	return &c, nil
+}
+
+// UpdateProject stores the name and archived state of a project.
+func (r *Repo) UpdateProject(ctx context.Context, p *todo.Project) error {
+	defer r.lock()()
+
+	stored, ok := r.projects[p.ID]
+	if !ok || stored.OwnerID != p.OwnerID {
+		return todo.ErrProjectNotFound
+	}
+	if r.nameTaken(p) {
+		return todo.ErrProjectExists
+	}
+	c := *p
+	r.projects[p.ID] = &c
+	return nil
+}
+
+// DeleteProject deletes an owner's project and moves its todos out of it.
+func (r *Repo) DeleteProject(ctx context.Context, ownerID, id int64) error {
+	defer r.lock()()
+
+	p, ok := r.projects[id]
+	if !ok || p.OwnerID != ownerID {
+		return todo.ErrProjectNotFound
+	}
+	delete(r.projects, id)
+	for _, t := range r.todos {
+		if t.ProjectID == id {
+			t.ProjectID = 0
+			t.Version++
+		}
+	}
+	return nil
+}
+
+// nameTaken reports whether another project of the owner has p's name. The
+// caller must hold r.mu.
+func (r *Repo) nameTaken(p *todo.Project) bool {
+	for _, other := range r.projects {
+		if other.OwnerID == p.OwnerID && other.ID != p.ID && other.Name == p.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// archived reports whether the project with the given ID is archived. The
+// caller must hold r.mu.
+func (r *Repo) archived(projectID int64) bool {
+	p, ok := r.projects[projectID]
+	return ok && p.Archived
+}
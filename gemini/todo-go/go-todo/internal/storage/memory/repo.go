@@ -4,87 +4,429 @@ import (
 	"context"
 	"sort"
 	"sync"
+	"time"
 
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/rank"
 	"github.com/gemini/go-todo/internal/todo"
 )
 
 // Repo is an in-memory implementation of the todo.Repository.
 type Repo struct {
-	mu    sync.RWMutex
-	todos map[int64]*todo.Todo
+	*store
+	// tx is set on a repository bound to a transaction by WithTx, which
+	// holds the lock for it.
+	tx bool
+
+	users       *UserRepo
+	idempotency *IdempotencyStore
+}
+
+// store holds the state shared by a repository and the repositories bound
+// to its transactions.
+type store struct {
+	mu     sync.RWMutex
+	todos  map[int64]*todo.Todo
 	nextID int64
+	// tags holds the registered tag names of each owner.
+	tags map[int64]map[string]bool
+	// projects holds the projects of all owners by ID.
+	projects      map[int64]*todo.Project
+	nextProjectID int64
+	// history holds the history entries of all todos, oldest first.
+	history       []todo.HistoryEntry
+	nextHistoryID int64
+	// outbox holds the events of all owners, oldest first, until they are
+	// dispatched and no delivery needs them.
+	outbox       []*outboxEvent
+	nextOutboxID int64
+
+	webhooks webhookState
 }
 
 // NewRepo creates a new in-memory repository.
 func NewRepo() *Repo {
 	return &Repo{
-		todos:  make(map[int64]*todo.Todo),
-		nextID: 1,
+		store: &store{
+			todos:         make(map[int64]*todo.Todo),
+			nextID:        1,
+			tags:          make(map[int64]map[string]bool),
+			projects:      make(map[int64]*todo.Project),
+			nextProjectID: 1,
+			nextHistoryID: 1,
+			nextOutboxID:  1,
+			webhooks:      newWebhookState(),
+		},
+		users:       newUserRepo(),
+		idempotency: newIdempotencyStore(),
 	}
 }
 
-// Create creates a new todo.
+// Users returns the user repository.
+func (r *Repo) Users() *UserRepo {
+	return r.users
+}
+
+// Idempotency returns the idempotency store.
+func (r *Repo) Idempotency() *IdempotencyStore {
+	return r.idempotency
+}
+
+// Create creates a new todo. Todos without a position are placed after the
+// owner's other todos.
 func (r *Repo) Create(ctx context.Context, t *todo.Todo) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.lock()()
+	return r.create(ctx, t)
+}
+
+// create creates a todo. The caller must hold r.mu.
+func (r *Repo) create(ctx context.Context, t *todo.Todo) error {
+	if t.Position == "" {
+		var last string
+		for _, other := range r.todos {
+			if other.OwnerID == t.OwnerID && other.Position > last {
+				last = other.Position
+			}
+		}
+		position, err := rank.Between(last, "")
+		if err != nil {
+			return err
+		}
+		t.Position = position
+	}
 
 	t.ID = r.nextID
+	t.Version = 1
 	r.nextID++
-	r.todos[t.ID] = t
+	r.todos[t.ID] = forStorage(t)
+	r.registerTags(t.OwnerID, t.Tags)
+	r.record(ctx, t, todo.ActionCreated, nil, t.CreatedAt)
 	return nil
 }
 
-// FindAll returns all todos.
-func (r *Repo) FindAll(ctx context.Context, completed *bool) ([]*todo.Todo, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// FindAll returns the todos matching opts.
+func (r *Repo) FindAll(ctx context.Context, opts todo.ListOptions) ([]*todo.Todo, error) {
+	defer r.rlock()()
 
+	progress := r.progress()
 	var result []*todo.Todo
 	for _, t := range r.todos {
-		if completed == nil || *completed == t.Completed {
-			result = append(result, t)
+		if opts.ExcludesArchived() && r.archived(t.ProjectID) {
+			continue
+		}
+		if opts.Trashed && r.parentTrashed(t) {
+			continue
+		}
+		c := withProgress(t, progress)
+		if opts.Query != "" {
+			c.Match = opts.Search(c)
+		}
+		if opts.Matches(c) {
+			result = append(result, c)
 		}
 	}
 
 	sort.Slice(result, func(i, j int) bool {
-		return result[i].ID < result[j].ID
+		return opts.Less(result[i], result[j])
 	})
 
+	if opts.Limit > 0 && len(result) > opts.Limit {
+		result = result[:opts.Limit]
+	}
 	return result, nil
 }
 
-// FindByID finds a todo by its ID.
-func (r *Repo) FindByID(ctx context.Context, id int64) (*todo.Todo, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// FindByID finds an owner's todo by its ID.
+func (r *Repo) FindByID(ctx context.Context, ownerID, id int64) (*todo.Todo, error) {
+	defer r.rlock()()
 
 	t, ok := r.todos[id]
-	if !ok {
+	if !ok || t.OwnerID != ownerID || t.DeletedAt != nil {
 		return nil, todo.ErrNotFound
 	}
-	return t, nil
+	return withProgress(t, r.progress()), nil
 }
 
-// Update updates a todo.
+// Update updates a todo if the stored version still equals t.Version, and
+// then advances t.Version.
 func (r *Repo) Update(ctx context.Context, t *todo.Todo) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.lock()()
+	return r.update(ctx, t)
+}
 
-	if _, ok := r.todos[t.ID]; !ok {
+// update updates a todo. The caller must hold r.mu.
+func (r *Repo) update(ctx context.Context, t *todo.Todo) error {
+	stored, ok := r.todos[t.ID]
+	if !ok || stored.OwnerID != t.OwnerID || stored.DeletedAt != nil {
 		return todo.ErrNotFound
 	}
-	r.todos[t.ID] = t
+	if stored.Version != t.Version {
+		return todo.ErrConflict
+	}
+	changes, err := todo.Diff(stored, t)
+	if err != nil {
+		return err
+	}
+	t.Version++
+	r.todos[t.ID] = forStorage(t)
+	r.registerTags(t.OwnerID, t.Tags)
+	r.record(ctx, t, todo.ActionUpdated, changes, t.UpdatedAt)
 	return nil
 }
 
-// Delete deletes a todo by its ID.
-func (r *Repo) Delete(ctx context.Context, id int64) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// Delete moves an owner's todo and its subtasks to the trash. A non-zero
+// version makes the delete conditional on the stored version.
+func (r *Repo) Delete(ctx context.Context, ownerID, id, version int64, at time.Time) error {
+	defer r.lock()()
+	return r.delete(ctx, ownerID, id, version, at)
+}
 
-	if _, ok := r.todos[id]; !ok {
+// delete moves a todo and its subtasks to the trash. The caller must hold
+// r.mu.
+func (r *Repo) delete(ctx context.Context, ownerID, id, version int64, at time.Time) error {
+	stored, ok := r.todos[id]
+	if !ok || stored.OwnerID != ownerID || stored.DeletedAt != nil {
 		return todo.ErrNotFound
 	}
-	delete(r.todos, id)
+	if version != 0 && stored.Version != version {
+		return todo.ErrConflict
+	}
+	for _, t := range r.todos {
+		if (t.ID == id || t.ParentID == id) && t.DeletedAt == nil {
+			deletedAt := at
+			t.DeletedAt = &deletedAt
+			t.Version++
+			r.record(ctx, t, todo.ActionDeleted, nil, at)
+		}
+	}
+	return nil
+}
+
+// Restore takes an owner's todo out of the trash together with the subtasks
+// deleted along with it.
+func (r *Repo) Restore(ctx context.Context, ownerID, id int64, at time.Time) error {
+	defer r.lock()()
+
+	stored, ok := r.todos[id]
+	if !ok || stored.OwnerID != ownerID || stored.DeletedAt == nil || r.parentTrashed(stored) {
+		return todo.ErrNotFound
+	}
+	deletedAt := *stored.DeletedAt
+	for _, t := range r.todos {
+		if t.ID == id || (t.ParentID == id && t.DeletedAt != nil && t.DeletedAt.Equal(deletedAt)) {
+			t.DeletedAt = nil
+			t.Version++
+			r.record(ctx, t, todo.ActionRestored, nil, at)
+		}
+	}
 	return nil
 }
+
+// Purge permanently removes the todos moved to the trash before the given
+// time. Subtasks are never in the trash for longer than their parent, so
+// they go with it.
+func (r *Repo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	defer r.lock()()
+
+	var n int64
+	for id, t := range r.todos {
+		if t.DeletedAt != nil && t.DeletedAt.Before(before) {
+			delete(r.todos, id)
+			n++
+		}
+	}
+	history := r.history[:0]
+	for _, e := range r.history {
+		if _, ok := r.todos[e.TodoID]; ok {
+			history = append(history, e)
+		}
+	}
+	r.history = history
+	return n, nil
+}
+
+// History returns the history of an owner's todo, oldest first.
+func (r *Repo) History(ctx context.Context, ownerID, id int64) ([]todo.HistoryEntry, error) {
+	defer r.rlock()()
+
+	if t, ok := r.todos[id]; !ok || t.OwnerID != ownerID {
+		return nil, todo.ErrNotFound
+	}
+	var entries []todo.HistoryEntry
+	for _, e := range r.history {
+		if e.TodoID == id && e.OwnerID == ownerID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// record appends a history entry for a write to t. The caller must hold
+// r.mu.
+func (r *Repo) record(ctx context.Context, t *todo.Todo, action string, changes map[string]todo.FieldChange, at time.Time) {
+	r.history = append(r.history, todo.HistoryEntry{
+		ID:      r.nextHistoryID,
+		TodoID:  t.ID,
+		OwnerID: t.OwnerID,
+		ActorID: auth.UserID(ctx),
+		Action:  action,
+		Changes: changes,
+		Version: t.Version,
+		At:      at,
+	})
+	r.nextHistoryID++
+}
+
+// Apply performs writes in order under a single lock. If a write fails,
+// the repository is reset to its state before the first one, even inside
+// a transaction.
+func (r *Repo) Apply(ctx context.Context, writes []todo.Write, at time.Time) error {
+	defer r.lock()()
+
+	saved := r.save()
+	for i, w := range writes {
+		var err error
+		switch w.Op {
+		case todo.OpCreate:
+			err = r.create(ctx, w.Todo)
+		case todo.OpUpdate:
+			err = r.update(ctx, w.Todo)
+		case todo.OpDelete:
+			err = r.delete(ctx, w.Todo.OwnerID, w.Todo.ID, w.Todo.Version, at)
+		default:
+			err = todo.ErrUnknownOp
+		}
+		if err != nil {
+			r.restore(saved)
+			return &todo.BatchError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// state is a copy of the todos and everything written with them.
+type state struct {
+	todos         map[int64]*todo.Todo
+	nextID        int64
+	tags          map[int64]map[string]bool
+	projects      map[int64]*todo.Project
+	nextProjectID int64
+	history       int
+	nextHistoryID int64
+	outbox        int
+	nextOutboxID  int64
+}
+
+// save copies the todo state. The caller must hold r.mu.
+func (r *Repo) save() state {
+	s := state{
+		todos:         make(map[int64]*todo.Todo, len(r.todos)),
+		nextID:        r.nextID,
+		tags:          make(map[int64]map[string]bool, len(r.tags)),
+		projects:      make(map[int64]*todo.Project, len(r.projects)),
+		nextProjectID: r.nextProjectID,
+		history:       len(r.history),
+		nextHistoryID: r.nextHistoryID,
+		outbox:        len(r.outbox),
+		nextOutboxID:  r.nextOutboxID,
+	}
+	for id, t := range r.todos {
+		s.todos[id] = clone(t)
+	}
+	for id, p := range r.projects {
+		c := *p
+		s.projects[id] = &c
+	}
+	for ownerID, names := range r.tags {
+		s.tags[ownerID] = make(map[string]bool, len(names))
+		for name := range names {
+			s.tags[ownerID][name] = true
+		}
+	}
+	return s
+}
+
+// restore resets the todo state to a saved copy. History and the outbox
+// only grow within a transaction, so dropping the entries added since is
+// enough. The caller must hold r.mu.
+func (r *Repo) restore(s state) {
+	r.todos = s.todos
+	r.nextID = s.nextID
+	r.tags = s.tags
+	r.projects = s.projects
+	r.nextProjectID = s.nextProjectID
+	r.history = r.history[:s.history]
+	r.nextHistoryID = s.nextHistoryID
+	r.outbox = r.outbox[:s.outbox]
+	r.nextOutboxID = s.nextOutboxID
+}
+
+// parentTrashed reports whether t is a subtask of a todo in the trash. The
+// caller must hold r.mu.
+func (r *Repo) parentTrashed(t *todo.Todo) bool {
+	parent, ok := r.todos[t.ParentID]
+	return ok && parent.DeletedAt != nil
+}
+
+// progress counts the subtasks of every todo that has any. The caller must
+// hold r.mu.
+func (r *Repo) progress() map[int64]todo.Progress {
+	progress := make(map[int64]todo.Progress)
+	for _, t := range r.todos {
+		if t.ParentID == 0 || t.DeletedAt != nil {
+			continue
+		}
+		p := progress[t.ParentID]
+		p.Total++
+		if t.Completed {
+			p.Done++
+		}
+		progress[t.ParentID] = p
+	}
+	return progress
+}
+
+// withProgress returns a copy of a stored todo with its progress set.
+func withProgress(t *todo.Todo, progress map[int64]todo.Progress) *todo.Todo {
+	c := clone(t)
+	if p, ok := progress[t.ID]; ok {
+		c.Progress = &p
+	}
+	return c
+}
+
+// forStorage returns the copy of t to store. Progress and search matches
+// are computed on reads.
+func forStorage(t *todo.Todo) *todo.Todo {
+	c := clone(t)
+	c.Progress = nil
+	c.Match = nil
+	return c
+}
+
+// clone copies a todo so callers cannot mutate stored state.
+func clone(t *todo.Todo) *todo.Todo {
+	c := *t
+	c.Tags = append([]string{}, t.Tags...)
+	if t.DueAt != nil {
+		due := *t.DueAt
+		c.DueAt = &due
+	}
+	if t.DeletedAt != nil {
+		deletedAt := *t.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	if t.Recurrence != nil {
+		rec := *t.Recurrence
+		c.Recurrence = &rec
+	}
+	if t.Progress != nil {
+		progress := *t.Progress
+		c.Progress = &progress
+	}
+	if t.Match != nil {
+		match := *t.Match
+		c.Match = &match
+	}
+	return &c
+}
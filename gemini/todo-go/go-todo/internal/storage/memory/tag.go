@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// registerTags records tag names as in use by the owner. The caller must
+// hold r.mu.
+func (r *Repo) registerTags(ownerID int64, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	names, ok := r.tags[ownerID]
+	if !ok {
+		names = make(map[string]bool)
+		r.tags[ownerID] = names
+	}
+	for _, tag := range tags {
+		names[tag] = true
+	}
+}
+
+// ListTags returns the owner's tags with their usage counts, by name.
+func (r *Repo) ListTags(ctx context.Context, ownerID int64) ([]todo.Tag, error) {
+	defer r.rlock()()
+
+	counts := make(map[string]int)
+	for name := range r.tags[ownerID] {
+		counts[name] = 0
+	}
+	for _, t := range r.todos {
+		if t.OwnerID != ownerID || t.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range t.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]todo.Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, todo.Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// CreateTag registers a tag for the owner.
+func (r *Repo) CreateTag(ctx context.Context, ownerID int64, name string) error {
+	defer r.lock()()
+
+	if r.tags[ownerID][name] {
+		return todo.ErrTagExists
+	}
+	r.registerTags(ownerID, []string{name})
+	return nil
+}
+
+// RenameTag renames a tag on every todo of the owner carrying it.
+func (r *Repo) RenameTag(ctx context.Context, ownerID int64, from, to string) error {
+	defer r.lock()()
+
+	names := r.tags[ownerID]
+	if !names[from] {
+		return todo.ErrTagNotFound
+	}
+	if from == to {
+		return nil
+	}
+	if names[to] {
+		return todo.ErrTagExists
+	}
+	delete(names, from)
+	names[to] = true
+
+	r.retag(ownerID, from, to)
+	return nil
+}
+
+// DeleteTag removes a tag from every todo of the owner carrying it.
+func (r *Repo) DeleteTag(ctx context.Context, ownerID int64, name string) error {
+	defer r.lock()()
+
+	if !r.tags[ownerID][name] {
+		return todo.ErrTagNotFound
+	}
+	delete(r.tags[ownerID], name)
+
+	r.retag(ownerID, name, "")
+	return nil
+}
+
+// retag replaces the tag from with to, or drops it if to is empty, on every
+// todo of the owner. The caller must hold r.mu.
+func (r *Repo) retag(ownerID int64, from, to string) {
+	for _, t := range r.todos {
+		if t.OwnerID != ownerID {
+			continue
+		}
+		i := sort.SearchStrings(t.Tags, from)
+		if i == len(t.Tags) || t.Tags[i] != from {
+			continue
+		}
+
+		tags := append(append([]string{}, t.Tags[:i]...), t.Tags[i+1:]...)
+		if to != "" {
+			tags = append(tags, to)
+			sort.Strings(tags)
+		}
+		t.Tags = tags
+		t.Version++
+	}
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// WithTx runs fn with a repository bound to a transaction. The transaction
+// holds the write lock until fn returns, and if fn fails the repository is
+// reset to its state before the transaction. If r is already bound to a
+// transaction, fn joins it.
+func (r *Repo) WithTx(ctx context.Context, fn func(repo todo.Repository) error) error {
+	if r.tx {
+		return fn(r)
+	}
+
+	defer r.lock()()
+	saved := r.save()
+	if err := fn(&Repo{store: r.store, tx: true, users: r.users, idempotency: r.idempotency}); err != nil {
+		r.restore(saved)
+		return err
+	}
+	return nil
+}
+
+// lock write-locks the repository and returns the function unlocking it.
+// A repository bound to a transaction already holds the lock.
+func (r *Repo) lock() func() {
+	if r.tx {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+// rlock read-locks the repository and returns the function unlocking it.
+func (r *Repo) rlock() func() {
+	if r.tx {
+		return func() {}
+	}
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
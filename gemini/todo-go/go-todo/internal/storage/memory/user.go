@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gemini/go-todo/internal/user"
+)
+
+// UserRepo is an in-memory implementation of the user.Repository.
+type UserRepo struct {
+	mu     sync.RWMutex
+	users  map[int64]*user.User
+	nextID int64
+}
+
+func newUserRepo() *UserRepo {
+	return &UserRepo{
+		users:  make(map[int64]*user.User),
+		nextID: 1,
+	}
+}
+
+// Create creates a new user.
+func (r *UserRepo) Create(ctx context.Context, u *user.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == u.Email {
+			return user.ErrEmailTaken
+		}
+	}
+
+	u.ID = r.nextID
+	r.nextID++
+	c := *u
+	r.users[u.ID] = &c
+	return nil
+}
+
+// FindByEmail finds a user by email address.
+func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*user.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, user.ErrNotFound
+}
+
+// FindByID finds a user by ID.
+func (r *UserRepo) FindByID(ctx context.Context, id int64) (*user.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+	c := *u
+	return &c, nil
+}
@@ -0,0 +1,257 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gemini/go-todo/internal/webhook"
+)
+
+// webhookState holds the webhook subscriptions, deliveries and delivery
+// log of all owners.
+type webhookState struct {
+	subscriptions map[int64]*webhook.Subscription
+	nextID        int64
+	deliveries    map[int64]*webhook.Delivery
+	nextDelivery  int64
+	// attempts holds the delivery log, oldest first.
+	attempts    []webhook.Attempt
+	nextAttempt int64
+}
+
+func newWebhookState() webhookState {
+	return webhookState{
+		subscriptions: make(map[int64]*webhook.Subscription),
+		nextID:        1,
+		deliveries:    make(map[int64]*webhook.Delivery),
+		nextDelivery:  1,
+		nextAttempt:   1,
+	}
+}
+
+// WebhookRepo is an in-memory implementation of the webhook.Repository. It
+// shares the outbox of the todo repository it belongs to.
+type WebhookRepo struct {
+	*store
+}
+
+// Webhooks returns the webhook repository.
+func (r *Repo) Webhooks() *WebhookRepo {
+	return &WebhookRepo{store: r.store}
+}
+
+// ListSubscriptions returns the owner's subscriptions by ID.
+func (r *WebhookRepo) ListSubscriptions(ctx context.Context, ownerID int64) ([]*webhook.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var subs []*webhook.Subscription
+	for _, sub := range r.webhooks.subscriptions {
+		if sub.OwnerID == ownerID {
+			subs = append(subs, cloneSubscription(sub))
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+	return subs, nil
+}
+
+// CreateSubscription creates a new subscription.
+func (r *WebhookRepo) CreateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub.ID = r.webhooks.nextID
+	r.webhooks.nextID++
+	r.webhooks.subscriptions[sub.ID] = cloneSubscription(sub)
+	return nil
+}
+
+// FindSubscription finds an owner's subscription by its ID.
+func (r *WebhookRepo) FindSubscription(ctx context.Context, ownerID, id int64) (*webhook.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub, ok := r.webhooks.subscriptions[id]
+	if !ok || sub.OwnerID != ownerID {
+		return nil, webhook.ErrNotFound
+	}
+	return cloneSubscription(sub), nil
+}
+
+// UpdateSubscription stores the URL, events and active state of a
+// subscription.
+func (r *WebhookRepo) UpdateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.webhooks.subscriptions[sub.ID]
+	if !ok || stored.OwnerID != sub.OwnerID {
+		return webhook.ErrNotFound
+	}
+	c := cloneSubscription(sub)
+	c.Secret, c.CreatedAt = stored.Secret, stored.CreatedAt
+	r.webhooks.subscriptions[sub.ID] = c
+	return nil
+}
+
+// DeleteSubscription deletes an owner's subscription with its deliveries
+// and their attempts.
+func (r *WebhookRepo) DeleteSubscription(ctx context.Context, ownerID, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.webhooks.subscriptions[id]
+	if !ok || sub.OwnerID != ownerID {
+		return webhook.ErrNotFound
+	}
+	delete(r.webhooks.subscriptions, id)
+	r.removeDeliveries(func(d *webhook.Delivery) bool {
+		return d.Subscription.ID == id
+	})
+	return nil
+}
+
+// ListAttempts returns the latest attempts to deliver to a subscription,
+// newest first.
+func (r *WebhookRepo) ListAttempts(ctx context.Context, subscriptionID int64, limit int) ([]webhook.Attempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var attempts []webhook.Attempt
+	for i := len(r.webhooks.attempts) - 1; i >= 0 && len(attempts) < limit; i-- {
+		a := r.webhooks.attempts[i]
+		if a.SubscriptionID == subscriptionID {
+			a.Status = r.webhooks.deliveries[a.DeliveryID].Status
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts, nil
+}
+
+// Dispatch turns the events in the outbox into deliveries to the
+// subscriptions wanting them.
+func (r *WebhookRepo) Dispatch(ctx context.Context, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(r.webhooks.subscriptions))
+	for id := range r.webhooks.subscriptions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, e := range r.outbox {
+		if e.dispatched {
+			continue
+		}
+		for _, id := range ids {
+			sub := r.webhooks.subscriptions[id]
+			if sub.OwnerID != e.OwnerID || !sub.Active || !sub.Wants(e.Type) {
+				continue
+			}
+			d := &webhook.Delivery{
+				ID:            r.webhooks.nextDelivery,
+				Subscription:  sub,
+				Event:         e.Event,
+				Status:        webhook.StatusPending,
+				NextAttemptAt: at,
+				CreatedAt:     at,
+				UpdatedAt:     at,
+			}
+			r.webhooks.nextDelivery++
+			r.webhooks.deliveries[d.ID] = d
+		}
+		e.dispatched = true
+	}
+	return nil
+}
+
+// DueDeliveries returns the pending deliveries to active subscriptions due
+// at the given time, oldest first.
+func (r *WebhookRepo) DueDeliveries(ctx context.Context, at time.Time, limit int) ([]*webhook.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []*webhook.Delivery
+	for _, d := range r.webhooks.deliveries {
+		sub := r.webhooks.subscriptions[d.Subscription.ID]
+		if d.Status != webhook.StatusPending || d.NextAttemptAt.After(at) || !sub.Active {
+			continue
+		}
+		c := *d
+		c.Subscription = cloneSubscription(sub)
+		if e, ok := r.outboxEvent(d.Event.ID); ok {
+			c.Event = e.Event
+		}
+		deliveries = append(deliveries, &c)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt stores an attempt and the state of its delivery.
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, d *webhook.Delivery, a *webhook.Attempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.webhooks.deliveries[d.ID]
+	if !ok {
+		return nil
+	}
+	stored.Status, stored.Attempts = d.Status, d.Attempts
+	stored.NextAttemptAt, stored.UpdatedAt = d.NextAttemptAt, d.UpdatedAt
+
+	a.ID = r.webhooks.nextAttempt
+	r.webhooks.nextAttempt++
+	r.webhooks.attempts = append(r.webhooks.attempts, *a)
+	return nil
+}
+
+// Prune removes finished deliveries last updated before the given time,
+// and dispatched events without deliveries.
+func (r *WebhookRepo) Prune(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeDeliveries(func(d *webhook.Delivery) bool {
+		return d.Status != webhook.StatusPending && d.UpdatedAt.Before(before)
+	})
+	r.pruneOutbox()
+	return nil
+}
+
+// removeDeliveries removes the deliveries matching remove with their
+// attempts. The caller must hold r.mu.
+func (r *WebhookRepo) removeDeliveries(remove func(d *webhook.Delivery) bool) {
+	for id, d := range r.webhooks.deliveries {
+		if remove(d) {
+			delete(r.webhooks.deliveries, id)
+		}
+	}
+	attempts := r.webhooks.attempts[:0]
+	for _, a := range r.webhooks.attempts {
+		if _, ok := r.webhooks.deliveries[a.DeliveryID]; ok {
+			attempts = append(attempts, a)
+		}
+	}
+	r.webhooks.attempts = attempts
+}
+
+// cloneSubscription copies a subscription so callers cannot mutate stored
+// state.
+func cloneSubscription(sub *webhook.Subscription) *webhook.Subscription {
+	c := *sub
+	c.Events = append([]string{}, sub.Events...)
+	return &c
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// record appends a history entry for a write to t.
+func (r *Repo) record(ctx context.Context, t *todo.Todo, action string, changes map[string]todo.FieldChange, at time.Time) error {
+	var encoded sql.NullString
+	if len(changes) > 0 {
+		b, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		encoded = sql.NullString{String: string(b), Valid: true}
+	}
+	query := `INSERT INTO todo_history (todo_id, owner_id, actor_id, action, changes, version, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.conn.ExecContext(ctx, query, t.ID, t.OwnerID, auth.UserID(ctx), action, encoded, t.Version, at.UTC())
+	return err
+}
+
+// recordWhere appends a history entry without field changes for every todo
+// matching where. The entries take the todos' current versions.
+func (r *Repo) recordWhere(ctx context.Context, action string, at time.Time, where string, args ...interface{}) error {
+	query := `INSERT INTO todo_history (todo_id, owner_id, actor_id, action, version, created_at)
+		SELECT id, owner_id, ?, ?, version, ? FROM todos WHERE ` + where
+	args = append([]interface{}{auth.UserID(ctx), action, at.UTC()}, args...)
+	_, err := r.conn.ExecContext(ctx, query, args...)
+	return err
+}
+
+// History returns the history of an owner's todo, oldest first, including
+// one in the trash.
+func (r *Repo) History(ctx context.Context, ownerID, id int64) ([]todo.HistoryEntry, error) {
+	var exists bool
+	err := r.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE id = ? AND owner_id = ?)`, id, ownerID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, todo.ErrNotFound
+	}
+
+	query := `SELECT id, todo_id, owner_id, actor_id, action, changes, version, created_at FROM todo_history
+		WHERE todo_id = ? AND owner_id = ? ORDER BY id`
+	rows, err := r.conn.QueryContext(ctx, query, id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []todo.HistoryEntry
+	for rows.Next() {
+		var e todo.HistoryEntry
+		var changes sql.NullString
+		if err := rows.Scan(&e.ID, &e.TodoID, &e.OwnerID, &e.ActorID, &e.Action, &changes, &e.Version, &e.At); err != nil {
+			return nil, err
+		}
+		if changes.Valid {
+			if err := json.Unmarshal([]byte(changes.String), &e.Changes); err != nil {
+				return nil, fmt.Errorf("history entry %d: decoding changes: %w", e.ID, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
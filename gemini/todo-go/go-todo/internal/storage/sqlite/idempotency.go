@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/gemini/go-todo/internal/idempotency"
+)
+
+// IdempotencyStore is a SQLite implementation of the idempotency.Store.
+type IdempotencyStore struct {
+	db *sql.DB
+}
+
+// Idempotency returns an idempotency store backed by the same database.
+func (r *Repo) Idempotency() *IdempotencyStore {
+	return &IdempotencyStore{db: r.db}
+}
+
+// Reserve stores rec for a request in progress unless the client has an
+// unexpired record for the key that is not abandoned. Expired records of
+// all clients are deleted on the way.
+func (s *IdempotencyStore) Reserve(ctx context.Context, rec *idempotency.Record) (*idempotency.Record, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= ?", rec.CreatedAt.UTC()); err != nil {
+		return nil, err
+	}
+
+	stored := &idempotency.Record{}
+	var status sql.NullInt64
+	var header sql.NullString
+	var lockedUntil sql.NullTime
+	query := `SELECT user_id, key, fingerprint, status, header, body, created_at, expires_at, locked_until
+		FROM idempotency_keys WHERE user_id = ? AND key = ?`
+	err = tx.QueryRowContext(ctx, query, rec.UserID, rec.Key).Scan(&stored.UserID, &stored.Key, &stored.Fingerprint,
+		&status, &header, &stored.Body, &stored.CreatedAt, &stored.ExpiresAt, &lockedUntil)
+	if err == nil {
+		stored.Status = int(status.Int64)
+		stored.LockedUntil = lockedUntil.Time
+		if stored.Abandoned(rec.CreatedAt) {
+			query = `UPDATE idempotency_keys SET fingerprint = ?, created_at = ?, expires_at = ?, locked_until = ?
+				WHERE user_id = ? AND key = ?`
+			if _, err := tx.ExecContext(ctx, query, rec.Fingerprint, rec.CreatedAt.UTC(), rec.ExpiresAt.UTC(), rec.LockedUntil.UTC(), rec.UserID, rec.Key); err != nil {
+				return nil, err
+			}
+			return nil, tx.Commit()
+		}
+		if header.Valid {
+			if err := json.Unmarshal([]byte(header.String), &stored.Header); err != nil {
+				return nil, err
+			}
+		}
+		return stored, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	query = `INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at, expires_at, locked_until) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, query, rec.UserID, rec.Key, rec.Fingerprint, rec.CreatedAt.UTC(), rec.ExpiresAt.UTC(), rec.LockedUntil.UTC()); err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+// Complete stores the response to the request that reserved a key with rec.
+func (s *IdempotencyStore) Complete(ctx context.Context, rec *idempotency.Record) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE idempotency_keys SET status = ?, header = ?, body = ? WHERE user_id = ? AND key = ? AND created_at = ?"
+	res, err := s.db.ExecContext(ctx, query, rec.Status, string(header), rec.Body, rec.UserID, rec.Key, rec.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	return checkReserved(res)
+}
+
+// Release deletes the reservation made with rec.
+func (s *IdempotencyStore) Release(ctx context.Context, rec *idempotency.Record) error {
+	query := "DELETE FROM idempotency_keys WHERE user_id = ? AND key = ? AND created_at = ?"
+	res, err := s.db.ExecContext(ctx, query, rec.UserID, rec.Key, rec.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	return checkReserved(res)
+}
+
+// checkReserved maps a write to a reservation that touched no rows to
+// idempotency.ErrNotFound.
+func checkReserved(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return idempotency.ErrNotFound
+	}
+	return nil
+}
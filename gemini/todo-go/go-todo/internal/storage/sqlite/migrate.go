@@ -0,0 +1,259 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// requiresLine declares a compile option of SQLite an up script needs.
+var requiresLine = regexp.MustCompile(`(?m)^-- requires: (\w+)$`)
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+	// requires lists the compile options the up script needs.
+	requires []string
+}
+
+// Migrator applies versioned schema migrations and records them in the
+// schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+// NewMigrator creates a migrator for the migrations found in fsys.
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(body)
+			for _, r := range requiresLine.FindAllStringSubmatch(mig.up, -1) {
+				mig.requires = append(mig.requires, r[1])
+			}
+		} else {
+			mig.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.version, mig.name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// Latest returns the highest migration version known to the migrator.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// Version returns the current schema version of the database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Up applies all pending migrations in order, each in its own transaction.
+// It returns ErrSchemaTooNew if the database is ahead of the binary.
+//
+// An up script with a "-- requires: OPTION" line is only applied if SQLite
+// was built with that compile option. Otherwise the migration stays
+// pending, and the first binary whose SQLite has the option applies it,
+// after any later migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database at version %d, binary supports up to %d", ErrSchemaTooNew, current, m.Latest())
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range m.migrations {
+		if applied[mig.version] {
+			continue
+		}
+		ok, err := m.supported(ctx, mig)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, mig.up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				mig.version, mig.name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", mig.version, mig.name, err)
+		}
+	}
+	return nil
+}
+
+// applied returns the versions of the migrations applied to the database.
+func (m *Migrator) applied(ctx context.Context) (map[int]bool, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// supported reports whether SQLite was built with the compile options mig
+// requires.
+func (m *Migrator) supported(ctx context.Context, mig migration) (bool, error) {
+	for _, option := range mig.requires {
+		var used bool
+		if err := m.db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used(?)", option).Scan(&used); err != nil {
+			return false, err
+		}
+		if !used {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Down rolls back the given number of most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	for i := 0; i < steps; i++ {
+		current, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return nil
+		}
+
+		mig, ok := m.find(current)
+		if !ok {
+			return fmt.Errorf("%w: no migration for version %d", ErrSchemaTooNew, current)
+		}
+		if mig.down == "" {
+			return fmt.Errorf("migration %d_%s has no down script", mig.version, mig.name)
+		}
+
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, mig.down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", mig.version, mig.name, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) (migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.version == version {
+			return mig, true
+		}
+	}
+	return migration{}, false
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+func (m *Migrator) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
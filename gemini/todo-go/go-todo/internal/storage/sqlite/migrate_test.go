@@ -0,0 +1,173 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gemini/go-todo/internal/storage/sqlite"
+	"github.com/gemini/go-todo/migrations"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		t.Fatalf("failed to query sqlite_master: %v", err)
+	}
+	return n > 0
+}
+
+var testMigrations = fstest.MapFS{
+	"001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER PRIMARY KEY);")},
+	"001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER PRIMARY KEY);")},
+	"002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+}
+
+func TestMigrator_Up(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies the embedded migrations", func(t *testing.T) {
+		db := openTestDB(t)
+		m, err := sqlite.NewMigrator(db, migrations.FS)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		version, err := m.Version(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if version != m.Latest() {
+			t.Errorf("expected version %d, got %d", m.Latest(), version)
+		}
+		if !tableExists(t, db, "todos") {
+			t.Errorf("expected todos table to exist")
+		}
+	})
+
+	t.Run("is idempotent", func(t *testing.T) {
+		db := openTestDB(t)
+		m, _ := sqlite.NewMigrator(db, testMigrations)
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected error on second run: %v", err)
+		}
+		if version, _ := m.Version(ctx); version != 2 {
+			t.Errorf("expected version 2, got %d", version)
+		}
+	})
+
+	t.Run("rolls back a failing migration", func(t *testing.T) {
+		db := openTestDB(t)
+		fsys := fstest.MapFS{
+			"001_create_a.up.sql": testMigrations["001_create_a.up.sql"],
+			"002_broken.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER); NOT VALID SQL;")},
+		}
+		m, _ := sqlite.NewMigrator(db, fsys)
+		if err := m.Up(ctx); err == nil {
+			t.Fatalf("expected error")
+		}
+		if version, _ := m.Version(ctx); version != 1 {
+			t.Errorf("expected version 1, got %d", version)
+		}
+		if tableExists(t, db, "c") {
+			t.Errorf("expected partial migration to be rolled back")
+		}
+	})
+
+	t.Run("leaves migrations SQLite cannot run pending", func(t *testing.T) {
+		db := openTestDB(t)
+		fsys := fstest.MapFS{
+			"001_create_a.up.sql": testMigrations["001_create_a.up.sql"],
+			"002_create_b.up.sql": {Data: []byte("-- requires: ENABLE_NO_SUCH_OPTION\nCREATE TABLE b (id INTEGER PRIMARY KEY);")},
+			"003_create_c.up.sql": {Data: []byte("CREATE TABLE c (id INTEGER PRIMARY KEY);")},
+		}
+		m, _ := sqlite.NewMigrator(db, fsys)
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if version, _ := m.Version(ctx); version != 3 {
+			t.Errorf("expected version 3, got %d", version)
+		}
+		if tableExists(t, db, "b") || !tableExists(t, db, "c") {
+			t.Errorf("expected only the migration SQLite can run to be applied")
+		}
+
+		// A binary whose SQLite has the option applies it later.
+		fsys["002_create_b.up.sql"] = &fstest.MapFile{Data: []byte("-- requires: ENABLE_FTS5\nCREATE TABLE b (id INTEGER PRIMARY KEY);")}
+		var fts5 bool
+		db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+		m, _ = sqlite.NewMigrator(db, fsys)
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tableExists(t, db, "b") != fts5 {
+			t.Errorf("expected the migration to be applied only with FTS5")
+		}
+	})
+
+	t.Run("refuses a database newer than the binary", func(t *testing.T) {
+		db := openTestDB(t)
+		m, _ := sqlite.NewMigrator(db, testMigrations)
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		older, _ := sqlite.NewMigrator(db, fstest.MapFS{
+			"001_create_a.up.sql": testMigrations["001_create_a.up.sql"],
+		})
+		if err := older.Up(ctx); !errors.Is(err, sqlite.ErrSchemaTooNew) {
+			t.Errorf("expected error %v, got %v", sqlite.ErrSchemaTooNew, err)
+		}
+	})
+}
+
+func TestMigrator_Down(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, _ := sqlite.NewMigrator(db, testMigrations)
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version, _ := m.Version(ctx); version != 1 {
+		t.Errorf("expected version 1, got %d", version)
+	}
+	if tableExists(t, db, "b") {
+		t.Errorf("expected table b to be dropped")
+	}
+	if !tableExists(t, db, "a") {
+		t.Errorf("expected table a to remain")
+	}
+
+	if err := m.Down(ctx, 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version, _ := m.Version(ctx); version != 0 {
+		t.Errorf("expected version 0, got %d", version)
+	}
+}
@@ -0,0 +1,23 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// AppendOutbox stores events in the outbox.
+func (r *Repo) AppendOutbox(ctx context.Context, events []todo.Event) error {
+	query := "INSERT INTO outbox (owner_id, type, todo, created_at) VALUES (?, ?, ?, ?)"
+	for _, e := range events {
+		b, err := json.Marshal(e.Todo)
+		if err != nil {
+			return err
+		}
+		if _, err := r.conn.ExecContext(ctx, query, e.OwnerID, e.Type, string(b), e.At.UTC()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// projectColumns lists the columns read by scanProject, in order.
+const projectColumns = "id, owner_id, name, archived, created_at, updated_at"
+
+func scanProject(s scanner) (*todo.Project, error) {
+	p := &todo.Project{}
+	err := s.Scan(&p.ID, &p.OwnerID, &p.Name, &p.Archived, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListProjects returns the owner's projects by name.
+func (r *Repo) ListProjects(ctx context.Context, ownerID int64) ([]*todo.Project, error) {
+	query := "SELECT " + projectColumns + " FROM projects WHERE owner_id = ? ORDER BY name, id"
+	rows, err := r.conn.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []*todo.Project
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// CreateProject creates a new project.
+func (r *Repo) CreateProject(ctx context.Context, p *todo.Project) error {
+	query := "INSERT INTO projects (owner_id, name, archived, created_at, updated_at) VALUES (?, ?, ?, ?, ?)"
+	res, err := r.conn.ExecContext(ctx, query, p.OwnerID, p.Name, p.Archived, p.CreatedAt.UTC(), p.UpdatedAt.UTC())
+	if isUniqueViolation(err) {
+		return todo.ErrProjectExists
+	}
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	p.ID = id
+	return nil
+}
+
+// FindProject finds an owner's project by its ID.
+func (r *Repo) FindProject(ctx context.Context, ownerID, id int64) (*todo.Project, error) {
+	query := "SELECT " + projectColumns + " FROM projects WHERE id = ? AND owner_id = ?"
+	p, err := scanProject(r.conn.QueryRowContext(ctx, query, id, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, todo.ErrProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateProject stores the name and archived state of a project.
+func (r *Repo) UpdateProject(ctx context.Context, p *todo.Project) error {
+	query := "UPDATE projects SET name = ?, archived = ?, updated_at = ? WHERE id = ? AND owner_id = ?"
+	res, err := r.conn.ExecContext(ctx, query, p.Name, p.Archived, p.UpdatedAt.UTC(), p.ID, p.OwnerID)
+	if isUniqueViolation(err) {
+		return todo.ErrProjectExists
+	}
+	if err != nil {
+		return err
+	}
+	return projectAffected(res)
+}
+
+// DeleteProject deletes an owner's project and moves its todos out of it.
+func (r *Repo) DeleteProject(ctx context.Context, ownerID, id int64) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		res, err := tx.conn.ExecContext(ctx, "DELETE FROM projects WHERE id = ? AND owner_id = ?", id, ownerID)
+		if err != nil {
+			return err
+		}
+		if err := projectAffected(res); err != nil {
+			return err
+		}
+		_, err = tx.conn.ExecContext(ctx, "UPDATE todos SET project_id = NULL, version = version + 1 WHERE project_id = ? AND owner_id = ?", id, ownerID)
+		return err
+	})
+}
+
+func projectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return todo.ErrProjectNotFound
+	}
+	return nil
+}
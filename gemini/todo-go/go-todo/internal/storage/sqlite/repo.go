@@ -3,34 +3,101 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/gemini/go-todo/internal/rank"
 	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/migrations"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Repo is a SQLite implementation of the todo.Repository.
 type Repo struct {
 	db *sql.DB
+	// conn is db, or the transaction the repository is bound to.
+	conn dbtx
+	tx   *sql.Tx
+	// fts is set if the database has a full-text search index.
+	fts bool
 }
 
-// NewRepo creates a new SQLite repository. It also runs migrations.
-func NewRepo(dsn string) (*Repo, error) {
+// dsnDefaults are connection options applied unless the DSN sets them:
+// foreign key enforcement, waiting on locks instead of failing with
+// SQLITE_BUSY, and taking the write lock when a transaction begins.
+var dsnDefaults = []string{"_foreign_keys=on", "_busy_timeout=5000", "_txlock=immediate"}
+
+// Open opens the SQLite database and verifies the connection.
+func Open(dsn string) (*sql.DB, error) {
+	for _, opt := range dsnDefaults {
+		key, _, _ := strings.Cut(opt, "=")
+		if strings.Contains(dsn, key+"=") {
+			continue
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + opt
+	}
+
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewRepo creates a new SQLite repository. It also runs migrations.
+func NewRepo(dsn string) (*Repo, error) {
+	db, err := Open(dsn)
+	if err != nil {
 		return nil, err
 	}
 
 	if err := runMigrations(db); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
+	fts, err := searchIndex(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	return &Repo{db: db}, nil
+	return &Repo{db: db, conn: tracedConn{db}, fts: fts}, nil
+}
+
+// Users returns a user repository backed by the same database.
+func (r *Repo) Users() *UserRepo {
+	return &UserRepo{db: r.db}
+}
+
+// DB returns the underlying database, e.g. to collect the statistics of its
+// connection pool.
+func (r *Repo) DB() *sql.DB {
+	return r.db
+}
+
+// Ping verifies that the database is reachable.
+func (r *Repo) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// SchemaVersion returns the version of the last migration applied to the
+// database.
+func (r *Repo) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
 }
 
 // Close closes the database connection.
@@ -39,42 +106,236 @@ func (r *Repo) Close() error {
 }
 
 func runMigrations(db *sql.DB) error {
-	migration, err := os.ReadFile("migrations/001_create_todos.sql")
+	m, err := NewMigrator(db, migrations.FS)
 	if err != nil {
 		return err
 	}
-	if _, err := db.Exec(string(migration)); err != nil {
-		return err
-	}
-	return nil
+	return m.Up(context.Background())
 }
 
-// Create creates a new todo.
-func (r *Repo) Create(ctx context.Context, t *todo.Todo) error {
-	query := `INSERT INTO todos (title, description, completed, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
-	res, err := r.db.ExecContext(ctx, query, t.Title, t.Description, t.Completed, t.CreatedAt, t.UpdatedAt)
+// tagSeparator joins tag names in the tags column of todoColumns. Tag
+// names cannot contain control characters.
+const tagSeparator = "\x1f"
+
+// todoColumns lists the columns read by scanTodo, in order.
+const todoColumns = `id, owner_id, title, description, completed, due_at, priority, parent_id, project_id, position, auto_complete, recurrence,
+	created_at, updated_at, deleted_at, version,
+	(SELECT group_concat(tg.name, char(31)) FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE tt.todo_id = todos.id),
+	(SELECT COUNT(*) FROM todos sub WHERE sub.parent_id = todos.id AND sub.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM todos sub WHERE sub.parent_id = todos.id AND sub.deleted_at IS NULL AND sub.completed)`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTodo scans the columns listed in todoColumns, followed by any extra
+// columns into extra.
+func scanTodo(s scanner, extra ...interface{}) (*todo.Todo, error) {
+	t := &todo.Todo{}
+	var due, deletedAt sql.NullTime
+	var parentID, projectID sql.NullInt64
+	var tags sql.NullString
+	var recurrence sql.NullString
+	var progress todo.Progress
+	dest := []interface{}{&t.ID, &t.OwnerID, &t.Title, &t.Description, &t.Completed, &due, &t.Priority, &parentID, &projectID, &t.Position,
+		&t.AutoComplete, &recurrence, &t.CreatedAt, &t.UpdatedAt, &deletedAt, &t.Version, &tags, &progress.Total, &progress.Done}
+	err := s.Scan(append(dest, extra...)...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
+	if recurrence.Valid {
+		if err := json.Unmarshal([]byte(recurrence.String), &t.Recurrence); err != nil {
+			return nil, fmt.Errorf("todo %d: decoding recurrence: %w", t.ID, err)
+		}
+	}
+	t.ParentID = parentID.Int64
+	t.ProjectID = projectID.Int64
+	if progress.Total > 0 {
+		t.Progress = &progress
 	}
-	t.ID = id
-	return nil
+	if due.Valid {
+		t.DueAt = &due.Time
+	}
+	if deletedAt.Valid {
+		t.DeletedAt = &deletedAt.Time
+	}
+	t.Tags = []string{}
+	if tags.Valid {
+		t.Tags = strings.Split(tags.String, tagSeparator)
+		sort.Strings(t.Tags)
+	}
+	return t, nil
 }
 
-// FindAll returns all todos.
-func (r *Repo) FindAll(ctx context.Context, completed *bool) ([]*todo.Todo, error) {
-	query := "SELECT id, title, description, completed, created_at, updated_at FROM todos"
-	var args []interface{}
-	if completed != nil {
-		query += " WHERE completed = ?"
-		args = append(args, *completed)
+// Create creates a new todo. Todos without a position are placed after the
+// owner's other todos.
+func (r *Repo) Create(ctx context.Context, t *todo.Todo) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		recurrence, err := recurrenceJSON(t.Recurrence)
+		if err != nil {
+			return err
+		}
+		position := t.Position
+		if position == "" {
+			var last string
+			err := tx.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(position), '') FROM todos WHERE owner_id = ?", t.OwnerID).Scan(&last)
+			if err != nil {
+				return err
+			}
+			if position, err = rank.Between(last, ""); err != nil {
+				return err
+			}
+		}
+		query := `INSERT INTO todos (owner_id, title, description, completed, due_at, priority, parent_id, project_id, position, auto_complete, recurrence,
+			created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`
+		res, err := tx.conn.ExecContext(ctx, query, t.OwnerID, t.Title, t.Description, t.Completed, nullTime(t.DueAt), t.Priority,
+			nullID(t.ParentID), nullID(t.ProjectID), position, t.AutoComplete, recurrence, t.CreatedAt.UTC(), t.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := tx.setTags(ctx, t.OwnerID, id, t.Tags); err != nil {
+			return err
+		}
+		t.ID = id
+		t.Position = position
+		t.Version = 1
+		return tx.record(ctx, t, todo.ActionCreated, nil, t.CreatedAt)
+	})
+}
+
+// sortColumns maps sort fields to the columns they order by.
+var sortColumns = map[todo.SortField]string{
+	todo.SortCreated:  "created_at",
+	todo.SortUpdated:  "updated_at",
+	todo.SortTitle:    "title",
+	todo.SortPriority: "priority",
+	todo.SortPosition: "position",
+}
+
+// FindAll returns the todos matching opts.
+func (r *Repo) FindAll(ctx context.Context, opts todo.ListOptions) ([]*todo.Todo, error) {
+	where := []string{"owner_id = ?", "deleted_at IS NULL"}
+	args := []interface{}{opts.OwnerID}
+	if opts.Trashed {
+		where[1] = "deleted_at IS NOT NULL AND (parent_id IS NULL OR parent_id NOT IN (SELECT id FROM todos WHERE owner_id = ? AND deleted_at IS NOT NULL))"
+		args = append(args, opts.OwnerID)
+	}
+	if opts.ParentID != nil {
+		if *opts.ParentID == 0 {
+			where = append(where, "parent_id IS NULL")
+		} else {
+			where = append(where, "parent_id = ?")
+			args = append(args, *opts.ParentID)
+		}
+	}
+	if opts.ProjectID != nil {
+		if *opts.ProjectID == 0 {
+			where = append(where, "project_id IS NULL")
+		} else {
+			where = append(where, "project_id = ?")
+			args = append(args, *opts.ProjectID)
+		}
+	}
+	if opts.ExcludesArchived() {
+		where = append(where, "(project_id IS NULL OR project_id NOT IN (SELECT id FROM projects WHERE owner_id = ? AND archived))")
+		args = append(args, opts.OwnerID)
+	}
+	if opts.Completed != nil {
+		where = append(where, "completed = ?")
+		args = append(args, *opts.Completed)
+	}
+	if opts.CreatedAfter != nil {
+		where = append(where, "created_at > ?")
+		args = append(args, opts.CreatedAfter.UTC())
+	}
+	if opts.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, opts.CreatedBefore.UTC())
+	}
+	if opts.UpdatedAfter != nil {
+		where = append(where, "updated_at > ?")
+		args = append(args, opts.UpdatedAfter.UTC())
+	}
+	if opts.UpdatedBefore != nil {
+		where = append(where, "updated_at < ?")
+		args = append(args, opts.UpdatedBefore.UTC())
+	}
+	if opts.DueAfter != nil {
+		where = append(where, "due_at > ?")
+		args = append(args, opts.DueAfter.UTC())
+	}
+	if opts.DueBefore != nil {
+		where = append(where, "due_at < ?")
+		args = append(args, opts.DueBefore.UTC())
+	}
+	if opts.Overdue != nil {
+		overdue := "(completed = 0 AND due_at IS NOT NULL AND due_at < ?)"
+		if !*opts.Overdue {
+			overdue = "NOT " + overdue
+		}
+		where = append(where, overdue)
+		args = append(args, opts.Now.UTC())
+	}
+
+	col, ok := sortColumns[opts.Sort]
+	if !ok {
+		col = sortColumns[todo.SortCreated]
+	}
+	from, columns := "todos", todoColumns
+	if opts.Query != "" {
+		search := r.search(opts.Query)
+		from, columns = search.from, columns+", "+search.columns
+		where = append(where, search.where...)
+		args = append(args, search.args...)
+		if opts.Sort == todo.SortRelevance {
+			col = search.rank
+		}
+	}
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if len(opts.Tags) > 0 {
+		clause := "id IN (SELECT tt.todo_id FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE tg.owner_id = ? AND tg.name IN (?" +
+			strings.Repeat(", ?", len(opts.Tags)-1) + ")"
+		args = append(args, opts.OwnerID)
+		for _, tag := range opts.Tags {
+			args = append(args, tag)
+		}
+		if opts.MatchAllTags {
+			clause += " GROUP BY tt.todo_id HAVING COUNT(*) = ?"
+			args = append(args, len(opts.Tags))
+		}
+		where = append(where, clause+")")
+	}
+	if c := opts.After; c != nil {
+		var key interface{} = c.Time.UTC()
+		switch opts.Sort {
+		case todo.SortTitle:
+			key = c.Title
+		case todo.SortPriority:
+			key = *c.Priority
+		case todo.SortPosition:
+			key = c.Position
+		case todo.SortRelevance:
+			key = c.Rank
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", col, cmp))
+		args = append(args, key, key, c.ID)
 	}
-	query += " ORDER BY id"
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	query := "SELECT " + columns + " FROM " + from + " WHERE " + strings.Join(where, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", col, dir, dir)
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := r.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -82,23 +343,28 @@ func (r *Repo) FindAll(ctx context.Context, completed *bool) ([]*todo.Todo, erro
 
 	var todos []*todo.Todo
 	for rows.Next() {
-		t := &todo.Todo{}
-		err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Completed, &t.CreatedAt, &t.UpdatedAt)
+		var extra []interface{}
+		var match todo.Match
+		if opts.Query != "" {
+			extra = []interface{}{&match.Rank, &match.Snippet}
+		}
+		t, err := scanTodo(rows, extra...)
 		if err != nil {
 			return nil, err
 		}
+		if opts.Query != "" {
+			match.Snippet = escapeSnippet(match.Snippet)
+			t.Match = &match
+		}
 		todos = append(todos, t)
 	}
-	return todos, nil
+	return todos, rows.Err()
 }
 
-// FindByID finds a todo by its ID.
-func (r *Repo) FindByID(ctx context.Context, id int64) (*todo.Todo, error) {
-	query := "SELECT id, title, description, completed, created_at, updated_at FROM todos WHERE id = ?"
-	row := r.db.QueryRowContext(ctx, query, id)
-
-	t := &todo.Todo{}
-	err := row.Scan(&t.ID, &t.Title, &t.Description, &t.Completed, &t.CreatedAt, &t.UpdatedAt)
+// FindByID finds an owner's todo by its ID.
+func (r *Repo) FindByID(ctx context.Context, ownerID, id int64) (*todo.Todo, error) {
+	query := "SELECT " + todoColumns + " FROM todos WHERE id = ? AND owner_id = ? AND deleted_at IS NULL"
+	t, err := scanTodo(r.conn.QueryRowContext(ctx, query, id, ownerID))
 	if err == sql.ErrNoRows {
 		return nil, todo.ErrNotFound
 	}
@@ -108,29 +374,188 @@ func (r *Repo) FindByID(ctx context.Context, id int64) (*todo.Todo, error) {
 	return t, nil
 }
 
-// Update updates a todo.
+// Update updates a todo if the stored version still equals t.Version, and
+// then advances t.Version. It returns todo.ErrConflict if the todo has been
+// modified since it was read.
 func (r *Repo) Update(ctx context.Context, t *todo.Todo) error {
-	query := "UPDATE todos SET title = ?, description = ?, completed = ?, updated_at = ? WHERE id = ?"
-	_, err := r.db.ExecContext(ctx, query, t.Title, t.Description, t.Completed, t.UpdatedAt, t.ID)
+	return r.inTx(ctx, func(tx *Repo) error {
+		recurrence, err := recurrenceJSON(t.Recurrence)
+		if err != nil {
+			return err
+		}
+		stored, err := tx.FindByID(ctx, t.OwnerID, t.ID)
+		if err != nil {
+			return err
+		}
+		changes, err := todo.Diff(stored, t)
+		if err != nil {
+			return err
+		}
+		query := `UPDATE todos SET title = ?, description = ?, completed = ?, due_at = ?, priority = ?, project_id = ?, position = ?,
+			auto_complete = ?, recurrence = ?, updated_at = ?, version = version + 1 WHERE id = ? AND owner_id = ? AND version = ? AND deleted_at IS NULL`
+		res, err := tx.conn.ExecContext(ctx, query, t.Title, t.Description, t.Completed, nullTime(t.DueAt), t.Priority, nullID(t.ProjectID),
+			t.Position, t.AutoComplete, recurrence, t.UpdatedAt.UTC(), t.ID, t.OwnerID, t.Version)
+		if err != nil {
+			return err
+		}
+		if err := tx.checkAffected(ctx, res, t.OwnerID, t.ID); err != nil {
+			return err
+		}
+		if err := tx.setTags(ctx, t.OwnerID, t.ID, t.Tags); err != nil {
+			return err
+		}
+		t.Version++
+		return tx.record(ctx, t, todo.ActionUpdated, changes, t.UpdatedAt)
+	})
+}
+
+// Delete moves an owner's todo and its subtasks to the trash. A non-zero
+// version makes the delete conditional on the stored version, as for
+// Update.
+func (r *Repo) Delete(ctx context.Context, ownerID, id, version int64, at time.Time) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		query := `UPDATE todos SET deleted_at = ?, version = version + 1
+			WHERE id = ? AND owner_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`
+		res, err := tx.conn.ExecContext(ctx, query, at.UTC(), id, ownerID, version, version)
+		if err != nil {
+			return err
+		}
+		if err := tx.checkAffected(ctx, res, ownerID, id); err != nil {
+			return err
+		}
+		query = "UPDATE todos SET deleted_at = ?, version = version + 1 WHERE parent_id = ? AND owner_id = ? AND deleted_at IS NULL"
+		if _, err := tx.conn.ExecContext(ctx, query, at.UTC(), id, ownerID); err != nil {
+			return err
+		}
+		return tx.recordWhere(ctx, todo.ActionDeleted, at, "(id = ? OR parent_id = ?) AND deleted_at = ?", id, id, at.UTC())
+	})
+}
+
+// Restore takes an owner's todo out of the trash together with the subtasks
+// deleted along with it.
+func (r *Repo) Restore(ctx context.Context, ownerID, id int64, at time.Time) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		query := `SELECT EXISTS (SELECT 1 FROM todos WHERE id = ? AND owner_id = ? AND deleted_at IS NOT NULL
+			AND (parent_id IS NULL OR parent_id NOT IN (SELECT id FROM todos WHERE deleted_at IS NOT NULL)))`
+		var trashed bool
+		if err := tx.conn.QueryRowContext(ctx, query, id, ownerID).Scan(&trashed); err != nil {
+			return err
+		}
+		if !trashed {
+			return todo.ErrNotFound
+		}
+
+		// The subtasks deleted along with the todo share its deleted_at.
+		query = "SELECT id FROM todos WHERE parent_id = ? AND deleted_at = (SELECT deleted_at FROM todos WHERE id = ?)"
+		rows, err := tx.conn.QueryContext(ctx, query, id, id)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var subtaskID int64
+			if err := rows.Scan(&subtaskID); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, subtaskID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, todoID := range append(ids, id) {
+			_, err := tx.conn.ExecContext(ctx, "UPDATE todos SET deleted_at = NULL, version = version + 1 WHERE id = ?", todoID)
+			if err != nil {
+				return err
+			}
+			if err := tx.recordWhere(ctx, todo.ActionRestored, at, "id = ?", todoID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Apply performs writes in order in a single transaction.
+func (r *Repo) Apply(ctx context.Context, writes []todo.Write, at time.Time) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		for i, w := range writes {
+			var err error
+			switch w.Op {
+			case todo.OpCreate:
+				err = tx.Create(ctx, w.Todo)
+			case todo.OpUpdate:
+				err = tx.Update(ctx, w.Todo)
+			case todo.OpDelete:
+				err = tx.Delete(ctx, w.Todo.OwnerID, w.Todo.ID, w.Todo.Version, at)
+			default:
+				err = todo.ErrUnknownOp
+			}
+			if err != nil {
+				return &todo.BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// Purge permanently removes the todos moved to the trash before the given
+// time. Subtasks are never in the trash for longer than their parent, so
+// they go with it.
+func (r *Repo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.conn.ExecContext(ctx, "DELETE FROM todos WHERE deleted_at < ?", before.UTC())
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return res.RowsAffected()
 }
 
-// Delete deletes a todo by its ID.
-func (r *Repo) Delete(ctx context.Context, id int64) error {
-	query := "DELETE FROM todos WHERE id = ?"
-	res, err := r.db.ExecContext(ctx, query, id)
+// checkAffected maps a conditional write that touched no rows to
+// todo.ErrNotFound or todo.ErrConflict.
+func (r *Repo) checkAffected(ctx context.Context, res sql.Result, ownerID, id int64) error {
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := res.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM todos WHERE id = ? AND owner_id = ? AND deleted_at IS NULL)"
+	err = r.conn.QueryRowContext(ctx, query, id, ownerID).Scan(&exists)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return todo.ErrNotFound
+	if exists {
+		return todo.ErrConflict
+	}
+	return todo.ErrNotFound
+}
+
+// nullTime converts an optional time to a UTC value for storage.
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullID converts an optional reference, where 0 means none, for storage.
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// recurrenceJSON encodes an optional recurrence for storage.
+func recurrenceJSON(r *todo.Recurrence) (interface{}, error) {
+	if r == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return string(b), nil
 }
@@ -0,0 +1,978 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/idempotency"
+	"github.com/gemini/go-todo/internal/rank"
+	"github.com/gemini/go-todo/internal/storage/sqlite"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/user"
+	"github.com/gemini/go-todo/internal/webhook"
+)
+
+func newTestRepo(t *testing.T) *sqlite.Repo {
+	t.Helper()
+	repo, err := sqlite.NewRepo(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatalf("failed to create repo: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestRepo_FindAll(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, title := range []string{"b", "d", "a", "e", "c"} {
+		created := base.Add(time.Duration(i) * time.Hour)
+		td := &todo.Todo{Title: title, Completed: i%2 == 0, CreatedAt: created, UpdatedAt: created}
+		if err := repo.Create(ctx, td); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	titles := func(todos []*todo.Todo) string {
+		var s string
+		for _, td := range todos {
+			s += td.Title
+		}
+		return s
+	}
+
+	t.Run("orders and pages with a cursor", func(t *testing.T) {
+		opts := todo.ListOptions{Sort: todo.SortTitle, Desc: true, Limit: 2}
+		first, err := repo.FindAll(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := titles(first); got != "ed" {
+			t.Fatalf("expected first page %q, got %q", "ed", got)
+		}
+
+		c := todo.CursorFor(first[1], opts.Sort, opts.Desc)
+		opts.After = &c
+		opts.Limit = 0
+		rest, err := repo.FindAll(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := titles(rest); got != "cba" {
+			t.Errorf("expected remaining %q, got %q", "cba", got)
+		}
+	})
+
+	t.Run("filters by completion and creation time", func(t *testing.T) {
+		completed := true
+		after := base.Add(30 * time.Minute)
+		todos, err := repo.FindAll(ctx, todo.ListOptions{Completed: &completed, CreatedAfter: &after})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := titles(todos); got != "ac" {
+			t.Errorf("expected %q, got %q", "ac", got)
+		}
+	})
+}
+
+func TestRepo_Update(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	td := &todo.Todo{Title: "Original", CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, td); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stale := *td
+
+	td.Title = "First"
+	if err := repo.Update(ctx, td); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if td.Version != 2 {
+		t.Errorf("expected version 2, got %d", td.Version)
+	}
+
+	stale.Title = "Second"
+	if err := repo.Update(ctx, &stale); err != todo.ErrConflict {
+		t.Errorf("expected error %v, got %v", todo.ErrConflict, err)
+	}
+	if err := repo.Delete(ctx, 0, td.ID, 1, time.Now()); err != todo.ErrConflict {
+		t.Errorf("expected error %v, got %v", todo.ErrConflict, err)
+	}
+	if err := repo.Delete(ctx, 0, td.ID, 2, time.Now()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := repo.Delete(ctx, 0, td.ID, 0, time.Now()); err != todo.ErrNotFound {
+		t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+	}
+}
+
+func TestRepo_Ownership(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	td := &todo.Todo{OwnerID: 1, Title: "Mine", CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, td); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := repo.FindByID(ctx, 2, td.ID); err != todo.ErrNotFound {
+		t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+	}
+	other := *td
+	other.OwnerID = 2
+	if err := repo.Update(ctx, &other); err != todo.ErrNotFound {
+		t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+	}
+	if err := repo.Delete(ctx, 2, td.ID, 0, time.Now()); err != todo.ErrNotFound {
+		t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+	}
+	if todos, _ := repo.FindAll(ctx, todo.ListOptions{OwnerID: 2}); len(todos) != 0 {
+		t.Errorf("expected no todos for another owner, got %d", len(todos))
+	}
+	if _, err := repo.FindByID(ctx, 1, td.ID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestUserRepo_Create(t *testing.T) {
+	users := newTestRepo(t).Users()
+	ctx := context.Background()
+
+	u := &user.User{Email: "alice@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	if err := users.Create(ctx, u); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.Create(ctx, &user.User{Email: "alice@example.com", PasswordHash: "hash", CreatedAt: time.Now()}); err != user.ErrEmailTaken {
+		t.Errorf("expected error %v, got %v", user.ErrEmailTaken, err)
+	}
+
+	found, err := users.FindByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found.ID != u.ID || found.PasswordHash != "hash" {
+		t.Errorf("unexpected user %+v", found)
+	}
+}
+
+func TestRepo_Tags(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	create := func(title string, tags ...string) *todo.Todo {
+		td := &todo.Todo{Title: title, Tags: tags, CreatedAt: now, UpdatedAt: now}
+		if err := repo.Create(ctx, td); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return td
+	}
+	both := create("both", "home", "errand")
+	create("home", "home")
+	create("none")
+
+	t.Run("filters by any or all tags", func(t *testing.T) {
+		todos, err := repo.FindAll(ctx, todo.ListOptions{Tags: []string{"home", "errand"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(todos) != 2 {
+			t.Errorf("expected 2 todos, got %d", len(todos))
+		}
+		todos, _ = repo.FindAll(ctx, todo.ListOptions{Tags: []string{"home", "errand"}, MatchAllTags: true})
+		if len(todos) != 1 || todos[0].ID != both.ID {
+			t.Errorf("expected only the todo with both tags, got %d todos", len(todos))
+		}
+	})
+
+	t.Run("replaces tags on update", func(t *testing.T) {
+		both.Tags = []string{"errand", "later"}
+		if err := repo.Update(ctx, both); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := repo.FindByID(ctx, 0, both.ID)
+		if len(got.Tags) != 2 || got.Tags[0] != "errand" || got.Tags[1] != "later" {
+			t.Errorf("expected tags [errand later], got %v", got.Tags)
+		}
+	})
+
+	t.Run("renames and deletes tags", func(t *testing.T) {
+		if err := repo.RenameTag(ctx, 0, "errand", "later"); !errors.Is(err, todo.ErrTagExists) {
+			t.Errorf("expected error %v, got %v", todo.ErrTagExists, err)
+		}
+		if err := repo.RenameTag(ctx, 0, "home", "house"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := repo.DeleteTag(ctx, 0, "errand"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := repo.DeleteTag(ctx, 0, "errand"); !errors.Is(err, todo.ErrTagNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrTagNotFound, err)
+		}
+
+		got, _ := repo.FindByID(ctx, 0, both.ID)
+		if len(got.Tags) != 1 || got.Tags[0] != "later" {
+			t.Errorf("expected tags [later], got %v", got.Tags)
+		}
+		if got.Version != both.Version+1 {
+			t.Errorf("expected version %d, got %d", both.Version+1, got.Version)
+		}
+
+		tags, err := repo.ListTags(ctx, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []todo.Tag{{Name: "house", Count: 1}, {Name: "later", Count: 1}}
+		if len(tags) != 2 || tags[0] != want[0] || tags[1] != want[1] {
+			t.Errorf("expected tags %v, got %v", want, tags)
+		}
+	})
+}
+
+func TestRepo_DueAndPriority(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	create := func(title string, due *time.Time, priority int, completed bool) *todo.Todo {
+		td := &todo.Todo{Title: title, DueAt: due, Priority: priority, Completed: completed, CreatedAt: now, UpdatedAt: now}
+		if err := repo.Create(ctx, td); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return td
+	}
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	late := create("late", &past, todo.PriorityHigh, false)
+	create("done", &past, todo.PriorityLow, true)
+	create("soon", &future, todo.PriorityMedium, false)
+	create("undated", nil, todo.PriorityNone, false)
+
+	titles := func(todos []*todo.Todo) string {
+		var s string
+		for _, td := range todos {
+			s += td.Title + " "
+		}
+		return strings.TrimSpace(s)
+	}
+
+	t.Run("round-trips due dates", func(t *testing.T) {
+		got, err := repo.FindByID(ctx, 0, late.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.DueAt == nil || !got.DueAt.Equal(past) || got.Priority != todo.PriorityHigh {
+			t.Errorf("expected due %v and priority %d, got %v and %d", past, todo.PriorityHigh, got.DueAt, got.Priority)
+		}
+	})
+
+	t.Run("round-trips recurrences", func(t *testing.T) {
+		late.Recurrence = &todo.Recurrence{Rule: "FREQ=WEEKLY", TimeZone: "Europe/Berlin", Start: past, Occurrence: 3}
+		if err := repo.Update(ctx, late); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := repo.FindByID(ctx, 0, late.ID)
+		if got.Recurrence == nil || got.Recurrence.Rule != "FREQ=WEEKLY" || got.Recurrence.Occurrence != 3 || !got.Recurrence.Start.Equal(past) {
+			t.Errorf("expected recurrence %+v, got %+v", late.Recurrence, got.Recurrence)
+		}
+	})
+
+	t.Run("filters overdue and due todos", func(t *testing.T) {
+		overdue := true
+		todos, _ := repo.FindAll(ctx, todo.ListOptions{Overdue: &overdue, Now: now})
+		if got := titles(todos); got != "late" {
+			t.Errorf("expected %q, got %q", "late", got)
+		}
+		overdue = false
+		todos, _ = repo.FindAll(ctx, todo.ListOptions{Overdue: &overdue, Now: now})
+		if got := titles(todos); got != "done soon undated" {
+			t.Errorf("expected %q, got %q", "done soon undated", got)
+		}
+		todos, _ = repo.FindAll(ctx, todo.ListOptions{DueBefore: &now})
+		if got := titles(todos); got != "late done" {
+			t.Errorf("expected %q, got %q", "late done", got)
+		}
+	})
+
+	t.Run("sorts by priority", func(t *testing.T) {
+		opts := todo.ListOptions{Sort: todo.SortPriority, Desc: true, Limit: 2}
+		first, _ := repo.FindAll(ctx, opts)
+		c := todo.CursorFor(first[1], opts.Sort, opts.Desc)
+		opts.After, opts.Limit = &c, 0
+		rest, _ := repo.FindAll(ctx, opts)
+		if got := titles(append(first, rest...)); got != "late soon done undated" {
+			t.Errorf("expected %q, got %q", "late soon done undated", got)
+		}
+	})
+}
+
+func TestRepo_Subtasks(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	parent := &todo.Todo{Title: "parent", AutoComplete: true, CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, parent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, title := range []string{"one", "two", "three"} {
+		sub := &todo.Todo{Title: title, ParentID: parent.ID, Completed: i == 0, CreatedAt: now, UpdatedAt: now}
+		if err := repo.Create(ctx, sub); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got, err := repo.FindByID(ctx, 0, parent.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.AutoComplete || got.Progress == nil || *got.Progress != (todo.Progress{Done: 1, Total: 3}) {
+		t.Errorf("expected auto-complete with progress 1/3, got %v and %+v", got.AutoComplete, got.Progress)
+	}
+
+	var topLevel int64
+	todos, _ := repo.FindAll(ctx, todo.ListOptions{ParentID: &topLevel})
+	if len(todos) != 1 || todos[0].ID != parent.ID {
+		t.Errorf("expected only the parent at the top level, got %d todos", len(todos))
+	}
+	todos, _ = repo.FindAll(ctx, todo.ListOptions{ParentID: &parent.ID})
+	if len(todos) != 3 || todos[0].ParentID != parent.ID {
+		t.Errorf("expected 3 subtasks, got %d", len(todos))
+	}
+
+	if err := repo.Delete(ctx, 0, parent.ID, 0, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if todos, _ := repo.FindAll(ctx, todo.ListOptions{}); len(todos) != 0 {
+		t.Errorf("expected subtasks to be deleted with their parent, got %d todos", len(todos))
+	}
+}
+
+func TestRepo_Projects(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	project := &todo.Project{Name: "Garden", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateProject(ctx, project); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.CreateProject(ctx, &todo.Project{Name: "Garden", CreatedAt: now, UpdatedAt: now}); !errors.Is(err, todo.ErrProjectExists) {
+		t.Errorf("expected error %v, got %v", todo.ErrProjectExists, err)
+	}
+
+	inProject := &todo.Todo{Title: "in project", ProjectID: project.ID, CreatedAt: now, UpdatedAt: now}
+	loose := &todo.Todo{Title: "loose", CreatedAt: now, UpdatedAt: now}
+	for _, td := range []*todo.Todo{inProject, loose} {
+		if err := repo.Create(ctx, td); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	todos, _ := repo.FindAll(ctx, todo.ListOptions{ProjectID: &project.ID})
+	if len(todos) != 1 || todos[0].ProjectID != project.ID {
+		t.Errorf("expected the todo in the project, got %d todos", len(todos))
+	}
+
+	project.Archived = true
+	if err := repo.UpdateProject(ctx, project); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := repo.FindProject(ctx, 0, project.ID); got == nil || !got.Archived {
+		t.Errorf("expected an archived project, got %+v", got)
+	}
+	todos, _ = repo.FindAll(ctx, todo.ListOptions{})
+	if len(todos) != 1 || todos[0].ID != loose.ID {
+		t.Errorf("expected the archived project's todo to be hidden, got %d todos", len(todos))
+	}
+	todos, _ = repo.FindAll(ctx, todo.ListOptions{ProjectID: &project.ID})
+	if len(todos) != 1 {
+		t.Errorf("expected the archived project's todo when listing the project, got %d todos", len(todos))
+	}
+
+	if err := repo.DeleteProject(ctx, 0, project.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := repo.FindByID(ctx, 0, inProject.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ProjectID != 0 || got.Version != 2 {
+		t.Errorf("expected no project at version 2, got project %d at version %d", got.ProjectID, got.Version)
+	}
+	if err := repo.DeleteProject(ctx, 0, project.ID); !errors.Is(err, todo.ErrProjectNotFound) {
+		t.Errorf("expected error %v, got %v", todo.ErrProjectNotFound, err)
+	}
+}
+
+func TestRepo_Positions(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	var todos []*todo.Todo
+	for _, title := range []string{"a", "b", "c"} {
+		td := &todo.Todo{Title: title, CreatedAt: now, UpdatedAt: now}
+		if err := repo.Create(ctx, td); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		todos = append(todos, td)
+	}
+	if !(todos[0].Position < todos[1].Position && todos[1].Position < todos[2].Position) {
+		t.Fatalf("expected ascending positions, got %q, %q and %q", todos[0].Position, todos[1].Position, todos[2].Position)
+	}
+
+	// Move c between a and b.
+	position, err := rank.Between(todos[0].Position, todos[1].Position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	todos[2].Position = position
+	if err := repo.Update(ctx, todos[2]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var titles []string
+	opts := todo.ListOptions{Sort: todo.SortPosition, Limit: 1}
+	for {
+		page, err := repo.FindAll(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		titles = append(titles, page[0].Title)
+		c := todo.CursorFor(page[0], todo.SortPosition, false)
+		opts.After = &c
+	}
+	if got := strings.Join(titles, ""); got != "acb" {
+		t.Errorf("expected order %q, got %q", "acb", got)
+	}
+}
+
+func TestRepo_Trash(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	parent := &todo.Todo{Title: "parent", CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, parent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var subs []*todo.Todo
+	for _, title := range []string{"one", "two"} {
+		sub := &todo.Todo{Title: title, ParentID: parent.ID, Tags: []string{"home"}, CreatedAt: now, UpdatedAt: now}
+		if err := repo.Create(ctx, sub); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	earlier, later := now.Add(-2*time.Hour), now.Add(-time.Hour)
+	if err := repo.Delete(ctx, 0, subs[0].ID, 0, earlier); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.Delete(ctx, 0, parent.ID, 0, later); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := repo.FindByID(ctx, 0, parent.ID); err != todo.ErrNotFound {
+		t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+	}
+	trashed, _ := repo.FindAll(ctx, todo.ListOptions{Trashed: true})
+	if len(trashed) != 1 || trashed[0].ID != parent.ID || trashed[0].DeletedAt == nil {
+		t.Errorf("expected only the parent in the trash, got %+v", trashed)
+	}
+	if tags, _ := repo.ListTags(ctx, 0); len(tags) != 1 || tags[0].Count != 0 {
+		t.Errorf("expected tag counts to leave out deleted todos, got %+v", tags)
+	}
+
+	if err := repo.Restore(ctx, 0, subs[1].ID, time.Now()); err != todo.ErrNotFound {
+		t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+	}
+	if err := repo.Restore(ctx, 0, parent.ID, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := repo.FindByID(ctx, 0, parent.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Progress == nil || got.Progress.Total != 1 || got.Version != 3 {
+		t.Errorf("expected version 3 with one subtask restored, got version %d and %+v", got.Version, got.Progress)
+	}
+
+	n, err := repo.Purge(ctx, now.Add(-90*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 todo purged, got %d", n)
+	}
+	if trashed, _ := repo.FindAll(ctx, todo.ListOptions{Trashed: true}); len(trashed) != 0 {
+		t.Errorf("expected an empty trash, got %d todos", len(trashed))
+	}
+}
+
+func TestRepo_History(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := auth.WithUserID(context.Background(), 7)
+
+	now := time.Now()
+	td := &todo.Todo{OwnerID: 7, Title: "draft", Tags: []string{"work"}, CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, td); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	td.Title = "final"
+	td.Priority = todo.PriorityHigh
+	td.Tags = nil
+	td.UpdatedAt = now.Add(time.Minute)
+	if err := repo.Update(ctx, td); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stale := *td
+	stale.Version = 1
+	stale.Title = "lost"
+	if err := repo.Update(ctx, &stale); err != todo.ErrConflict {
+		t.Fatalf("expected error %v, got %v", todo.ErrConflict, err)
+	}
+	if err := repo.Delete(ctx, 7, td.ID, 0, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.Restore(ctx, 7, td.ID, now.Add(3*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := repo.History(ctx, 7, td.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		if e.ActorID != 7 || e.TodoID != td.ID {
+			t.Errorf("expected entries for todo %d by user 7, got %+v", td.ID, e)
+		}
+	}
+	if got, want := strings.Join(actions, ","), "created,updated,deleted,restored"; got != want {
+		t.Fatalf("expected actions %s, got %s", want, got)
+	}
+	if entries[3].Version != 4 {
+		t.Errorf("expected the last entry at version 4, got %d", entries[3].Version)
+	}
+
+	changes := entries[1].Changes
+	if len(changes) != 3 {
+		t.Errorf("expected title, priority and tags to change, got %v", changes)
+	}
+	if c := changes["title"]; string(c.Old) != `"draft"` || string(c.New) != `"final"` {
+		t.Errorf("expected title to change from draft to final, got %s to %s", c.Old, c.New)
+	}
+	if c := changes["tags"]; string(c.Old) != `["work"]` || string(c.New) != `[]` {
+		t.Errorf("expected tags to be cleared, got %s to %s", c.Old, c.New)
+	}
+
+	if _, err := repo.History(ctx, 8, td.ID); err != todo.ErrNotFound {
+		t.Errorf("expected error %v for another owner, got %v", todo.ErrNotFound, err)
+	}
+
+	if err := repo.Delete(ctx, 7, td.ID, 0, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.Purge(ctx, now.Add(time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries, err := repo.History(ctx, 7, td.ID); err != todo.ErrNotFound || len(entries) != 0 {
+		t.Errorf("expected purging to remove the history, got %d entries and %v", len(entries), err)
+	}
+}
+
+func TestRepo_Search(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for _, td := range []*todo.Todo{
+		{Title: "Buy milk", Description: "Oat milk from the corner shop"},
+		{Title: "Call the plumber", Description: "About the leaking milk frother"},
+		{Title: "Write report"},
+	} {
+		td.CreatedAt, td.UpdatedAt = now, now
+		if err := repo.Create(ctx, td); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	search := func(opts todo.ListOptions) []*todo.Todo {
+		t.Helper()
+		todos, err := repo.FindAll(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return todos
+	}
+
+	todos := search(todo.ListOptions{Query: "MILK", Sort: todo.SortRelevance})
+	if len(todos) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(todos))
+	}
+	for _, td := range todos {
+		if td.Match == nil {
+			t.Errorf("expected todo %d to carry its match", td.ID)
+		}
+	}
+	if todos := search(todo.ListOptions{Query: "milk corner", Sort: todo.SortRelevance}); len(todos) != 1 || todos[0].Title != "Buy milk" {
+		t.Errorf("expected every word to match, got %+v", todos)
+	}
+	if todos := search(todo.ListOptions{Query: "rep", Sort: todo.SortRelevance}); len(todos) != 1 || todos[0].Title != "Write report" {
+		t.Errorf("expected words to match as prefixes, got %+v", todos)
+	}
+	if todos := search(todo.ListOptions{Query: "ilk", Sort: todo.SortRelevance}); len(todos) != 0 {
+		t.Errorf("expected only word prefixes to match, got %+v", todos)
+	}
+
+	// Titles outweigh descriptions and subsequent pages continue the ranking.
+	first := search(todo.ListOptions{Query: "milk", Sort: todo.SortRelevance, Limit: 1})
+	after := todo.CursorFor(first[0], todo.SortRelevance, false)
+	rest := search(todo.ListOptions{Query: "milk", Sort: todo.SortRelevance, After: &after})
+	if len(rest) != 1 || rest[0].ID == first[0].ID {
+		t.Fatalf("expected the second match on the next page, got %+v", rest)
+	}
+	if first[0].Match.Rank != 0 {
+		if first[0].Title != "Buy milk" || !strings.Contains(first[0].Match.Snippet, todo.MatchStart+"milk"+todo.MatchEnd) {
+			t.Errorf("expected the title match first with a highlighted snippet, got %+v", first[0].Match)
+		}
+	}
+
+	// Snippets are HTML with only the highlighting left unescaped.
+	script := &todo.Todo{Title: "<script>alert(1)</script> heist", CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, script); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if todos := search(todo.ListOptions{Query: "heist", Sort: todo.SortRelevance}); len(todos) != 1 || strings.Contains(todos[0].Match.Snippet, "<script>") {
+		t.Errorf("expected an escaped snippet, got %+v", todos)
+	} else if snippet := todos[0].Match.Snippet; snippet != "" && snippet != "&lt;script&gt;alert(1)&lt;/script&gt; "+todo.MatchStart+"heist"+todo.MatchEnd {
+		t.Errorf("unexpected snippet %q", snippet)
+	}
+
+	// The index follows updates and deletes.
+	todos[0].Title, todos[0].Description = "Buy bread", ""
+	if err := repo.Update(ctx, todos[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if todos := search(todo.ListOptions{Query: "bread", Sort: todo.SortRelevance}); len(todos) != 1 {
+		t.Errorf("expected the updated todo to match, got %d todos", len(todos))
+	}
+	if err := repo.Delete(ctx, 0, todos[0].ID, 0, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.Purge(ctx, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if todos := search(todo.ListOptions{Query: "bread", Sort: todo.SortRelevance}); len(todos) != 0 {
+		t.Errorf("expected purged todos not to match, got %d todos", len(todos))
+	}
+}
+
+func TestRepo_SearchIndex(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	reopen := func(t *testing.T, path string) *sqlite.Repo {
+		t.Helper()
+		repo, err := sqlite.NewRepo(path)
+		if err != nil {
+			t.Fatalf("failed to open repo: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	}
+
+	t.Run("replaces an index left behind without FTS5", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "todos.db")
+		repo := reopen(t, path)
+		// This is what a binary without FTS5 leaves of the migration.
+		_, err := repo.DB().Exec(`DROP TRIGGER IF EXISTS todos_fts_insert; DROP TRIGGER IF EXISTS todos_fts_update;
+			DROP TRIGGER IF EXISTS todos_fts_delete; DELETE FROM schema_migrations WHERE version = 13`)
+		if err != nil {
+			t.Fatalf("failed to detach the index: %v", err)
+		}
+		if err := repo.Create(ctx, &todo.Todo{Title: "Buy milk", CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		repo.Close()
+
+		todos, err := reopen(t, path).FindAll(ctx, todo.ListOptions{Query: "milk", Sort: todo.SortRelevance})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(todos) != 1 {
+			t.Errorf("expected todos written meanwhile to be found, got %+v", todos)
+		}
+	})
+
+	t.Run("detaches the index without FTS5", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "todos.db")
+		repo := reopen(t, path)
+		var fts5 bool
+		repo.DB().QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+		if fts5 {
+			t.Skip("SQLite has FTS5")
+		}
+		// Without FTS5 the index cannot be created, and its triggers fail
+		// just as if it could not be written.
+		_, err := repo.DB().Exec(`CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+				INSERT INTO todos_fts (rowid, fts_title, fts_description) VALUES (new.id, new.title, new.description);
+			END;
+			INSERT INTO schema_migrations (version, name, applied_at) VALUES (13, 'add_search', CURRENT_TIMESTAMP)`)
+		if err != nil {
+			t.Fatalf("failed to fake the index: %v", err)
+		}
+		repo.Close()
+
+		repo = reopen(t, path)
+		if err := repo.Create(ctx, &todo.Todo{Title: "Buy milk", CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("expected todos to be writable, got %v", err)
+		}
+		var applied bool
+		repo.DB().QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = 13)").Scan(&applied)
+		if applied {
+			t.Error("expected the search migration to be unrecorded")
+		}
+	})
+}
+
+func TestRepo_Apply(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	existing := &todo.Todo{Title: "existing", CreatedAt: now, UpdatedAt: now}
+	if err := repo.Create(ctx, existing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stale := *existing
+	stale.Version = 5
+	err := repo.Apply(ctx, []todo.Write{
+		{Op: todo.OpCreate, Todo: &todo.Todo{Title: "new", CreatedAt: now, UpdatedAt: now}},
+		{Op: todo.OpDelete, Todo: &stale},
+	}, now)
+	var batchErr *todo.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, todo.ErrConflict) {
+		t.Fatalf("expected write 1 to fail with %v, got %v", todo.ErrConflict, err)
+	}
+	if todos, _ := repo.FindAll(ctx, todo.ListOptions{}); len(todos) != 1 {
+		t.Errorf("expected the create to be rolled back, got %d todos", len(todos))
+	}
+
+	err = repo.Apply(ctx, []todo.Write{
+		{Op: todo.OpCreate, Todo: &todo.Todo{Title: "new", CreatedAt: now, UpdatedAt: now}},
+		{Op: todo.OpDelete, Todo: existing},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if todos, _ := repo.FindAll(ctx, todo.ListOptions{}); len(todos) != 1 || todos[0].Title != "new" {
+		t.Errorf("expected only the new todo, got %+v", todos)
+	}
+}
+
+func TestRepo_WithTx(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+	now := time.Now()
+	errAbort := errors.New("abort")
+
+	err := repo.WithTx(ctx, func(tx todo.Repository) error {
+		if err := tx.Create(ctx, &todo.Todo{Title: "rolled back", CreatedAt: now, UpdatedAt: now}); err != nil {
+			return err
+		}
+		if todos, _ := tx.FindAll(ctx, todo.ListOptions{}); len(todos) != 1 {
+			t.Errorf("expected the transaction to see its own write, got %d todos", len(todos))
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected error %v, got %v", errAbort, err)
+	}
+	if todos, _ := repo.FindAll(ctx, todo.ListOptions{}); len(todos) != 0 {
+		t.Errorf("expected the create to be rolled back, got %d todos", len(todos))
+	}
+
+	err = repo.WithTx(ctx, func(tx todo.Repository) error {
+		// Nested transactions join the outer one.
+		return tx.WithTx(ctx, func(tx todo.Repository) error {
+			return tx.Create(ctx, &todo.Todo{Title: "committed", CreatedAt: now, UpdatedAt: now})
+		})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if todos, _ := repo.FindAll(ctx, todo.ListOptions{}); len(todos) != 1 || todos[0].Title != "committed" {
+		t.Errorf("expected the committed todo, got %+v", todos)
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	store := newTestRepo(t).Idempotency()
+	ctx := context.Background()
+	now := time.Now()
+
+	rec := &idempotency.Record{UserID: 1, Key: "k", Fingerprint: "f", CreatedAt: now, ExpiresAt: now.Add(time.Hour), LockedUntil: now.Add(time.Minute)}
+	if stored, err := store.Reserve(ctx, rec); err != nil || stored != nil {
+		t.Fatalf("expected the key to be reserved, got %+v, %v", stored, err)
+	}
+	stored, err := store.Reserve(ctx, rec)
+	if err != nil || stored == nil || stored.Completed() {
+		t.Fatalf("expected the record in progress, got %+v, %v", stored, err)
+	}
+
+	rec.Status, rec.Header, rec.Body = 201, http.Header{"Etag": {`"1"`}}, []byte("{}")
+	if err := store.Complete(ctx, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored, _ = store.Reserve(ctx, rec)
+	if stored == nil || stored.Status != 201 || stored.Header.Get("ETag") != `"1"` || string(stored.Body) != "{}" || stored.Fingerprint != "f" {
+		t.Errorf("expected the completed record, got %+v", stored)
+	}
+
+	other := *rec
+	other.UserID = 2
+	if stored, _ := store.Reserve(ctx, &other); stored != nil {
+		t.Errorf("expected keys to be scoped to the user, got %+v", stored)
+	}
+
+	later := *rec
+	later.CreatedAt = now.Add(2 * time.Hour)
+	later.ExpiresAt = later.CreatedAt.Add(time.Hour)
+	if stored, _ := store.Reserve(ctx, &later); stored != nil {
+		t.Errorf("expected the expired record to be replaced, got %+v", stored)
+	}
+
+	// A request in progress past its lock is abandoned and its key free.
+	abandoned := &idempotency.Record{UserID: 1, Key: "abandoned", Fingerprint: "f", CreatedAt: now, ExpiresAt: now.Add(time.Hour), LockedUntil: now.Add(time.Minute)}
+	if stored, _ := store.Reserve(ctx, abandoned); stored != nil {
+		t.Fatalf("expected the key to be reserved, got %+v", stored)
+	}
+	retry := *abandoned
+	retry.Fingerprint = "g"
+	retry.CreatedAt = now.Add(2 * time.Minute)
+	retry.LockedUntil = retry.CreatedAt.Add(time.Minute)
+	if stored, err := store.Reserve(ctx, &retry); err != nil || stored != nil {
+		t.Fatalf("expected the abandoned record to be replaced, got %+v, %v", stored, err)
+	}
+	stored, err = store.Reserve(ctx, abandoned)
+	if err != nil || stored == nil || stored.Fingerprint != "g" || !stored.LockedUntil.Equal(retry.LockedUntil) {
+		t.Fatalf("expected the new reservation, got %+v, %v", stored, err)
+	}
+	// The abandoned request no longer holds the key.
+	abandoned.Status = 201
+	if err := store.Complete(ctx, abandoned); !errors.Is(err, idempotency.ErrNotFound) {
+		t.Errorf("expected error %v, got %v", idempotency.ErrNotFound, err)
+	}
+	if err := store.Release(ctx, abandoned); !errors.Is(err, idempotency.ErrNotFound) {
+		t.Errorf("expected error %v, got %v", idempotency.ErrNotFound, err)
+	}
+	if stored, _ := store.Reserve(ctx, &retry); stored == nil || stored.Completed() {
+		t.Errorf("expected the new reservation to be kept, got %+v", stored)
+	}
+
+	if err := store.Release(ctx, &later); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Release(ctx, &later); !errors.Is(err, idempotency.ErrNotFound) {
+		t.Errorf("expected error %v, got %v", idempotency.ErrNotFound, err)
+	}
+}
+
+func TestWebhookRepo(t *testing.T) {
+	repo := newTestRepo(t)
+	webhooks := repo.Webhooks()
+	ctx := auth.WithUserID(context.Background(), 1)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	wanted := &webhook.Subscription{OwnerID: 1, URL: "http://example.com/a", Events: []string{todo.ActionCreated}, Active: true, Secret: "s", CreatedAt: now, UpdatedAt: now}
+	other := &webhook.Subscription{OwnerID: 2, URL: "http://example.com/b", Events: []string{}, Active: true, Secret: "s", CreatedAt: now, UpdatedAt: now}
+	for _, sub := range []*webhook.Subscription{wanted, other} {
+		if err := webhooks.CreateSubscription(ctx, sub); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := webhooks.FindSubscription(ctx, 2, wanted.ID); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected error %v, got %v", webhook.ErrNotFound, err)
+	}
+
+	service := todo.NewService(repo, todo.WithClock(func() time.Time { return now }))
+	created, err := service.CreateTodo(ctx, "Ship it", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.DeleteTodo(ctx, created.ID, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := webhooks.Dispatch(ctx, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Dispatching twice creates no further deliveries.
+	if err := webhooks.Dispatch(ctx, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	due, err := webhooks.DueDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("expected 1 due delivery, got %d", len(due))
+	}
+	d := due[0]
+	if d.Subscription.ID != wanted.ID || d.Subscription.Secret != "s" || d.Event.Type != todo.ActionCreated || !strings.Contains(string(d.Event.Todo), "Ship it") {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+
+	d.Attempts, d.NextAttemptAt, d.UpdatedAt = 1, now.Add(time.Minute), now
+	if err := webhooks.RecordAttempt(ctx, d, &webhook.Attempt{DeliveryID: d.ID, SubscriptionID: wanted.ID, EventID: d.Event.ID, Attempt: 1, StatusCode: 500, At: now}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if due, _ := webhooks.DueDeliveries(ctx, now, 10); len(due) != 0 {
+		t.Errorf("expected no due deliveries before the retry, got %d", len(due))
+	}
+
+	d.Status, d.Attempts, d.UpdatedAt = webhook.StatusDelivered, 2, now.Add(time.Minute)
+	if err := webhooks.RecordAttempt(ctx, d, &webhook.Attempt{DeliveryID: d.ID, SubscriptionID: wanted.ID, EventID: d.Event.ID, Attempt: 2, StatusCode: 204, At: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log, err := webhooks.ListAttempts(ctx, wanted.ID, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(log) != 2 || log[0].Attempt != 2 || log[0].Status != webhook.StatusDelivered || log[1].EventType != todo.ActionCreated {
+		t.Errorf("unexpected delivery log %+v", log)
+	}
+
+	if err := webhooks.Prune(ctx, now.Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if log, _ := webhooks.ListAttempts(ctx, wanted.ID, 10); len(log) != 0 {
+		t.Errorf("expected the finished delivery to be pruned, got %+v", log)
+	}
+
+	if err := webhooks.DeleteSubscription(ctx, 1, wanted.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := webhooks.DeleteSubscription(ctx, 1, wanted.ID); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected error %v, got %v", webhook.ErrNotFound, err)
+	}
+}
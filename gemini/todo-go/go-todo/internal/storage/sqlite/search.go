@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// snippetTokens is the length of search snippets, in words.
+const snippetTokens = 16
+
+// FTS5 marks matches in snippets with these control characters, which
+// html.EscapeString leaves alone, and escapeSnippet then replaces them with
+// todo.MatchStart and todo.MatchEnd.
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+// escapeSnippet turns a snippet made by FTS5 into a todo.Match snippet.
+func escapeSnippet(snippet string) string {
+	return todo.EscapeSnippet(snippet, snippetStart, snippetEnd)
+}
+
+// searchMigration is the version of the migration creating the full-text
+// index, which is only applied if SQLite was built with FTS5.
+const searchMigration = 13
+
+// searchIndex reports whether the database has the full-text index. A
+// binary whose SQLite lacks FTS5 cannot update the index, so if the
+// database has one, it undoes the migration as far as it can: it drops the
+// triggers updating the index and unrecords the migration, leaving a stale
+// table behind for a binary with FTS5 to replace.
+func searchIndex(db *sql.DB) (bool, error) {
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return false, err
+	}
+	var applied bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)", searchMigration).Scan(&applied); err != nil {
+		return false, err
+	}
+	if fts5 || !applied {
+		return applied, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DROP TRIGGER IF EXISTS todos_fts_delete;
+DROP TRIGGER IF EXISTS todos_fts_update;
+DROP TRIGGER IF EXISTS todos_fts_insert;`)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", searchMigration); err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+// searchQuery is what FindAll adds to its query to search.
+type searchQuery struct {
+	// from is the table expression to select from.
+	from string
+	// columns selects the rank and snippet of each match, and rank is the
+	// column relevance orders by.
+	columns string
+	rank    string
+	where   []string
+	args    []interface{}
+}
+
+// wordStart is a GLOB pattern matching the character before a word: anything
+// but an ASCII letter or digit, or a character beyond ASCII. Prefixing the
+// text with a space makes its first word match too.
+const wordStart = "*[^0-9a-z\u0080-\U0010FFFF]"
+
+// search builds the searchQuery for query. Without the index, todos with a
+// word starting with each word of the query in their title or description
+// match, as with the index, but all matches rank equally.
+func (r *Repo) search(query string) searchQuery {
+	terms := todo.SearchTerms(query)
+	if !r.fts {
+		// A real rather than an integer, which ORDER BY reads as a
+		// column number.
+		q := searchQuery{from: "todos", columns: "0.0, ''", rank: "0.0"}
+		for _, term := range terms {
+			// Terms only hold letters and digits, none of them special
+			// to GLOB.
+			pattern := wordStart + term + "*"
+			q.where = append(q.where, "(' ' || lower(title) GLOB ? OR ' ' || lower(description) GLOB ?)")
+			q.args = append(q.args, pattern, pattern)
+		}
+		return q
+	}
+
+	// Quoted terms are matched as words, and the asterisk makes them
+	// prefixes.
+	match := make([]string, len(terms))
+	for i, term := range terms {
+		match[i] = `"` + term + `"*`
+	}
+	return searchQuery{
+		from:    "todos JOIN todos_fts ON todos_fts.rowid = todos.id",
+		columns: fmt.Sprintf("todos_fts.rank, snippet(todos_fts, -1, char(2), char(3), '…', %d)", snippetTokens),
+		rank:    "todos_fts.rank",
+		where:   []string{"todos_fts MATCH ?"},
+		args:    []interface{}{strings.Join(match, " ")},
+	}
+}
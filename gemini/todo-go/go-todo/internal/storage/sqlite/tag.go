@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// setTags replaces the tags of a todo, registering new tag names for the
+// owner as needed.
+func (r *Repo) setTags(ctx context.Context, ownerID, todoID int64, tags []string) error {
+	if _, err := r.conn.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = ?", todoID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, tag := range tags {
+		_, err := r.conn.ExecContext(ctx, "INSERT OR IGNORE INTO tags (owner_id, name, created_at) VALUES (?, ?, ?)", ownerID, tag, now)
+		if err != nil {
+			return err
+		}
+		_, err = r.conn.ExecContext(ctx, `INSERT INTO todo_tags (todo_id, tag_id)
+			SELECT ?, id FROM tags WHERE owner_id = ? AND name = ?`, todoID, ownerID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTags returns the owner's tags with their usage counts, by name.
+func (r *Repo) ListTags(ctx context.Context, ownerID int64) ([]todo.Tag, error) {
+	query := `SELECT tg.name, COUNT(t.id) FROM tags tg
+		LEFT JOIN todo_tags tt ON tt.tag_id = tg.id
+		LEFT JOIN todos t ON t.id = tt.todo_id AND t.deleted_at IS NULL
+		WHERE tg.owner_id = ? GROUP BY tg.id ORDER BY tg.name`
+	rows, err := r.conn.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []todo.Tag{}
+	for rows.Next() {
+		var tag todo.Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// CreateTag registers a tag for the owner.
+func (r *Repo) CreateTag(ctx context.Context, ownerID int64, name string) error {
+	_, err := r.conn.ExecContext(ctx, "INSERT INTO tags (owner_id, name, created_at) VALUES (?, ?, ?)", ownerID, name, time.Now().UTC())
+	if isUniqueViolation(err) {
+		return todo.ErrTagExists
+	}
+	return err
+}
+
+// RenameTag renames a tag on every todo of the owner carrying it.
+func (r *Repo) RenameTag(ctx context.Context, ownerID int64, from, to string) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		if err := tx.touchTagged(ctx, ownerID, from); err != nil {
+			return err
+		}
+		res, err := tx.conn.ExecContext(ctx, "UPDATE tags SET name = ? WHERE owner_id = ? AND name = ?", to, ownerID, from)
+		if isUniqueViolation(err) {
+			return todo.ErrTagExists
+		}
+		if err != nil {
+			return err
+		}
+		return tagAffected(res)
+	})
+}
+
+// DeleteTag removes a tag from every todo of the owner carrying it.
+func (r *Repo) DeleteTag(ctx context.Context, ownerID int64, name string) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		if err := tx.touchTagged(ctx, ownerID, name); err != nil {
+			return err
+		}
+		res, err := tx.conn.ExecContext(ctx, "DELETE FROM tags WHERE owner_id = ? AND name = ?", ownerID, name)
+		if err != nil {
+			return err
+		}
+		return tagAffected(res)
+	})
+}
+
+// touchTagged advances the version of every todo carrying the tag, since
+// renaming or deleting the tag changes them.
+func (r *Repo) touchTagged(ctx context.Context, ownerID int64, name string) error {
+	_, err := r.conn.ExecContext(ctx, `UPDATE todos SET version = version + 1 WHERE id IN (
+		SELECT tt.todo_id FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE tg.owner_id = ? AND tg.name = ?)`, ownerID, name)
+	return err
+}
+
+func tagAffected(res interface{ RowsAffected() (int64, error) }) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return todo.ErrTagNotFound
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gemini/go-todo/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces the queries and transactions of the repository.
+var tracer = otel.Tracer("github.com/gemini/go-todo/internal/storage/sqlite")
+
+// tracedConn is a dbtx that starts a span for every query run through it.
+// Spans of queries returning rows end when the first row is ready, before
+// the rows are read.
+type tracedConn struct {
+	conn dbtx
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args ...interface{}) (_ sql.Result, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer tracing.End(span, &err)
+
+	return c.conn.ExecContext(ctx, query, args...)
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (_ *sql.Rows, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer tracing.End(span, &err)
+
+	return c.conn.QueryContext(ctx, query, args...)
+}
+
+func (c tracedConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+
+	row := c.conn.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return row
+}
+
+// startQuery starts a span named after the statement's first keyword, such
+// as SELECT or UPDATE.
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := "sqlite"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		name = strings.ToUpper(fields[0])
+	}
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemSqlite, semconv.DBStatement(strings.Join(strings.Fields(query), " "))),
+	)
+}
@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// dbtx is the subset of *sql.DB and *sql.Tx the repository queries through.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn with a repository bound to a transaction, committing if fn
+// succeeds and rolling back otherwise. If r is already bound to a
+// transaction, fn joins it.
+func (r *Repo) inTx(ctx context.Context, fn func(tx *Repo) error) (err error) {
+	if r.tx != nil {
+		return fn(r)
+	}
+	ctx, span := tracer.Start(ctx, "sqlite transaction")
+	defer tracing.End(span, &err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&Repo{db: r.db, conn: tracedConn{tx}, tx: tx, fts: r.fts}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithTx runs fn with a repository bound to a transaction, committing if fn
+// succeeds and rolling back otherwise. Transactions take the write lock
+// when they begin, so a read-modify-write inside fn cannot interleave with
+// other writes. If r is already bound to a transaction, fn joins it.
+func (r *Repo) WithTx(ctx context.Context, fn func(repo todo.Repository) error) error {
+	return r.inTx(ctx, func(tx *Repo) error {
+		return fn(tx)
+	})
+}
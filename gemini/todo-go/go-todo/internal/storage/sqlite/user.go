@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/gemini/go-todo/internal/user"
+	"github.com/mattn/go-sqlite3"
+)
+
+// UserRepo is a SQLite implementation of the user.Repository.
+type UserRepo struct {
+	db *sql.DB
+}
+
+// Create creates a new user.
+func (r *UserRepo) Create(ctx context.Context, u *user.User) error {
+	query := "INSERT INTO users (email, password_hash, created_at) VALUES (?, ?, ?)"
+	res, err := r.db.ExecContext(ctx, query, u.Email, u.PasswordHash, u.CreatedAt.UTC())
+	if isUniqueViolation(err) {
+		return user.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	u.ID = id
+	return nil
+}
+
+// FindByEmail finds a user by email address.
+func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*user.User, error) {
+	query := "SELECT id, email, password_hash, created_at FROM users WHERE email = ?"
+	return r.findOne(ctx, query, email)
+}
+
+// FindByID finds a user by ID.
+func (r *UserRepo) FindByID(ctx context.Context, id int64) (*user.User, error) {
+	query := "SELECT id, email, password_hash, created_at FROM users WHERE id = ?"
+	return r.findOne(ctx, query, id)
+}
+
+func (r *UserRepo) findOne(ctx context.Context, query string, arg interface{}) (*user.User, error) {
+	u := &user.User{}
+	err := r.db.QueryRowContext(ctx, query, arg).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, user.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,310 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gemini/go-todo/internal/webhook"
+)
+
+// WebhookRepo is a SQLite implementation of the webhook.Repository.
+type WebhookRepo struct {
+	db *sql.DB
+}
+
+// Webhooks returns a webhook repository backed by the same database.
+func (r *Repo) Webhooks() *WebhookRepo {
+	return &WebhookRepo{db: r.db}
+}
+
+// subscriptionColumns lists the columns read by scanSubscription, in order.
+const subscriptionColumns = "id, owner_id, url, secret, events, active, created_at, updated_at"
+
+func scanSubscription(s scanner) (*webhook.Subscription, error) {
+	sub := &webhook.Subscription{}
+	var events string
+	err := s.Scan(&sub.ID, &sub.OwnerID, &sub.URL, &sub.Secret, &events, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &sub.Events); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns the owner's subscriptions by ID.
+func (r *WebhookRepo) ListSubscriptions(ctx context.Context, ownerID int64) ([]*webhook.Subscription, error) {
+	query := "SELECT " + subscriptionColumns + " FROM webhook_subscriptions WHERE owner_id = ? ORDER BY id"
+	rows, err := r.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*webhook.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// CreateSubscription creates a new subscription.
+func (r *WebhookRepo) CreateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	events, err := json.Marshal(sub.Events)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO webhook_subscriptions (owner_id, url, secret, events, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	res, err := r.db.ExecContext(ctx, query, sub.OwnerID, sub.URL, sub.Secret, string(events), sub.Active,
+		sub.CreatedAt.UTC(), sub.UpdatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	sub.ID = id
+	return nil
+}
+
+// FindSubscription finds an owner's subscription by its ID.
+func (r *WebhookRepo) FindSubscription(ctx context.Context, ownerID, id int64) (*webhook.Subscription, error) {
+	query := "SELECT " + subscriptionColumns + " FROM webhook_subscriptions WHERE id = ? AND owner_id = ?"
+	sub, err := scanSubscription(r.db.QueryRowContext(ctx, query, id, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, webhook.ErrNotFound
+	}
+	return sub, err
+}
+
+// UpdateSubscription stores the URL, events and active state of a
+// subscription.
+func (r *WebhookRepo) UpdateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	events, err := json.Marshal(sub.Events)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE webhook_subscriptions SET url = ?, events = ?, active = ?, updated_at = ? WHERE id = ? AND owner_id = ?"
+	res, err := r.db.ExecContext(ctx, query, sub.URL, string(events), sub.Active, sub.UpdatedAt.UTC(), sub.ID, sub.OwnerID)
+	if err != nil {
+		return err
+	}
+	return checkSubscription(res)
+}
+
+// DeleteSubscription deletes an owner's subscription. Its deliveries and
+// their attempts go with it.
+func (r *WebhookRepo) DeleteSubscription(ctx context.Context, ownerID, id int64) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ? AND owner_id = ?", id, ownerID)
+	if err != nil {
+		return err
+	}
+	return checkSubscription(res)
+}
+
+// checkSubscription maps a write that touched no subscription to
+// webhook.ErrNotFound.
+func checkSubscription(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return webhook.ErrNotFound
+	}
+	return nil
+}
+
+// ListAttempts returns the latest attempts to deliver to a subscription,
+// newest first.
+func (r *WebhookRepo) ListAttempts(ctx context.Context, subscriptionID int64, limit int) ([]webhook.Attempt, error) {
+	query := `SELECT a.id, a.delivery_id, a.subscription_id, d.event_id, o.type, a.attempt, a.status_code, a.error,
+			a.duration_ms, a.created_at, d.status
+		FROM webhook_attempts a
+		JOIN webhook_deliveries d ON d.id = a.delivery_id
+		JOIN outbox o ON o.id = d.event_id
+		WHERE a.subscription_id = ?
+		ORDER BY a.id DESC
+		LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []webhook.Attempt
+	for rows.Next() {
+		var a webhook.Attempt
+		var status sql.NullInt64
+		var msg sql.NullString
+		err := rows.Scan(&a.ID, &a.DeliveryID, &a.SubscriptionID, &a.EventID, &a.EventType, &a.Attempt, &status, &msg,
+			&a.DurationMS, &a.At, &a.Status)
+		if err != nil {
+			return nil, err
+		}
+		a.StatusCode = int(status.Int64)
+		a.Error = msg.String
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// Dispatch turns the events in the outbox into deliveries to the
+// subscriptions wanting them.
+func (r *WebhookRepo) Dispatch(ctx context.Context, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, owner_id, type FROM outbox WHERE dispatched_at IS NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var events []webhook.Event
+	for rows.Next() {
+		var e webhook.Event
+		if err := rows.Scan(&e.ID, &e.OwnerID, &e.Type); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	subs := make(map[int64][]*webhook.Subscription)
+	for _, e := range events {
+		owned, ok := subs[e.OwnerID]
+		if !ok {
+			if owned, err = activeSubscriptions(ctx, tx, e.OwnerID); err != nil {
+				return err
+			}
+			subs[e.OwnerID] = owned
+		}
+		for _, sub := range owned {
+			if !sub.Wants(e.Type) {
+				continue
+			}
+			query := `INSERT INTO webhook_deliveries (subscription_id, event_id, status, next_attempt_at, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?)`
+			_, err := tx.ExecContext(ctx, query, sub.ID, e.ID, webhook.StatusPending, at.UTC(), at.UTC(), at.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE outbox SET dispatched_at = ? WHERE id = ?", at.UTC(), e.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// activeSubscriptions returns the active subscriptions of an owner.
+func activeSubscriptions(ctx context.Context, tx *sql.Tx, ownerID int64) ([]*webhook.Subscription, error) {
+	query := "SELECT " + subscriptionColumns + " FROM webhook_subscriptions WHERE owner_id = ? AND active"
+	rows, err := tx.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*webhook.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DueDeliveries returns the pending deliveries to active subscriptions due
+// at the given time, oldest first.
+func (r *WebhookRepo) DueDeliveries(ctx context.Context, at time.Time, limit int) ([]*webhook.Delivery, error) {
+	query := `SELECT d.id, d.status, d.attempts, d.next_attempt_at, d.created_at, d.updated_at,
+			o.id, o.owner_id, o.type, o.todo, o.created_at,
+			s.id, s.owner_id, s.url, s.secret, s.events, s.active, s.created_at, s.updated_at
+		FROM webhook_deliveries d
+		JOIN outbox o ON o.id = d.event_id
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND s.active
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, query, webhook.StatusPending, at.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*webhook.Delivery
+	for rows.Next() {
+		d := &webhook.Delivery{Subscription: &webhook.Subscription{}}
+		var todo string
+		var events string
+		sub := d.Subscription
+		err := rows.Scan(&d.ID, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt,
+			&d.Event.ID, &d.Event.OwnerID, &d.Event.Type, &todo, &d.Event.CreatedAt,
+			&sub.ID, &sub.OwnerID, &sub.URL, &sub.Secret, &events, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Event.Todo = json.RawMessage(todo)
+		if err := json.Unmarshal([]byte(events), &sub.Events); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt stores an attempt and the state of its delivery.
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, d *webhook.Delivery, a *webhook.Attempt) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, query, d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.UpdatedAt.UTC(), d.ID); err != nil {
+		return err
+	}
+	query = `INSERT INTO webhook_attempts (delivery_id, subscription_id, attempt, status_code, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.ExecContext(ctx, query, a.DeliveryID, a.SubscriptionID, a.Attempt, sql.NullInt64{Int64: int64(a.StatusCode), Valid: a.StatusCode != 0},
+		sql.NullString{String: a.Error, Valid: a.Error != ""}, a.DurationMS, a.At.UTC())
+	if err != nil {
+		return err
+	}
+	if a.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Prune removes finished deliveries last updated before the given time,
+// and dispatched events without deliveries.
+func (r *WebhookRepo) Prune(ctx context.Context, before time.Time) error {
+	query := "DELETE FROM webhook_deliveries WHERE status != ? AND updated_at < ?"
+	if _, err := r.db.ExecContext(ctx, query, webhook.StatusPending, before.UTC()); err != nil {
+		return err
+	}
+	query = `DELETE FROM outbox WHERE dispatched_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = outbox.id)`
+	_, err := r.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,77 @@
+package todo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+const (
+	// DefaultAgendaDays is how many days after today the agenda looks ahead
+	// when none is requested.
+	DefaultAgendaDays = 7
+	// MaxAgendaDays is the furthest the agenda may look ahead.
+	MaxAgendaDays = 90
+)
+
+// Agenda groups the incomplete todos with a due date by when they are due.
+// Each group is ordered by due date, then by descending priority.
+type Agenda struct {
+	Overdue  []*Todo `json:"overdue"`
+	Today    []*Todo `json:"today"`
+	Upcoming []*Todo `json:"upcoming"`
+}
+
+// Agenda returns the todos that are overdue, due later today and due within
+// the given number of days after today. Days are calendar days in loc.
+func (s *Service) Agenda(ctx context.Context, loc *time.Location, days int) (_ *Agenda, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.Agenda")
+	defer tracing.End(span, &err)
+
+	if days <= 0 {
+		days = DefaultAgendaDays
+	}
+	if days > MaxAgendaDays {
+		days = MaxAgendaDays
+	}
+
+	now := s.now().In(loc)
+	y, m, d := now.Date()
+	tomorrow := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	horizon := time.Date(y, m, d+1+days, 0, 0, 0, 0, loc)
+
+	completed := false
+	todos, err := s.repo.FindAll(ctx, ListOptions{
+		OwnerID:   auth.UserID(ctx),
+		Completed: &completed,
+		DueBefore: &horizon,
+		Sort:      SortCreated,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(todos, func(i, j int) bool {
+		a, b := todos[i], todos[j]
+		if !a.DueAt.Equal(*b.DueAt) {
+			return a.DueAt.Before(*b.DueAt)
+		}
+		return a.Priority > b.Priority
+	})
+
+	agenda := &Agenda{Overdue: []*Todo{}, Today: []*Todo{}, Upcoming: []*Todo{}}
+	for _, t := range todos {
+		switch {
+		case t.DueAt.Before(now):
+			agenda.Overdue = append(agenda.Overdue, t)
+		case t.DueAt.Before(tomorrow):
+			agenda.Today = append(agenda.Today, t)
+		default:
+			agenda.Upcoming = append(agenda.Upcoming, t)
+		}
+	}
+	return agenda, nil
+}
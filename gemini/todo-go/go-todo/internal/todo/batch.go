@@ -0,0 +1,274 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// MaxBatchSize is the largest number of operations a batch may hold.
+const MaxBatchSize = 100
+
+var (
+	// ErrBatchTooLarge is returned for batches of more than MaxBatchSize
+	// operations.
+	ErrBatchTooLarge = fmt.Errorf("%w: a batch may hold at most %d operations", ErrInvalid, MaxBatchSize)
+	// ErrDuplicateOp is returned when a batch updates or deletes a todo
+	// more than once.
+	ErrDuplicateOp = fmt.Errorf("%w: a batch may only change a todo once", ErrInvalid)
+	// ErrUnknownOp is returned for batch operations of an unknown kind.
+	ErrUnknownOp = fmt.Errorf("%w: unknown operation", ErrInvalid)
+)
+
+// Op is the kind of a batch operation.
+type Op string
+
+const (
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+)
+
+// BatchOp is one operation of a batch.
+type BatchOp struct {
+	Op Op
+	// ID is the todo to update or delete. If Version is non-zero, the
+	// operation fails with ErrConflict unless the todo is at that version.
+	ID      int64
+	Version int64
+	// Patch holds the fields of a created todo, or the fields an update
+	// changes.
+	Patch Patch
+	// PatchFunc, if set, computes the patch of an update from the todo's
+	// current state instead.
+	PatchFunc func(current *Todo) (Patch, error)
+}
+
+// BatchError reports which operation of a batch failed. No operation of a
+// failed batch is applied.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Write is a single write applied by Repository.Apply.
+type Write struct {
+	Op Op
+	// Todo is the todo to create or update. Deletes only use its ID,
+	// OwnerID and Version, where a zero Version deletes unconditionally.
+	Todo *Todo
+}
+
+// Batch performs the operations in order as one atomic unit and returns
+// the created or updated todo of each, or nil for deletes. If an operation
+// fails, the error is a *BatchError and nothing is written.
+func (s *Service) Batch(ctx context.Context, ops []BatchOp) (_ []*Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.Batch")
+	defer tracing.End(span, &err)
+
+	if len(ops) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	var results []*Todo
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		results, err = tx.batch(ctx, ops)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// batch performs a batch for Batch, inside its transaction. Operations
+// read the todos they change in the same transaction that writes them.
+func (s *Service) batch(ctx context.Context, ops []BatchOp) ([]*Todo, error) {
+	results := make([]*Todo, len(ops))
+	var writes []Write
+	var writeOps []int // the operation each write belongs to
+	write := func(i int, op Op, t *Todo) {
+		writes = append(writes, Write{Op: op, Todo: t})
+		writeOps = append(writeOps, i)
+	}
+	changed := make(map[int64]bool)
+	parents := make(map[int64]bool)
+
+	for i, op := range ops {
+		if op.Op == OpUpdate || op.Op == OpDelete {
+			if changed[op.ID] {
+				return nil, &BatchError{Index: i, Err: ErrDuplicateOp}
+			}
+			changed[op.ID] = true
+		}
+
+		switch op.Op {
+		case OpCreate:
+			t, err := s.prepareCreate(ctx, 0, op.Patch)
+			if err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			write(i, OpCreate, t)
+			results[i] = t
+		case OpUpdate:
+			t, err := s.current(ctx, op.ID, op.Version)
+			if err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			p := op.Patch
+			if op.PatchFunc != nil {
+				if p, err = op.PatchFunc(t); err != nil {
+					return nil, &BatchError{Index: i, Err: err}
+				}
+			}
+			u, err := s.prepareUpdate(ctx, t, p)
+			if err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			write(i, OpUpdate, t)
+			if u.next != nil {
+				write(i, OpCreate, u.next)
+			}
+			if u.rollUp {
+				parents[t.ParentID] = true
+			}
+			results[i] = t
+		case OpDelete:
+			t, err := s.current(ctx, op.ID, op.Version)
+			if err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			write(i, OpDelete, t)
+			if t.ParentID != 0 {
+				parents[t.ParentID] = true
+			}
+		default:
+			return nil, &BatchError{Index: i, Err: ErrUnknownOp}
+		}
+	}
+
+	if err := s.repo.Apply(ctx, writes, s.now()); err != nil {
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			return nil, &BatchError{Index: writeOps[batchErr.Index], Err: batchErr.Err}
+		}
+		return nil, err
+	}
+	s.emitWrites(writes)
+	for parentID := range parents {
+		if err := s.rollUp(ctx, parentID); err != nil {
+			return nil, err
+		}
+	}
+	// Todos of the batch that were rolled up as parents changed since.
+	for i, t := range results {
+		if t == nil || !parents[t.ID] {
+			continue
+		}
+		current, err := s.repo.FindByID(ctx, t.OwnerID, t.ID)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = current
+	}
+	return results, nil
+}
+
+// DeleteTodos moves every todo matching the filters of opts to the trash
+// at once, and returns how many it deleted. Ordering and pagination
+// options are ignored.
+func (s *Service) DeleteTodos(ctx context.Context, opts ListOptions) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.DeleteTodos")
+	defer tracing.End(span, &err)
+
+	opts.Sort, opts.Desc, opts.After = "", false, nil
+	if err := opts.normalize(); err != nil {
+		return 0, err
+	}
+	opts.OwnerID = auth.UserID(ctx)
+	opts.Now = s.now()
+	opts.Limit = 0
+
+	var n int
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		n, err = tx.deleteTodos(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// deleteTodos deletes the todos matching normalized opts for DeleteTodos,
+// inside its transaction, so todos created meanwhile are left alone.
+func (s *Service) deleteTodos(ctx context.Context, opts ListOptions) (int, error) {
+	todos, err := s.repo.FindAll(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+	matched := make(map[int64]bool, len(todos))
+	for _, t := range todos {
+		matched[t.ID] = true
+	}
+	var writes []Write
+	parents := make(map[int64]bool)
+	for _, t := range todos {
+		// Subtasks go with their parent.
+		if matched[t.ParentID] {
+			continue
+		}
+		writes = append(writes, Write{Op: OpDelete, Todo: t})
+		if t.ParentID != 0 {
+			parents[t.ParentID] = true
+		}
+	}
+	if err := s.repo.Apply(ctx, writes, s.now()); err != nil {
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			return 0, batchErr.Err
+		}
+		return 0, err
+	}
+	s.emitWrites(writes)
+	for parentID := range parents {
+		if err := s.rollUp(ctx, parentID); err != nil {
+			return 0, err
+		}
+	}
+	return len(writes), nil
+}
+
+// emitWrites records an event for each write applied.
+func (s *Service) emitWrites(writes []Write) {
+	actions := map[Op]string{OpCreate: ActionCreated, OpUpdate: ActionUpdated, OpDelete: ActionDeleted}
+	for _, w := range writes {
+		s.emit(actions[w.Op], w.Todo)
+	}
+}
+
+// current reads a todo an operation changes, checking its version if one
+// is given.
+func (s *Service) current(ctx context.Context, id, version int64) (*Todo, error) {
+	t, err := s.repo.FindByID(ctx, auth.UserID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && t.Version != version {
+		return nil, ErrConflict
+	}
+	return t, nil
+}
@@ -2,17 +2,71 @@ package todo
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
+// Priorities range from PriorityNone to PriorityHigh.
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var (
+	// ErrInvalidPriority is returned when a priority is out of range.
+	ErrInvalidPriority = fmt.Errorf("%w: priority must be between %d and %d", ErrInvalid, PriorityNone, PriorityHigh)
+	// ErrNestedSubtask is returned when adding a subtask to a subtask.
+	ErrNestedSubtask = fmt.Errorf("%w: subtasks cannot have subtasks", ErrInvalid)
+)
+
 // Todo represents a single todo item.
 type Todo struct {
-	ID          int64     `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description,omitempty"`
-	Completed   bool      `json:"completed"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int64    `json:"id"`
+	OwnerID     int64    `json:"-"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Completed   bool     `json:"completed"`
+	Tags        []string `json:"tags"`
+	// DueAt is nil for todos without a due date.
+	DueAt    *time.Time `json:"due_at"`
+	Priority int        `json:"priority"`
+	// ParentID is the todo this one is a subtask of, or 0.
+	ParentID int64 `json:"parent_id,omitempty"`
+	// ProjectID is the project the todo belongs to, or 0.
+	ProjectID int64 `json:"project_id,omitempty"`
+	// Position is the todo's rank in its owner's manual order (see package
+	// rank). Repositories assign new todos without one a position at the
+	// end.
+	Position string `json:"position"`
+	// AutoComplete makes the todo's completion follow its subtasks: it is
+	// completed once all of them are and reopened when one is not.
+	AutoComplete bool `json:"auto_complete"`
+	// Recurrence is nil for todos that do not repeat.
+	Recurrence *Recurrence `json:"recurrence"`
+	// Progress is set by repositories on todos that have subtasks.
+	Progress *Progress `json:"progress,omitempty"`
+	// Match is set by repositories on the results of a search.
+	Match     *Match    `json:"match,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the todo is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Version is incremented on every update and backs optimistic
+	// concurrency control.
+	Version int64 `json:"version"`
+}
+
+// Progress counts the completed subtasks of a todo.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// OverdueAt reports whether t is incomplete and was due before now.
+func (t *Todo) OverdueAt(now time.Time) bool {
+	return !t.Completed && t.DueAt != nil && t.DueAt.Before(now)
 }
 
 // Validate validates the Todo struct.
@@ -20,5 +74,75 @@ func (t *Todo) Validate() error {
 	if t.Title == "" {
 		return errors.New("title is required")
 	}
+	if t.Priority < PriorityNone || t.Priority > PriorityHigh {
+		return ErrInvalidPriority
+	}
+	if t.Recurrence != nil {
+		if err := t.Recurrence.validate(t.DueAt); err != nil {
+			return err
+		}
+	}
+	for _, tag := range t.Tags {
+		if _, err := NormalizeTag(tag); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// Patch describes a partial update of a todo. Nil fields are left unchanged.
+type Patch struct {
+	Title       *string
+	Description *string
+	Completed   *bool
+	Tags        *[]string
+	DueAt       *time.Time
+	// ClearDueAt removes the due date. It takes precedence over DueAt.
+	ClearDueAt bool
+	Priority   *int
+	// ProjectID moves the todo to a project, or out of any when it points
+	// to 0.
+	ProjectID    *int64
+	AutoComplete *bool
+	Recurrence   *Recurrence
+	// ClearRecurrence stops the todo from repeating. It takes precedence
+	// over Recurrence.
+	ClearRecurrence bool
+}
+
+// Apply sets the fields present in p on t.
+func (p Patch) Apply(t *Todo) {
+	if p.Title != nil {
+		t.Title = *p.Title
+	}
+	if p.Description != nil {
+		t.Description = *p.Description
+	}
+	if p.Completed != nil {
+		t.Completed = *p.Completed
+	}
+	if p.Tags != nil {
+		t.Tags = append([]string{}, *p.Tags...)
+	}
+	if p.ClearDueAt {
+		t.DueAt = nil
+	} else if p.DueAt != nil {
+		due := *p.DueAt
+		t.DueAt = &due
+	}
+	if p.Priority != nil {
+		t.Priority = *p.Priority
+	}
+	if p.ProjectID != nil {
+		t.ProjectID = *p.ProjectID
+	}
+	if p.AutoComplete != nil {
+		t.AutoComplete = *p.AutoComplete
+	}
+	if p.ClearRecurrence {
+		t.Recurrence = nil
+	} else if p.Recurrence != nil {
+		rec := *p.Recurrence
+		t.Recurrence = &rec
+	}
+}
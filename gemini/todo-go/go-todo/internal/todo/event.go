@@ -0,0 +1,178 @@
+package todo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+)
+
+const (
+	// EventBufferSize is how many recent events the service keeps for
+	// subscribers resuming after a disconnect.
+	EventBufferSize = 1000
+	// subscriberBacklog is how many events a subscriber may fall behind
+	// before it is dropped.
+	subscriberBacklog = 64
+)
+
+// Event reports a change to a todo. Its Type is one of the history
+// actions, such as ActionCreated. Deleted todos are reported as they were
+// before the delete; their subtasks go with them without events of their
+// own.
+type Event struct {
+	// ID orders the events of all owners. Subscribers resume after the
+	// last ID they saw. IDs are only comparable with IDs the same process
+	// published; those of an earlier process are all lower.
+	ID      int64     `json:"id"`
+	Type    string    `json:"type"`
+	OwnerID int64     `json:"-"`
+	Todo    *Todo     `json:"todo"`
+	At      time.Time `json:"at"`
+}
+
+// Bus publishes events to subscribers, keeping the most recent ones so
+// subscribers can resume after a disconnect.
+type Bus struct {
+	mu     sync.Mutex
+	nextID int64
+	// recent holds the last events, oldest first, up to size of them.
+	recent []Event
+	size   int
+	subs   map[*Subscription]bool
+}
+
+// NewBus creates a bus keeping the last size events. Event IDs count up
+// from the time the bus is created in microseconds, so that the IDs an
+// earlier process published, at less than one event per microsecond, are
+// all lower, and subscribers resuming after one of them are told that
+// events were lost.
+func NewBus(size int) *Bus {
+	return &Bus{nextID: time.Now().UnixMicro(), size: size, subs: make(map[*Subscription]bool)}
+}
+
+// Subscription receives the events of one owner.
+type Subscription struct {
+	bus     *Bus
+	ownerID int64
+	events  chan Event
+	// Lost is set if events after the requested one are no longer kept,
+	// so the subscriber must reload the todos it tracks.
+	Lost bool
+}
+
+// Events returns the channel delivering the events. It is closed when the
+// subscription is closed, or when the subscriber falls too far behind, in
+// which case it should resubscribe after the last event it received.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+// Publish numbers events and delivers them to the subscribers of their
+// owners.
+func (b *Bus) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range events {
+		e.ID = b.nextID
+		b.nextID++
+		b.recent = append(b.recent, e)
+		if len(b.recent) > b.size {
+			b.recent = b.recent[len(b.recent)-b.size:]
+		}
+		for sub := range b.subs {
+			if sub.ownerID != e.OwnerID {
+				continue
+			}
+			select {
+			case sub.events <- e:
+			default:
+				b.drop(sub)
+			}
+		}
+	}
+}
+
+// Subscribe subscribes to the events of an owner published after the
+// event with ID after, or from now on if after is 0.
+func (b *Bus) Subscribe(ownerID, after int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	lost := false
+	if after > 0 {
+		oldest := b.nextID
+		if len(b.recent) > 0 {
+			oldest = b.recent[0].ID
+		}
+		lost = after < oldest-1 || after >= b.nextID
+		for _, e := range b.recent {
+			if e.ID > after && e.OwnerID == ownerID {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		bus:     b,
+		ownerID: ownerID,
+		events:  make(chan Event, subscriberBacklog+len(backlog)),
+		Lost:    lost,
+	}
+	for _, e := range backlog {
+		sub.events <- e
+	}
+	b.subs[sub] = true
+	return sub
+}
+
+// Close ends every subscription.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
+
+// drop removes a subscriber. The caller must hold b.mu.
+func (b *Bus) drop(sub *Subscription) {
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Subscribe subscribes to the changes to the todos of the user in the
+// context, starting after the event with ID after if it is non-zero.
+func (s *Service) Subscribe(ctx context.Context, after int64) *Subscription {
+	return s.events.Subscribe(auth.UserID(ctx), after)
+}
+
+// CloseSubscriptions ends the current subscriptions, so that event streams
+// end and their clients reconnect, for example when the server shuts down.
+func (s *Service) CloseSubscriptions() {
+	s.events.Close()
+}
+
+// emit records an event for a change to a todo. Events are published once
+// the transaction making the change commits.
+func (s *Service) emit(typ string, t *Todo) {
+	c := *t
+	e := Event{Type: typ, OwnerID: t.OwnerID, Todo: &c, At: s.now()}
+	if s.pending == nil {
+		s.events.Publish(e)
+		return
+	}
+	*s.pending = append(*s.pending, e)
+}
@@ -0,0 +1,140 @@
+package todo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// Actions recorded in a todo's history.
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+)
+
+// HistoryEntry records one change to a todo. Repositories append an entry
+// in the same transaction as every write to a todo, with the user in the
+// context as the actor.
+type HistoryEntry struct {
+	ID      int64 `json:"id"`
+	TodoID  int64 `json:"todo_id"`
+	OwnerID int64 `json:"-"`
+	// ActorID is the user that made the change, or 0 for changes made by
+	// the server itself.
+	ActorID int64  `json:"actor_id"`
+	Action  string `json:"action"`
+	// Changes holds the old and new value of every field an update changed,
+	// keyed by the field's JSON name. It is empty for other actions.
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+	// Version is the todo's version after the change.
+	Version int64     `json:"version"`
+	At      time.Time `json:"at"`
+}
+
+// FieldChange holds the JSON encoded values of a field before and after an
+// update. A field that was unset is null.
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// untrackedFields are left out of history: bookkeeping fields, progress,
+// which changes with a todo's subtasks rather than the todo itself, and
+// search matches.
+var untrackedFields = map[string]bool{
+	"id":         true,
+	"progress":   true,
+	"match":      true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"version":    true,
+}
+
+var null = json.RawMessage("null")
+
+// Diff returns the fields that differ between two states of a todo, in the
+// form recorded by HistoryEntry.Changes.
+func Diff(before, after *Todo) (map[string]FieldChange, error) {
+	old, err := historyFields(before)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := historyFields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]FieldChange)
+	for name, value := range changed {
+		if prev, ok := old[name]; !ok || !bytes.Equal(prev, value) {
+			changes[name] = FieldChange{Old: valueOrNull(old, name), New: value}
+		}
+	}
+	for name, prev := range old {
+		if _, ok := changed[name]; !ok {
+			changes[name] = FieldChange{Old: prev, New: null}
+		}
+	}
+	return changes, nil
+}
+
+// historyFields encodes the tracked fields of t. Times are converted to UTC
+// so that the same instant never shows up as a change.
+func historyFields(t *Todo) (map[string]json.RawMessage, error) {
+	c := *t
+	if c.Tags == nil {
+		c.Tags = []string{}
+	}
+	if c.DueAt != nil {
+		due := c.DueAt.UTC()
+		c.DueAt = &due
+	}
+	if c.Recurrence != nil {
+		rec := *c.Recurrence
+		rec.Start = rec.Start.UTC()
+		c.Recurrence = &rec
+	}
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		if untrackedFields[name] || bytes.Equal(value, null) {
+			delete(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+func valueOrNull(fields map[string]json.RawMessage, name string) json.RawMessage {
+	if value, ok := fields[name]; ok {
+		return value
+	}
+	return null
+}
+
+// TodoHistory returns the changes made to one of the user's todos, oldest
+// first. The history of a todo in the trash stays readable.
+func (s *Service) TodoHistory(ctx context.Context, id int64) (_ []HistoryEntry, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.TodoHistory")
+	defer tracing.End(span, &err)
+
+	entries, err := s.repo.History(ctx, auth.UserID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []HistoryEntry{}
+	}
+	return entries, nil
+}
@@ -0,0 +1,297 @@
+package todo
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// does not match the requested ordering.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	// DefaultLimit is the page size used when none is requested.
+	DefaultLimit = 50
+	// MaxLimit is the largest page size a caller may request.
+	MaxLimit = 200
+)
+
+// SortField is a field todos can be ordered by.
+type SortField string
+
+const (
+	SortCreated  SortField = "created"
+	SortUpdated  SortField = "updated"
+	SortTitle    SortField = "title"
+	SortPriority SortField = "priority"
+	SortPosition SortField = "position"
+	// SortRelevance orders search results by their Match.Rank. It is the
+	// default when searching.
+	SortRelevance SortField = "relevance"
+)
+
+// ListOptions controls filtering, ordering and pagination of todo listings.
+// Nil filters are not applied. Ties in the sort field are broken by ID.
+type ListOptions struct {
+	// OwnerID scopes the listing to one user's todos. The service sets it
+	// from the request context.
+	OwnerID int64
+
+	// ParentID restricts the listing to the subtasks of a todo, or to
+	// top-level todos when it points to 0.
+	ParentID *int64
+	// ProjectID restricts the listing to the todos of a project, or to todos
+	// outside any project when it points to 0. Repositories leave out the
+	// todos of archived projects unless ProjectID names the project or
+	// IncludeArchived is set.
+	ProjectID       *int64
+	IncludeArchived bool
+	// Trashed lists the trash instead: todos that were deleted on their own
+	// rather than together with their parent.
+	Trashed bool
+
+	Completed     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// DueAfter and DueBefore only match todos with a due date.
+	DueAfter  *time.Time
+	DueBefore *time.Time
+	// Overdue matches incomplete todos due before Now, or with false all
+	// other todos. The service sets Now to the current time.
+	Overdue *bool
+	Now     time.Time
+	// Tags restricts the listing to todos carrying any of the tags, or all
+	// of them when MatchAllTags is set.
+	Tags         []string
+	MatchAllTags bool
+	// Query restricts the listing to todos matching a full-text search (see
+	// SearchTerms). Repositories set Todo.Match on the results.
+	Query string
+
+	Sort SortField
+	Desc bool
+
+	// Limit is the maximum number of todos to return. Repositories treat
+	// zero as unlimited.
+	Limit int
+	// After restricts the listing to todos that sort after the cursor.
+	After *Cursor
+}
+
+// Page is a single page of a todo listing.
+type Page struct {
+	Todos []*Todo
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// Cursor is the position of the last todo on a page. It is handed to
+// clients as an opaque string.
+type Cursor struct {
+	Sort  SortField `json:"s"`
+	Desc  bool      `json:"d,omitempty"`
+	ID    int64     `json:"i"`
+	Time  time.Time `json:"t"`
+	Title string    `json:"n,omitempty"`
+	// Priority is stored as a pointer so that zero survives omitempty.
+	Priority *int    `json:"p,omitempty"`
+	Position string  `json:"o,omitempty"`
+	Rank     float64 `json:"r,omitempty"`
+}
+
+// CursorFor returns the cursor positioned at t for the given ordering.
+func CursorFor(t *Todo, sort SortField, desc bool) Cursor {
+	c := Cursor{Sort: sort, Desc: desc, ID: t.ID}
+	switch sort {
+	case SortUpdated:
+		c.Time = t.UpdatedAt
+	case SortTitle:
+		c.Title = t.Title
+	case SortPriority:
+		p := t.Priority
+		c.Priority = &p
+	case SortPosition:
+		c.Position = t.Position
+	case SortRelevance:
+		if t.Match != nil {
+			c.Rank = t.Match.Rank
+		}
+	default:
+		c.Time = t.CreatedAt
+	}
+	return c
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 || !c.Sort.valid() {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort == SortPriority && c.Priority == nil || c.Sort == SortPosition && c.Position == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func (f SortField) valid() bool {
+	switch f {
+	case SortCreated, SortUpdated, SortTitle, SortPriority, SortPosition, SortRelevance:
+		return true
+	}
+	return false
+}
+
+// normalize applies defaults and checks the options for consistency.
+func (o *ListOptions) normalize() error {
+	o.Query = strings.TrimSpace(o.Query)
+	if o.Query != "" && len(SearchTerms(o.Query)) == 0 {
+		return ErrInvalidQuery
+	}
+	if o.Sort == "" {
+		o.Sort = SortCreated
+		if o.Query != "" {
+			o.Sort = SortRelevance
+		}
+	}
+	if !o.Sort.valid() {
+		return ErrInvalid
+	}
+	if o.Sort == SortRelevance && o.Query == "" {
+		return ErrInvalidQuery
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultLimit
+	}
+	if o.Limit > MaxLimit {
+		o.Limit = MaxLimit
+	}
+	if o.After != nil && (o.After.Sort != o.Sort || o.After.Desc != o.Desc) {
+		return ErrInvalidCursor
+	}
+	tags, err := normalizeTags(o.Tags)
+	if err != nil {
+		return err
+	}
+	o.Tags = tags
+	return nil
+}
+
+// ExcludesArchived reports whether the todos of archived projects are left
+// out of the listing.
+func (o ListOptions) ExcludesArchived() bool {
+	return o.ProjectID == nil && !o.IncludeArchived
+}
+
+// Matches reports whether t passes the filters and lies after the cursor.
+// It is the in-process counterpart of the WHERE clause built by SQL
+// repositories. When searching, t.Match must have been set by Search.
+func (o ListOptions) Matches(t *Todo) bool {
+	if t.OwnerID != o.OwnerID || (t.DeletedAt != nil) != o.Trashed {
+		return false
+	}
+	if o.ParentID != nil && *o.ParentID != t.ParentID {
+		return false
+	}
+	if o.ProjectID != nil && *o.ProjectID != t.ProjectID {
+		return false
+	}
+	if o.Completed != nil && *o.Completed != t.Completed {
+		return false
+	}
+	if o.CreatedAfter != nil && !t.CreatedAt.After(*o.CreatedAfter) {
+		return false
+	}
+	if o.CreatedBefore != nil && !t.CreatedAt.Before(*o.CreatedBefore) {
+		return false
+	}
+	if o.UpdatedAfter != nil && !t.UpdatedAt.After(*o.UpdatedAfter) {
+		return false
+	}
+	if o.UpdatedBefore != nil && !t.UpdatedAt.Before(*o.UpdatedBefore) {
+		return false
+	}
+	if o.DueAfter != nil && (t.DueAt == nil || !t.DueAt.After(*o.DueAfter)) {
+		return false
+	}
+	if o.DueBefore != nil && (t.DueAt == nil || !t.DueAt.Before(*o.DueBefore)) {
+		return false
+	}
+	if o.Overdue != nil && *o.Overdue != t.OverdueAt(o.Now) {
+		return false
+	}
+	if len(o.Tags) > 0 && !o.matchesTags(t) {
+		return false
+	}
+	if o.Query != "" && t.Match == nil {
+		return false
+	}
+	if o.After != nil && o.compare(t, o.After) <= 0 {
+		return false
+	}
+	return true
+}
+
+func (o ListOptions) matchesTags(t *Todo) bool {
+	has := make(map[string]bool, len(t.Tags))
+	for _, tag := range t.Tags {
+		has[tag] = true
+	}
+	for _, tag := range o.Tags {
+		if has[tag] && !o.MatchAllTags {
+			return true
+		}
+		if !has[tag] && o.MatchAllTags {
+			return false
+		}
+	}
+	return o.MatchAllTags
+}
+
+// Less reports whether a sorts before b in the requested order.
+func (o ListOptions) Less(a, b *Todo) bool {
+	c := CursorFor(b, o.Sort, o.Desc)
+	return o.compare(a, &c) < 0
+}
+
+// compare orders t relative to the cursor position, honouring Desc.
+func (o ListOptions) compare(t *Todo, c *Cursor) int {
+	k := CursorFor(t, o.Sort, o.Desc)
+
+	var n int
+	switch o.Sort {
+	case SortTitle:
+		n = strings.Compare(k.Title, c.Title)
+	case SortPriority:
+		n = cmp.Compare(*k.Priority, *c.Priority)
+	case SortPosition:
+		n = strings.Compare(k.Position, c.Position)
+	case SortRelevance:
+		n = cmp.Compare(k.Rank, c.Rank)
+	default:
+		n = k.Time.Compare(c.Time)
+	}
+	if n == 0 {
+		n = cmp.Compare(k.ID, c.ID)
+	}
+	if o.Desc {
+		return -n
+	}
+	return n
+}
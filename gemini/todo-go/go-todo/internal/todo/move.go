@@ -0,0 +1,122 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/rank"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// ErrInvalidMove is returned when a todo is moved next to itself, next to a
+// todo that does not exist, or between todos that are out of order.
+var ErrInvalidMove = fmt.Errorf("%w: invalid move", ErrInvalid)
+
+// MoveTodo moves a todo in the manual order so that it comes right after
+// the todo with ID after and right before the todo with ID before. Either
+// may be 0, in which case the todo is placed directly next to the other
+// one. Only the moved todo is written. If version is non-zero the move
+// fails with ErrConflict unless the todo is still at that version.
+func (s *Service) MoveTodo(ctx context.Context, id, version, after, before int64) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.MoveTodo")
+	defer tracing.End(span, &err)
+
+	var todo *Todo
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		todo, err = tx.move(ctx, id, version, after, before)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// move moves a todo for MoveTodo, inside its transaction.
+func (s *Service) move(ctx context.Context, id, version, after, before int64) (*Todo, error) {
+	todo, err := s.repo.FindByID(ctx, auth.UserID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && todo.Version != version {
+		return nil, ErrConflict
+	}
+	if after == 0 && before == 0 || after == id || before == id {
+		return nil, ErrInvalidMove
+	}
+
+	var lo, hi string
+	if after != 0 {
+		neighbour, err := s.neighbour(ctx, after)
+		if err != nil {
+			return nil, err
+		}
+		lo = neighbour.Position
+		if before == 0 {
+			if hi, err = s.adjacent(ctx, neighbour, false, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if before != 0 {
+		neighbour, err := s.neighbour(ctx, before)
+		if err != nil {
+			return nil, err
+		}
+		hi = neighbour.Position
+		if after == 0 {
+			if lo, err = s.adjacent(ctx, neighbour, true, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	position, err := rank.Between(lo, hi)
+	if err != nil {
+		return nil, ErrInvalidMove
+	}
+	todo.Position = position
+	todo.UpdatedAt = s.now()
+	if err := s.repo.Update(ctx, todo); err != nil {
+		return nil, err
+	}
+	s.emit(ActionUpdated, todo)
+	return todo, nil
+}
+
+// neighbour finds a todo the caller is moving another one next to.
+func (s *Service) neighbour(ctx context.Context, id int64) (*Todo, error) {
+	t, err := s.repo.FindByID(ctx, auth.UserID(ctx), id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidMove
+	}
+	return t, err
+}
+
+// adjacent returns the position of the todo following t in the manual
+// order, or preceding it if backwards is set. The todo being moved is
+// skipped, and the end of the list is returned as an empty position.
+func (s *Service) adjacent(ctx context.Context, t *Todo, backwards bool, moving int64) (string, error) {
+	after := CursorFor(t, SortPosition, backwards)
+	todos, err := s.repo.FindAll(ctx, ListOptions{
+		OwnerID:         t.OwnerID,
+		IncludeArchived: true,
+		Sort:            SortPosition,
+		Desc:            backwards,
+		Limit:           2,
+		After:           &after,
+		Now:             s.now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, next := range todos {
+		if next.ID != moving {
+			return next.Position, nil
+		}
+	}
+	return "", nil
+}
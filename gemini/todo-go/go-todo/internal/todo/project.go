@@ -0,0 +1,168 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// MaxProjectNameLength is the longest project name, in characters.
+const MaxProjectNameLength = 100
+
+var (
+	// ErrInvalidProjectName is returned when a project name is empty or too
+	// long.
+	ErrInvalidProjectName = fmt.Errorf("%w: invalid project name", ErrInvalid)
+	// ErrUnknownProject is returned when a todo is moved to a project that
+	// does not exist.
+	ErrUnknownProject = fmt.Errorf("%w: unknown project", ErrInvalid)
+	// ErrProjectNotFound is returned when a project is not found.
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrProjectExists is returned when creating or renaming to a project
+	// name that is already in use.
+	ErrProjectExists = errors.New("project already exists")
+)
+
+// Project groups todos. Archiving a project hides its todos from listings
+// without deleting them.
+type Project struct {
+	ID        int64     `json:"id"`
+	OwnerID   int64     `json:"-"`
+	Name      string    `json:"name"`
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProjectPatch describes a partial update of a project. Nil fields are left
+// unchanged.
+type ProjectPatch struct {
+	Name     *string
+	Archived *bool
+}
+
+// ProjectRepository defines the interface for project storage. Like
+// Repository, every method is scoped to a single owner.
+type ProjectRepository interface {
+	// ListProjects returns the owner's projects by name.
+	ListProjects(ctx context.Context, ownerID int64) ([]*Project, error)
+	// CreateProject stores a new project, returning ErrProjectExists if the
+	// name is in use.
+	CreateProject(ctx context.Context, project *Project) error
+	FindProject(ctx context.Context, ownerID, id int64) (*Project, error)
+	// UpdateProject stores the name and archived state of a project.
+	UpdateProject(ctx context.Context, project *Project) error
+	// DeleteProject removes a project. Its todos are kept and no longer
+	// belong to any project.
+	DeleteProject(ctx context.Context, ownerID, id int64) error
+}
+
+// normalizeProjectName trims a project name and checks that it is valid.
+func normalizeProjectName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxProjectNameLength {
+		return "", ErrInvalidProjectName
+	}
+	return name, nil
+}
+
+// ListProjects lists the projects, including archived ones, by name.
+func (s *Service) ListProjects(ctx context.Context) (_ []*Project, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.ListProjects")
+	defer tracing.End(span, &err)
+
+	projects, err := s.repo.ListProjects(ctx, auth.UserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if projects == nil {
+		projects = []*Project{}
+	}
+	return projects, nil
+}
+
+// CreateProject creates a new project.
+func (s *Service) CreateProject(ctx context.Context, name string) (_ *Project, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.CreateProject")
+	defer tracing.End(span, &err)
+
+	name, err = normalizeProjectName(name)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	project := &Project{
+		OwnerID:   auth.UserID(ctx),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateProject(ctx, project); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// GetProject gets a single project by its ID.
+func (s *Service) GetProject(ctx context.Context, id int64) (_ *Project, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.GetProject")
+	defer tracing.End(span, &err)
+
+	return s.repo.FindProject(ctx, auth.UserID(ctx), id)
+}
+
+// UpdateProject renames, archives or unarchives a project.
+func (s *Service) UpdateProject(ctx context.Context, id int64, p ProjectPatch) (_ *Project, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.UpdateProject")
+	defer tracing.End(span, &err)
+
+	var project *Project
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		if project, err = tx.repo.FindProject(ctx, auth.UserID(ctx), id); err != nil {
+			return err
+		}
+		if p.Name != nil {
+			if project.Name, err = normalizeProjectName(*p.Name); err != nil {
+				return err
+			}
+		}
+		if p.Archived != nil {
+			project.Archived = *p.Archived
+		}
+		project.UpdatedAt = tx.now()
+
+		return tx.repo.UpdateProject(ctx, project)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// DeleteProject deletes a project. Its todos are kept outside any project.
+func (s *Service) DeleteProject(ctx context.Context, id int64) (err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.DeleteProject")
+	defer tracing.End(span, &err)
+
+	return s.repo.DeleteProject(ctx, auth.UserID(ctx), id)
+}
+
+// checkProject verifies that a todo moved to a project is moved to one of
+// its owner's projects.
+func (s *Service) checkProject(ctx context.Context, t *Todo) error {
+	if t.ProjectID == 0 {
+		return nil
+	}
+	_, err := s.repo.FindProject(ctx, t.OwnerID, t.ProjectID)
+	if errors.Is(err, ErrProjectNotFound) {
+		return ErrUnknownProject
+	}
+	return err
+}
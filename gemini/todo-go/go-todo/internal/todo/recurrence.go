@@ -0,0 +1,107 @@
+package todo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gemini/go-todo/internal/rrule"
+)
+
+// ErrInvalidRecurrence is returned when a recurrence has an unsupported rule
+// or time zone, or is set on a todo without a due date.
+var ErrInvalidRecurrence = fmt.Errorf("%w: invalid recurrence", ErrInvalid)
+
+// Recurrence makes a todo repeat. Completing an occurrence creates the next
+// one, due at the next date the rule yields after the completed one's due
+// date, and moves the recurrence over to it.
+type Recurrence struct {
+	// Rule is an iCalendar RRULE such as "FREQ=WEEKLY;BYDAY=MO,TH". See
+	// package rrule for the supported subset.
+	Rule string `json:"rule"`
+	// TimeZone is the IANA time zone whose wall clock the occurrences
+	// follow. It defaults to UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+	// Start is the due date of the first occurrence and Occurrence the
+	// number of this one, counting from 1. The service maintains both and
+	// resets them when the rule or time zone changes.
+	Start      time.Time `json:"start"`
+	Occurrence int       `json:"occurrence"`
+}
+
+func (r *Recurrence) location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.TimeZone)
+}
+
+// validate checks the recurrence of a todo due at due.
+func (r *Recurrence) validate(due *time.Time) error {
+	if due == nil {
+		return ErrInvalidRecurrence
+	}
+	if _, err := rrule.Parse(r.Rule); err != nil {
+		return ErrInvalidRecurrence
+	}
+	if _, err := r.location(); err != nil {
+		return ErrInvalidRecurrence
+	}
+	return nil
+}
+
+// prepareRecurrence canonicalizes the rule of t's recurrence and carries
+// the series position over from old, the recurrence before the change,
+// unless the schedule changed. Invalid recurrences are left for validation
+// to report.
+func prepareRecurrence(old *Recurrence, t *Todo) {
+	rec := t.Recurrence
+	if rec == nil || t.DueAt == nil {
+		return
+	}
+	if rule, err := rrule.Parse(rec.Rule); err == nil {
+		rec.Rule = rule.String()
+	}
+	if old != nil && old.Rule == rec.Rule && old.TimeZone == rec.TimeZone {
+		rec.Start, rec.Occurrence = old.Start, old.Occurrence
+		return
+	}
+	rec.Start, rec.Occurrence = *t.DueAt, 1
+}
+
+// nextOccurrence returns the todo for the occurrence after t, or nil when
+// the series has ended.
+func nextOccurrence(t *Todo, now time.Time) *Todo {
+	rec := t.Recurrence
+	rule, err := rrule.Parse(rec.Rule)
+	if err != nil {
+		return nil
+	}
+	if rule.Count > 0 && rec.Occurrence >= rule.Count {
+		return nil
+	}
+	loc, err := rec.location()
+	if err != nil {
+		return nil
+	}
+	due, ok := rule.Next(rec.Start.In(loc), *t.DueAt)
+	if !ok {
+		return nil
+	}
+
+	next := *rec
+	next.Occurrence++
+	return &Todo{
+		OwnerID:      t.OwnerID,
+		ParentID:     t.ParentID,
+		ProjectID:    t.ProjectID,
+		Title:        t.Title,
+		Description:  t.Description,
+		Tags:         append([]string{}, t.Tags...),
+		DueAt:        &due,
+		Priority:     t.Priority,
+		AutoComplete: t.AutoComplete,
+		Recurrence:   &next,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
@@ -0,0 +1,112 @@
+package todo
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned when a search query contains no words, or
+// todos are ordered by relevance without one.
+var ErrInvalidQuery = fmt.Errorf("%w: search query must contain a word", ErrInvalid)
+
+// Snippets wrap the words matching a search query in these markers. The
+// rest of a snippet is HTML-escaped, so that it can be rendered as HTML.
+const (
+	MatchStart = "<mark>"
+	MatchEnd   = "</mark>"
+)
+
+// Match describes how a todo matched a search query.
+type Match struct {
+	// Rank orders matches from best to worst: lower ranks are better. Ranks
+	// are only comparable within one listing.
+	Rank float64 `json:"rank"`
+	// Snippet is an HTML excerpt of the title or description with the
+	// matching words highlighted. It is empty if the repository cannot
+	// produce one.
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// SearchTerms splits a search query into the lower-cased words it matches.
+// Every word must occur in a todo's title or description, where it matches
+// any word it is a prefix of.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), notWordRune)
+}
+
+// Search reports how t matches o.Query, or returns nil if it does not. It is
+// the in-process counterpart of the full-text index of SQL repositories:
+// words in the title count twice as much as words in the description.
+func (o ListOptions) Search(t *Todo) *Match {
+	terms := SearchTerms(o.Query)
+	found := make([]bool, len(terms))
+	title, titleHits := highlight(t.Title, terms, found)
+	description, descriptionHits := highlight(t.Description, terms, found)
+	for _, f := range found {
+		if !f {
+			return nil
+		}
+	}
+
+	m := &Match{Rank: -float64(2*titleHits + descriptionHits), Snippet: title}
+	if titleHits == 0 {
+		m.Snippet = description
+	}
+	return m
+}
+
+// highlight marks the words of text that start with one of the terms and
+// returns the result, HTML-escaped, with the number of words marked. It
+// records the terms it found in found.
+func highlight(text string, terms []string, found []bool) (string, int) {
+	var b strings.Builder
+	hits := 0
+	rest := text
+	for rest != "" {
+		start := strings.IndexFunc(rest, isWordRune)
+		if start < 0 {
+			b.WriteString(html.EscapeString(rest))
+			break
+		}
+		b.WriteString(html.EscapeString(rest[:start]))
+		rest = rest[start:]
+		end := strings.IndexFunc(rest, notWordRune)
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+
+		matched := false
+		for i, term := range terms {
+			if strings.HasPrefix(strings.ToLower(word), term) {
+				found[i] = true
+				matched = true
+			}
+		}
+		if !matched {
+			b.WriteString(word)
+			continue
+		}
+		hits++
+		b.WriteString(MatchStart + word + MatchEnd)
+	}
+	return b.String(), hits
+}
+
+// EscapeSnippet HTML-escapes a snippet whose matches are wrapped in start
+// and end, and wraps them in MatchStart and MatchEnd instead. start and end
+// must not occur in the text itself.
+func EscapeSnippet(snippet, start, end string) string {
+	return strings.NewReplacer(start, MatchStart, end, MatchEnd).Replace(html.EscapeString(snippet))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func notWordRune(r rune) bool {
+	return !isWordRune(r)
+}
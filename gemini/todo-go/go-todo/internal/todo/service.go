@@ -4,90 +4,427 @@ import (
 	"context"
 	"errors"
 	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+	"go.opentelemetry.io/otel"
 )
 
+// tracer traces every Service method.
+var tracer = otel.Tracer("github.com/gemini/go-todo/internal/todo")
+
 var (
 	// ErrNotFound is returned when a todo is not found.
 	ErrNotFound = errors.New("todo not found")
 	// ErrInvalid is returned when a todo is invalid.
 	ErrInvalid = errors.New("todo invalid")
+	// ErrConflict is returned when a todo was modified concurrently or does
+	// not match the expected version.
+	ErrConflict = errors.New("todo version conflict")
 )
 
-// Repository defines the interface for todo storage.
+// Repository defines the interface for todo storage. Every method is
+// scoped to a single owner; todos of other owners behave as if they did not
+// exist.
+//
+// Create, Update, Delete and Restore append a HistoryEntry for each todo
+// they write, atomically with the write and with auth.UserID(ctx) as the
+// actor.
 type Repository interface {
+	// Create stores a new todo, positioning it after the owner's other todos
+	// unless todo.Position is set.
 	Create(ctx context.Context, todo *Todo) error
-	FindAll(ctx context.Context, completed *bool) ([]*Todo, error)
-	FindByID(ctx context.Context, id int64) (*Todo, error)
+	FindAll(ctx context.Context, opts ListOptions) ([]*Todo, error)
+	FindByID(ctx context.Context, ownerID, id int64) (*Todo, error)
+	// Update stores todo if the stored version equals todo.Version and then
+	// increments todo.Version, or returns ErrConflict.
 	Update(ctx context.Context, todo *Todo) error
-	Delete(ctx context.Context, id int64) error
+	// Delete moves a todo and its subtasks to the trash at the given time.
+	// Todos in the trash are only returned by FindAll with
+	// ListOptions.Trashed. A non-zero version makes the delete conditional
+	// on the stored version.
+	Delete(ctx context.Context, ownerID, id, version int64, at time.Time) error
+	// Restore takes a todo out of the trash together with the subtasks
+	// deleted along with it. It returns ErrNotFound if the todo is not in
+	// the trash on its own.
+	Restore(ctx context.Context, ownerID, id int64, at time.Time) error
+	// Purge permanently removes the todos of all owners that were moved to
+	// the trash before the given time, and returns how many it removed.
+	// Their history is removed with them.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// Apply performs writes in order as one atomic unit, deleting at the
+	// given time. If a write fails, none is applied and the error is a
+	// *BatchError giving its index.
+	Apply(ctx context.Context, writes []Write, at time.Time) error
+	// History returns the history of a todo, including one in the trash,
+	// oldest first. It returns ErrNotFound if the owner has no such todo.
+	History(ctx context.Context, ownerID, id int64) ([]HistoryEntry, error)
+	// AppendOutbox stores events in the outbox, from which they are
+	// delivered to webhooks. Service appends the events of each
+	// transaction before it commits.
+	AppendOutbox(ctx context.Context, events []Event) error
+	// WithTx runs fn with a repository whose reads and writes form one
+	// atomic unit that no concurrent write interleaves with. If fn returns
+	// an error, none of its writes is applied. Calling WithTx on the
+	// repository passed to fn joins the transaction. That repository must
+	// not be used after fn returns.
+	WithTx(ctx context.Context, fn func(repo Repository) error) error
+
+	// ListTags returns the owner's tags with their usage counts, by name.
+	ListTags(ctx context.Context, ownerID int64) ([]Tag, error)
+	// CreateTag registers a tag, returning ErrTagExists if it exists.
+	CreateTag(ctx context.Context, ownerID int64, name string) error
+	// RenameTag renames a tag on every todo carrying it.
+	RenameTag(ctx context.Context, ownerID int64, from, to string) error
+	// DeleteTag removes a tag from every todo carrying it.
+	DeleteTag(ctx context.Context, ownerID int64, name string) error
+
+	ProjectRepository
 }
 
-// Service provides todo-related operations.
+// Service provides todo-related operations. Todos are owned by the user
+// authenticated in the request context (see auth.WithUserID).
 type Service struct {
-	repo Repository
+	repo   Repository
+	now    func() time.Time
+	events *Bus
+	// pending collects the events of the transaction the service is bound
+	// to, if any.
+	pending *[]Event
+}
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithClock makes the service read the current time from now, which is
+// useful in tests.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
 }
 
 // NewService creates a new todo service.
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo, now: time.Now, events: NewBus(EventBufferSize)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// CreateTodo creates a new todo.
-func (s *Service) CreateTodo(ctx context.Context, title, description string) (*Todo, error) {
-	now := time.Now()
-	todo := &Todo{
-		Title:       title,
-		Description: description,
-		Completed:   false,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+// inTx runs fn with a service whose repository is bound to a transaction,
+// so the reads and writes fn makes through it are applied atomically. The
+// events fn emits are appended to the outbox in the same transaction, and
+// published if it commits.
+func (s *Service) inTx(ctx context.Context, fn func(tx *Service) error) error {
+	if s.pending != nil {
+		return fn(s)
 	}
+	var pending []Event
+	err := s.repo.WithTx(ctx, func(repo Repository) error {
+		pending = nil
+		tx := *s
+		tx.repo = repo
+		tx.pending = &pending
+		if err := fn(&tx); err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		return repo.AppendOutbox(ctx, pending)
+	})
+	if err != nil {
+		return err
+	}
+	s.events.Publish(pending...)
+	return nil
+}
 
-	if err := todo.Validate(); err != nil {
-		return nil, ErrInvalid
+// CreateTodo creates a new todo.
+func (s *Service) CreateTodo(ctx context.Context, title, description string) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.CreateTodo")
+	defer tracing.End(span, &err)
+
+	return s.createTodo(ctx, Patch{Title: &title, Description: &description})
+}
+
+// CreateTodoWith creates a new todo from the fields set in p.
+func (s *Service) CreateTodoWith(ctx context.Context, p Patch) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.CreateTodoWith")
+	defer tracing.End(span, &err)
+
+	return s.createTodo(ctx, p)
+}
+
+// createTodo creates a todo for CreateTodo and CreateTodoWith, within their
+// spans.
+func (s *Service) createTodo(ctx context.Context, p Patch) (*Todo, error) {
+	var todo *Todo
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		todo, err = tx.create(ctx, 0, p)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return todo, nil
+}
 
+func (s *Service) create(ctx context.Context, parentID int64, p Patch) (*Todo, error) {
+	todo, err := s.prepareCreate(ctx, parentID, p)
+	if err != nil {
+		return nil, err
+	}
 	if err := s.repo.Create(ctx, todo); err != nil {
 		return nil, err
 	}
+	s.emit(ActionCreated, todo)
+	return todo, nil
+}
+
+// prepareCreate builds and validates a new todo without storing it.
+func (s *Service) prepareCreate(ctx context.Context, parentID int64, p Patch) (*Todo, error) {
+	now := s.now()
+	todo := &Todo{
+		OwnerID:   auth.UserID(ctx),
+		ParentID:  parentID,
+		Completed: false,
+		Tags:      []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	p.Apply(todo)
+	prepareRecurrence(nil, todo)
 
+	if err := validate(todo); err != nil {
+		return nil, err
+	}
+	if err := s.checkProject(ctx, todo); err != nil {
+		return nil, err
+	}
 	return todo, nil
 }
 
-// ListTodos lists all todos.
-func (s *Service) ListTodos(ctx context.Context, completed *bool) ([]*Todo, error) {
-	return s.repo.FindAll(ctx, completed)
+// ListTodos lists a page of todos matching opts.
+func (s *Service) ListTodos(ctx context.Context, opts ListOptions) (_ *Page, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.ListTodos")
+	defer tracing.End(span, &err)
+
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	opts.OwnerID = auth.UserID(ctx)
+	opts.Now = s.now()
+
+	limit := opts.Limit
+	opts.Limit++ // fetch one extra to learn whether there is a next page
+	todos, err := s.repo.FindAll(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Todos: todos}
+	if len(todos) > limit {
+		page.Todos = todos[:limit]
+		page.NextCursor = CursorFor(page.Todos[limit-1], opts.Sort, opts.Desc).Encode()
+	}
+	return page, nil
 }
 
 // GetTodo gets a single todo by its ID.
-func (s *Service) GetTodo(ctx context.Context, id int64) (*Todo, error) {
-	return s.repo.FindByID(ctx, id)
+func (s *Service) GetTodo(ctx context.Context, id int64) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.GetTodo")
+	defer tracing.End(span, &err)
+
+	return s.repo.FindByID(ctx, auth.UserID(ctx), id)
+}
+
+// UpdateTodo replaces the title, description and completion state of a todo.
+// Completing an occurrence of a recurring todo creates the next occurrence.
+func (s *Service) UpdateTodo(ctx context.Context, id int64, title, description string, completed bool) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.UpdateTodo")
+	defer tracing.End(span, &err)
+
+	return s.patchTodo(ctx, id, 0, Patch{
+		Title:       &title,
+		Description: &description,
+		Completed:   &completed,
+	})
 }
 
-// UpdateTodo updates a todo.
-func (s *Service) UpdateTodo(ctx context.Context, id int64, title, description string, completed bool) (*Todo, error) {
-	todo, err := s.repo.FindByID(ctx, id)
+// PatchTodo applies a partial update to a todo. If version is non-zero the
+// update fails with ErrConflict unless the todo is still at that version.
+func (s *Service) PatchTodo(ctx context.Context, id, version int64, p Patch) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.PatchTodo")
+	defer tracing.End(span, &err)
+
+	return s.patchTodo(ctx, id, version, p)
+}
+
+// patchTodo updates a todo for UpdateTodo and PatchTodo, within their spans.
+func (s *Service) patchTodo(ctx context.Context, id, version int64, p Patch) (*Todo, error) {
+	var todo *Todo
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		if todo, err = tx.current(ctx, id, version); err != nil {
+			return err
+		}
+		u, err := tx.prepareUpdate(ctx, todo, p)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.repo.Update(ctx, todo); err != nil {
+			return err
+		}
+		tx.emit(ActionUpdated, todo)
+		if u.next != nil {
+			if err := tx.repo.Create(ctx, u.next); err != nil {
+				return err
+			}
+			tx.emit(ActionCreated, u.next)
+		}
+		if u.rollUp {
+			return tx.rollUp(ctx, todo.ParentID)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return todo, nil
+}
+
+// update is an update prepared by prepareUpdate.
+type update struct {
+	// next is the next occurrence to create, if the update completes an
+	// occurrence of a recurring todo.
+	next *Todo
+	// rollUp is set if the todo's parent needs rolling up.
+	rollUp bool
+}
 
-	todo.Title = title
-	todo.Description = description
-	todo.Completed = completed
-	todo.UpdatedAt = time.Now()
+// prepareUpdate applies p to todo and validates the result without storing
+// it.
+func (s *Service) prepareUpdate(ctx context.Context, todo *Todo, p Patch) (*update, error) {
+	wasCompleted := todo.Completed
+	recurrence := todo.Recurrence
+	projectID := todo.ProjectID
+	p.Apply(todo)
+	todo.syncCompletion()
+	prepareRecurrence(recurrence, todo)
+	todo.UpdatedAt = s.now()
 
-	if err := todo.Validate(); err != nil {
-		return nil, ErrInvalid
+	if err := validate(todo); err != nil {
+		return nil, err
+	}
+	if todo.ProjectID != projectID {
+		if err := s.checkProject(ctx, todo); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.repo.Update(ctx, todo); err != nil {
+	// Completing an occurrence of a recurring todo hands the recurrence on
+	// to the next occurrence, so completing it again after reopening does
+	// not create another one.
+	u := &update{rollUp: todo.ParentID != 0 && todo.Completed != wasCompleted}
+	if todo.Completed && !wasCompleted && todo.Recurrence != nil {
+		if u.next = nextOccurrence(todo, s.now()); u.next != nil {
+			todo.Recurrence = nil
+		}
+	}
+	return u, nil
+}
+
+// DeleteTodo moves a todo to the trash. If version is non-zero the delete
+// fails with ErrConflict unless the todo is still at that version. Deleting
+// a todo deletes its subtasks.
+func (s *Service) DeleteTodo(ctx context.Context, id, version int64) (err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.DeleteTodo")
+	defer tracing.End(span, &err)
+
+	return s.inTx(ctx, func(tx *Service) error {
+		todo, err := tx.repo.FindByID(ctx, auth.UserID(ctx), id)
+		if err != nil {
+			return err
+		}
+		if err := tx.repo.Delete(ctx, auth.UserID(ctx), id, version, tx.now()); err != nil {
+			return err
+		}
+		tx.emit(ActionDeleted, todo)
+		if todo.ParentID != 0 {
+			return tx.rollUp(ctx, todo.ParentID)
+		}
+		return nil
+	})
+}
+
+// validate normalizes and validates a todo. Failures are reported as
+// ErrInvalid, or as a field-specific error wrapping it.
+func validate(t *Todo) error {
+	if err := t.Validate(); err != nil {
+		if errors.Is(err, ErrInvalid) {
+			return err
+		}
+		return ErrInvalid
+	}
+	tags, err := normalizeTags(t.Tags)
+	if err != nil {
+		return err
+	}
+	t.Tags = tags
+	return nil
+}
+
+// ListTags lists the tags in use, with the number of todos carrying each.
+func (s *Service) ListTags(ctx context.Context) (_ []Tag, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.ListTags")
+	defer tracing.End(span, &err)
+
+	return s.repo.ListTags(ctx, auth.UserID(ctx))
+}
+
+// CreateTag registers a tag before any todo carries it.
+func (s *Service) CreateTag(ctx context.Context, name string) (_ *Tag, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.CreateTag")
+	defer tracing.End(span, &err)
+
+	name, err = NormalizeTag(name)
+	if err != nil {
 		return nil, err
 	}
+	if err := s.repo.CreateTag(ctx, auth.UserID(ctx), name); err != nil {
+		return nil, err
+	}
+	return &Tag{Name: name}, nil
+}
 
-	return todo, nil
+// RenameTag renames a tag on every todo carrying it.
+func (s *Service) RenameTag(ctx context.Context, from, to string) (err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.RenameTag")
+	defer tracing.End(span, &err)
+
+	from, err = NormalizeTag(from)
+	if err != nil {
+		return ErrTagNotFound
+	}
+	if to, err = NormalizeTag(to); err != nil {
+		return err
+	}
+	return s.repo.RenameTag(ctx, auth.UserID(ctx), from, to)
 }
 
-// DeleteTodo deletes a todo by its ID.
-func (s *Service) DeleteTodo(ctx context.Context, id int64) error {
-	return s.repo.Delete(ctx, id)
+// DeleteTag removes a tag from every todo carrying it.
+func (s *Service) DeleteTag(ctx context.Context, name string) (err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.DeleteTag")
+	defer tracing.End(span, &err)
+
+	name, err = NormalizeTag(name)
+	if err != nil {
+		return ErrTagNotFound
+	}
+	return s.repo.DeleteTag(ctx, auth.UserID(ctx), name)
 }
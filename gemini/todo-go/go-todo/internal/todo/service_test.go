@@ -2,8 +2,13 @@ package todo_test
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gemini/go-todo/internal/auth"
 	"github.com/gemini/go-todo/internal/storage/memory"
 	"github.com/gemini/go-todo/internal/todo"
 )
@@ -69,3 +74,1055 @@ func TestService_UpdateTodo(t *testing.T) {
 		}
 	})
 }
+
+func TestService_UpdateTodoConcurrently(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	parent, _ := service.CreateTodo(ctx, "Parent", "")
+	title := "Subtask"
+	var subtasks []*todo.Todo
+	for i := 0; i < 10; i++ {
+		sub, err := service.CreateSubtask(ctx, parent.ID, todo.Patch{Title: &title})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		subtasks = append(subtasks, sub)
+	}
+
+	// Every update reads and rolls up the same parent, which must not make
+	// any of them fail with a conflict.
+	var wg sync.WaitGroup
+	errs := make(chan error, len(subtasks))
+	for _, sub := range subtasks {
+		wg.Add(1)
+		go func(sub *todo.Todo) {
+			defer wg.Done()
+			_, err := service.UpdateTodo(ctx, sub.ID, sub.Title, "", true)
+			errs <- err
+		}(sub)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	got, _ := service.GetTodo(ctx, parent.ID)
+	if got.Progress == nil || got.Progress.Done != len(subtasks) {
+		t.Errorf("expected all %d subtasks done, got %+v", len(subtasks), got.Progress)
+	}
+}
+
+func TestService_ListTodos(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	for _, title := range []string{"b", "d", "a", "e", "c"} {
+		if _, err := service.CreateTodo(ctx, title, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("pages through todos with a cursor", func(t *testing.T) {
+		opts := todo.ListOptions{Sort: todo.SortTitle, Desc: true, Limit: 2}
+		var titles []string
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("too many pages")
+			}
+			page, err := service.ListTodos(ctx, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, td := range page.Todos {
+				titles = append(titles, td.Title)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.After, err = todo.DecodeCursor(page.NextCursor)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if got, want := strings.Join(titles, ""), "edcba"; got != want {
+			t.Errorf("expected order %q, got %q", want, got)
+		}
+	})
+
+	t.Run("rejects a cursor for a different ordering", func(t *testing.T) {
+		page, _ := service.ListTodos(ctx, todo.ListOptions{Sort: todo.SortTitle, Limit: 1})
+		after, _ := todo.DecodeCursor(page.NextCursor)
+
+		_, err := service.ListTodos(ctx, todo.ListOptions{Sort: todo.SortCreated, After: after})
+		if err != todo.ErrInvalidCursor {
+			t.Errorf("expected error %v, got %v", todo.ErrInvalidCursor, err)
+		}
+	})
+
+	t.Run("rejects an unknown sort field", func(t *testing.T) {
+		_, err := service.ListTodos(ctx, todo.ListOptions{Sort: "color"})
+		if err != todo.ErrInvalid {
+			t.Errorf("expected error %v, got %v", todo.ErrInvalid, err)
+		}
+	})
+}
+
+func TestService_PatchTodo(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	created, _ := service.CreateTodo(ctx, "Title", "")
+	completed := true
+
+	t.Run("rejects a mismatched version", func(t *testing.T) {
+		_, err := service.PatchTodo(ctx, created.ID, created.Version+1, todo.Patch{Completed: &completed})
+		if err != todo.ErrConflict {
+			t.Errorf("expected error %v, got %v", todo.ErrConflict, err)
+		}
+	})
+
+	t.Run("detects a concurrent update", func(t *testing.T) {
+		stale, _ := repo.FindByID(ctx, 0, created.ID)
+
+		updated, err := service.PatchTodo(ctx, created.ID, created.Version, todo.Patch{Completed: &completed})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated.Version != created.Version+1 {
+			t.Errorf("expected version %d, got %d", created.Version+1, updated.Version)
+		}
+
+		stale.Title = "Lost update"
+		if err := repo.Update(ctx, stale); err != todo.ErrConflict {
+			t.Errorf("expected error %v, got %v", todo.ErrConflict, err)
+		}
+	})
+}
+
+func TestService_Tags(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	title := "Tagged"
+	tags := []string{" Work", "urgent", "work"}
+	created, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, Tags: &tags})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(created.Tags, ","); got != "urgent,work" {
+		t.Errorf("expected normalized tags %q, got %q", "urgent,work", got)
+	}
+
+	t.Run("rejects invalid tags", func(t *testing.T) {
+		bad := []string{"a,b"}
+		_, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, Tags: &bad})
+		if !errors.Is(err, todo.ErrInvalidTag) {
+			t.Errorf("expected error %v, got %v", todo.ErrInvalidTag, err)
+		}
+	})
+
+	t.Run("filters by any or all tags", func(t *testing.T) {
+		only := []string{"work"}
+		service.CreateTodoWith(ctx, todo.Patch{Title: &title, Tags: &only})
+
+		page, _ := service.ListTodos(ctx, todo.ListOptions{Tags: []string{"WORK"}})
+		if len(page.Todos) != 2 {
+			t.Errorf("expected 2 todos tagged work, got %d", len(page.Todos))
+		}
+		page, _ = service.ListTodos(ctx, todo.ListOptions{Tags: []string{"work", "urgent"}, MatchAllTags: true})
+		if len(page.Todos) != 1 || page.Todos[0].ID != created.ID {
+			t.Errorf("expected only the todo with both tags, got %d todos", len(page.Todos))
+		}
+	})
+
+	t.Run("renames a tag on its todos", func(t *testing.T) {
+		if err := service.RenameTag(ctx, "work", "job"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := service.GetTodo(ctx, created.ID)
+		if strings.Join(got.Tags, ",") != "job,urgent" {
+			t.Errorf("expected tags %q, got %q", "job,urgent", got.Tags)
+		}
+		if got.Version != created.Version+1 {
+			t.Errorf("expected version to advance to %d, got %d", created.Version+1, got.Version)
+		}
+		if err := service.RenameTag(ctx, "job", "urgent"); !errors.Is(err, todo.ErrTagExists) {
+			t.Errorf("expected error %v, got %v", todo.ErrTagExists, err)
+		}
+		if err := service.RenameTag(ctx, "missing", "other"); !errors.Is(err, todo.ErrTagNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrTagNotFound, err)
+		}
+	})
+
+	t.Run("lists and deletes tags", func(t *testing.T) {
+		if _, err := service.CreateTag(ctx, "Someday"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := service.DeleteTag(ctx, "urgent"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		list, err := service.ListTags(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []todo.Tag{{Name: "job", Count: 2}, {Name: "someday", Count: 0}}
+		if len(list) != len(want) || list[0] != want[0] || list[1] != want[1] {
+			t.Errorf("expected tags %v, got %v", want, list)
+		}
+	})
+}
+
+func TestService_Agenda(t *testing.T) {
+	repo := memory.NewRepo()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	now := time.Date(2024, 3, 15, 22, 30, 0, 0, berlin)
+	service := todo.NewService(repo, todo.WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	create := func(title string, due time.Time, priority int) {
+		t.Helper()
+		if _, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, DueAt: &due, Priority: &priority}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	create("late", now.Add(-time.Hour), todo.PriorityNone)
+	create("tonight low", now.Add(time.Hour), todo.PriorityLow)
+	create("tonight high", now.Add(time.Hour), todo.PriorityHigh)
+	create("tomorrow", now.Add(2*time.Hour), todo.PriorityNone) // 00:30 in Berlin
+	create("next month", now.AddDate(0, 1, 0), todo.PriorityNone)
+	service.CreateTodo(ctx, "undated", "")
+
+	agenda, err := service.Agenda(ctx, berlin, 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	titles := func(todos []*todo.Todo) string {
+		var s []string
+		for _, td := range todos {
+			s = append(s, td.Title)
+		}
+		return strings.Join(s, ",")
+	}
+	if got := titles(agenda.Overdue); got != "late" {
+		t.Errorf("expected overdue %q, got %q", "late", got)
+	}
+	if got := titles(agenda.Today); got != "tonight high,tonight low" {
+		t.Errorf("expected today %q, got %q", "tonight high,tonight low", got)
+	}
+	if got := titles(agenda.Upcoming); got != "tomorrow" {
+		t.Errorf("expected upcoming %q, got %q", "tomorrow", got)
+	}
+
+	t.Run("lists overdue todos", func(t *testing.T) {
+		overdue := true
+		page, _ := service.ListTodos(ctx, todo.ListOptions{Overdue: &overdue})
+		if got := titles(page.Todos); got != "late" {
+			t.Errorf("expected %q, got %q", "late", got)
+		}
+	})
+
+	t.Run("sorts by priority", func(t *testing.T) {
+		page, err := service.ListTodos(ctx, todo.ListOptions{Sort: todo.SortPriority, Desc: true, Limit: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c, _ := todo.DecodeCursor(page.NextCursor)
+		next, _ := service.ListTodos(ctx, todo.ListOptions{Sort: todo.SortPriority, Desc: true, Limit: 1, After: c})
+		if got := titles(append(page.Todos, next.Todos...)); got != "tonight high,tonight low" {
+			t.Errorf("expected %q, got %q", "tonight high,tonight low", got)
+		}
+	})
+
+	t.Run("rejects an out of range priority", func(t *testing.T) {
+		title, priority := "Too high", todo.PriorityHigh+1
+		_, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, Priority: &priority})
+		if !errors.Is(err, todo.ErrInvalidPriority) {
+			t.Errorf("expected error %v, got %v", todo.ErrInvalidPriority, err)
+		}
+	})
+}
+
+func TestService_Subtasks(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	title, auto := "Pack", true
+	parent, _ := service.CreateTodoWith(ctx, todo.Patch{Title: &title, AutoComplete: &auto})
+
+	var subtasks []*todo.Todo
+	for _, title := range []string{"Socks", "Shirts"} {
+		sub, err := service.CreateSubtask(ctx, parent.ID, todo.Patch{Title: &title})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		subtasks = append(subtasks, sub)
+	}
+
+	progress := func() *todo.Todo {
+		t.Helper()
+		got, err := service.GetTodo(ctx, parent.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return got
+	}
+
+	t.Run("reports progress", func(t *testing.T) {
+		service.UpdateTodo(ctx, subtasks[0].ID, "Socks", "", true)
+		got := progress()
+		if got.Progress == nil || *got.Progress != (todo.Progress{Done: 1, Total: 2}) {
+			t.Errorf("expected progress 1/2, got %+v", got.Progress)
+		}
+		if got.Completed {
+			t.Errorf("expected parent to stay open")
+		}
+	})
+
+	t.Run("auto-completes and reopens the parent", func(t *testing.T) {
+		service.UpdateTodo(ctx, subtasks[1].ID, "Shirts", "", true)
+		if !progress().Completed {
+			t.Errorf("expected parent to be completed")
+		}
+		service.UpdateTodo(ctx, subtasks[1].ID, "Shirts", "", false)
+		if progress().Completed {
+			t.Errorf("expected parent to be reopened")
+		}
+	})
+
+	t.Run("rejects nested subtasks", func(t *testing.T) {
+		title := "Blue socks"
+		_, err := service.CreateSubtask(ctx, subtasks[0].ID, todo.Patch{Title: &title})
+		if !errors.Is(err, todo.ErrNestedSubtask) {
+			t.Errorf("expected error %v, got %v", todo.ErrNestedSubtask, err)
+		}
+	})
+
+	t.Run("deletes subtasks with their parent", func(t *testing.T) {
+		if err := service.DeleteTodo(ctx, subtasks[1].ID, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !progress().Completed {
+			t.Errorf("expected parent to complete once its open subtask is deleted")
+		}
+
+		if err := service.DeleteTodo(ctx, parent.ID, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.GetTodo(ctx, subtasks[0].ID); err != todo.ErrNotFound {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+	})
+}
+
+func TestService_Recurrence(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	create := func(title string, due time.Time, rec todo.Recurrence) *todo.Todo {
+		t.Helper()
+		created, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, DueAt: &due, Recurrence: &rec})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return created
+	}
+	// complete completes a todo and returns the occurrence it created, if any.
+	complete := func(td *todo.Todo) *todo.Todo {
+		t.Helper()
+		if _, err := service.UpdateTodo(ctx, td.ID, td.Title, "", true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		open := false
+		page, _ := service.ListTodos(ctx, todo.ListOptions{Completed: &open})
+		for _, other := range page.Todos {
+			if other.Title == td.Title {
+				return other
+			}
+		}
+		return nil
+	}
+
+	t.Run("creates the next occurrence on completion", func(t *testing.T) {
+		first := create("Report", time.Date(2024, 1, 31, 17, 0, 0, 0, time.UTC), todo.Recurrence{Rule: "freq=monthly;bymonthday=-1"})
+		if first.Recurrence.Rule != "FREQ=MONTHLY;BYMONTHDAY=-1" || first.Recurrence.Occurrence != 1 {
+			t.Errorf("expected a canonical rule at occurrence 1, got %+v", first.Recurrence)
+		}
+
+		second := complete(first)
+		if second == nil {
+			t.Fatalf("expected a next occurrence")
+		}
+		if want := time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC); !second.DueAt.Equal(want) {
+			t.Errorf("expected due %v, got %v", want, second.DueAt)
+		}
+		if second.Recurrence == nil || second.Recurrence.Occurrence != 2 {
+			t.Errorf("expected occurrence 2, got %+v", second.Recurrence)
+		}
+
+		done, _ := service.GetTodo(ctx, first.ID)
+		if done.Recurrence != nil {
+			t.Errorf("expected the recurrence to move to the next occurrence")
+		}
+		service.UpdateTodo(ctx, first.ID, "Report", "", false)
+		if complete(first).ID != second.ID {
+			t.Errorf("expected completing a reopened occurrence not to repeat it again")
+		}
+		service.DeleteTodo(ctx, second.ID, 0)
+	})
+
+	t.Run("creates the next occurrence when subtasks complete it", func(t *testing.T) {
+		title, due, auto := "Weekly review", time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), true
+		parent, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, DueAt: &due, AutoComplete: &auto, Recurrence: &todo.Recurrence{Rule: "FREQ=WEEKLY"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		subtitle := "Inbox zero"
+		sub, err := service.CreateSubtask(ctx, parent.ID, todo.Patch{Title: &subtitle})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		next := complete(sub)
+		if next != nil {
+			t.Fatalf("expected the subtask not to repeat, got %+v", next)
+		}
+
+		done, _ := service.GetTodo(ctx, parent.ID)
+		if !done.Completed || done.Recurrence != nil {
+			t.Errorf("expected the parent completed with its recurrence handed on, got %+v", done)
+		}
+		open := false
+		page, _ := service.ListTodos(ctx, todo.ListOptions{Completed: &open, Query: "weekly"})
+		if len(page.Todos) != 1 {
+			t.Fatalf("expected the next occurrence, got %+v", page.Todos)
+		}
+		if want := due.AddDate(0, 0, 7); !page.Todos[0].DueAt.Equal(want) || page.Todos[0].Recurrence.Occurrence != 2 {
+			t.Errorf("expected occurrence 2 due %v, got %+v", want, page.Todos[0])
+		}
+		service.DeleteTodo(ctx, page.Todos[0].ID, 0)
+	})
+
+	t.Run("follows the wall clock across DST", func(t *testing.T) {
+		berlin, err := time.LoadLocation("Europe/Berlin")
+		if err != nil {
+			t.Skipf("time zone data unavailable: %v", err)
+		}
+		td := create("Water plants", time.Date(2024, 3, 30, 9, 0, 0, 0, berlin), todo.Recurrence{Rule: "FREQ=DAILY", TimeZone: "Europe/Berlin"})
+		next := complete(td)
+		if want := time.Date(2024, 3, 31, 7, 0, 0, 0, time.UTC); next == nil || !next.DueAt.Equal(want) {
+			t.Errorf("expected due %v, got %+v", want, next)
+		}
+		service.DeleteTodo(ctx, next.ID, 0)
+	})
+
+	t.Run("ends after COUNT occurrences", func(t *testing.T) {
+		td := create("Course", time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC), todo.Recurrence{Rule: "FREQ=WEEKLY;COUNT=2"})
+		next := complete(td)
+		if next == nil {
+			t.Fatalf("expected a second occurrence")
+		}
+		if last := complete(next); last != nil {
+			t.Errorf("expected the series to end, got %+v", last)
+		}
+	})
+
+	t.Run("restarts the series when the rule changes", func(t *testing.T) {
+		td := create("Chore", time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC), todo.Recurrence{Rule: "FREQ=WEEKLY"})
+		next := complete(td)
+		rule := todo.Recurrence{Rule: "FREQ=DAILY"}
+		updated, err := service.PatchTodo(ctx, next.ID, 0, todo.Patch{Recurrence: &rule})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated.Recurrence.Occurrence != 1 || !updated.Recurrence.Start.Equal(*next.DueAt) {
+			t.Errorf("expected the series to restart at %v, got %+v", next.DueAt, updated.Recurrence)
+		}
+	})
+
+	t.Run("rejects invalid recurrences", func(t *testing.T) {
+		title := "Bad"
+		for _, p := range []todo.Patch{
+			{Title: &title, Recurrence: &todo.Recurrence{Rule: "FREQ=DAILY"}},
+			{Title: &title, DueAt: &time.Time{}, Recurrence: &todo.Recurrence{Rule: "FREQ=HOURLY"}},
+			{Title: &title, DueAt: &time.Time{}, Recurrence: &todo.Recurrence{Rule: "FREQ=DAILY", TimeZone: "Mars/Olympus"}},
+		} {
+			if _, err := service.CreateTodoWith(ctx, p); !errors.Is(err, todo.ErrInvalidRecurrence) {
+				t.Errorf("expected error %v, got %v", todo.ErrInvalidRecurrence, err)
+			}
+		}
+	})
+}
+
+func TestService_Projects(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	project, err := service.CreateProject(ctx, " Garden ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if project.Name != "Garden" {
+		t.Errorf("expected name %q, got %q", "Garden", project.Name)
+	}
+	if _, err := service.CreateProject(ctx, "Garden"); !errors.Is(err, todo.ErrProjectExists) {
+		t.Errorf("expected error %v, got %v", todo.ErrProjectExists, err)
+	}
+
+	title := "Mow the lawn"
+	inProject, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, ProjectID: &project.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	loose, _ := service.CreateTodo(ctx, "Call mum", "")
+
+	t.Run("rejects unknown projects", func(t *testing.T) {
+		missing := project.ID + 1
+		_, err := service.CreateTodoWith(ctx, todo.Patch{Title: &title, ProjectID: &missing})
+		if !errors.Is(err, todo.ErrUnknownProject) {
+			t.Errorf("expected error %v, got %v", todo.ErrUnknownProject, err)
+		}
+		other := auth.WithUserID(ctx, 2)
+		if _, err := service.PatchTodo(other, loose.ID, 0, todo.Patch{ProjectID: &project.ID}); !errors.Is(err, todo.ErrNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+	})
+
+	t.Run("filters by project", func(t *testing.T) {
+		page, _ := service.ListTodos(ctx, todo.ListOptions{ProjectID: &project.ID})
+		if len(page.Todos) != 1 || page.Todos[0].ID != inProject.ID {
+			t.Errorf("expected only the todo in the project, got %d todos", len(page.Todos))
+		}
+		var none int64
+		page, _ = service.ListTodos(ctx, todo.ListOptions{ProjectID: &none})
+		if len(page.Todos) != 1 || page.Todos[0].ID != loose.ID {
+			t.Errorf("expected only the todo outside any project, got %d todos", len(page.Todos))
+		}
+	})
+
+	t.Run("hides the todos of archived projects", func(t *testing.T) {
+		archived := true
+		if _, err := service.UpdateProject(ctx, project.ID, todo.ProjectPatch{Archived: &archived}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		page, _ := service.ListTodos(ctx, todo.ListOptions{})
+		if len(page.Todos) != 1 || page.Todos[0].ID != loose.ID {
+			t.Errorf("expected the archived project's todo to be hidden, got %d todos", len(page.Todos))
+		}
+		page, _ = service.ListTodos(ctx, todo.ListOptions{ProjectID: &project.ID})
+		if len(page.Todos) != 1 {
+			t.Errorf("expected the project's todo when listing the project, got %d todos", len(page.Todos))
+		}
+		page, _ = service.ListTodos(ctx, todo.ListOptions{IncludeArchived: true})
+		if len(page.Todos) != 2 {
+			t.Errorf("expected 2 todos including archived ones, got %d", len(page.Todos))
+		}
+		if _, err := service.GetTodo(ctx, inProject.ID); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("moves todos out of a deleted project", func(t *testing.T) {
+		if err := service.DeleteProject(ctx, project.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := service.GetTodo(ctx, inProject.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.ProjectID != 0 || got.Version != inProject.Version+1 {
+			t.Errorf("expected no project at version %d, got project %d at version %d", inProject.Version+1, got.ProjectID, got.Version)
+		}
+		if _, err := service.GetProject(ctx, project.ID); !errors.Is(err, todo.ErrProjectNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrProjectNotFound, err)
+		}
+	})
+}
+
+func TestService_MoveTodo(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	ids := make(map[string]int64)
+	for _, title := range []string{"a", "b", "c", "d"} {
+		created, err := service.CreateTodo(ctx, title, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids[title] = created.ID
+	}
+
+	order := func() string {
+		t.Helper()
+		page, err := service.ListTodos(ctx, todo.ListOptions{Sort: todo.SortPosition})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var titles []string
+		for _, td := range page.Todos {
+			titles = append(titles, td.Title)
+		}
+		return strings.Join(titles, "")
+	}
+
+	if got := order(); got != "abcd" {
+		t.Fatalf("expected creation order %q, got %q", "abcd", got)
+	}
+
+	tests := []struct {
+		name          string
+		move          string
+		after, before string
+		want          string
+	}{
+		{"between two todos", "d", "a", "b", "adbc"},
+		{"after a todo", "a", "c", "", "dbca"},
+		{"before a todo", "a", "", "d", "adbc"},
+		{"to the end", "b", "c", "", "adcb"},
+		{"to the start", "b", "", "a", "badc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved, err := service.MoveTodo(ctx, ids[tt.move], 0, ids[tt.after], ids[tt.before])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := order(); got != tt.want {
+				t.Errorf("expected order %q, got %q", tt.want, got)
+			}
+			if moved.Version < 2 {
+				t.Errorf("expected the moved todo's version to advance, got %d", moved.Version)
+			}
+		})
+	}
+
+	t.Run("rejects invalid moves", func(t *testing.T) {
+		// The order is now badc.
+		for _, tt := range []struct{ after, before int64 }{
+			{0, 0},
+			{ids["a"], 0},
+			{ids["c"], ids["d"]},
+			{ids["d"] + 100, 0},
+		} {
+			if _, err := service.MoveTodo(ctx, ids["a"], 0, tt.after, tt.before); !errors.Is(err, todo.ErrInvalidMove) {
+				t.Errorf("moving after %d and before %d: expected error %v, got %v", tt.after, tt.before, todo.ErrInvalidMove, err)
+			}
+		}
+	})
+
+	t.Run("rejects a stale version", func(t *testing.T) {
+		if _, err := service.MoveTodo(ctx, ids["a"], 1, ids["b"], 0); !errors.Is(err, todo.ErrConflict) {
+			t.Errorf("expected error %v, got %v", todo.ErrConflict, err)
+		}
+	})
+}
+
+func TestService_Trash(t *testing.T) {
+	repo := memory.NewRepo()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := todo.NewService(repo, todo.WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	parent, _ := service.CreateTodo(ctx, "Trip", "")
+	title := "Book hotel"
+	hotel, _ := service.CreateSubtask(ctx, parent.ID, todo.Patch{Title: &title})
+	title = "Pack"
+	pack, _ := service.CreateSubtask(ctx, parent.ID, todo.Patch{Title: &title})
+
+	trash := func() []*todo.Todo {
+		t.Helper()
+		page, err := service.ListTodos(ctx, todo.ListOptions{Trashed: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return page.Todos
+	}
+
+	t.Run("moves a deleted subtask to the trash", func(t *testing.T) {
+		if err := service.DeleteTodo(ctx, pack.ID, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.GetTodo(ctx, pack.ID); !errors.Is(err, todo.ErrNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+		if todos := trash(); len(todos) != 1 || todos[0].ID != pack.ID || todos[0].DeletedAt == nil {
+			t.Errorf("expected the subtask in the trash, got %+v", todos)
+		}
+		got, _ := service.GetTodo(ctx, parent.ID)
+		if got.Progress == nil || got.Progress.Total != 1 {
+			t.Errorf("expected progress to leave out the deleted subtask, got %+v", got.Progress)
+		}
+	})
+
+	t.Run("trashes and restores a todo with its subtasks", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		if err := service.DeleteTodo(ctx, parent.ID, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if page, _ := service.ListTodos(ctx, todo.ListOptions{}); len(page.Todos) != 0 {
+			t.Errorf("expected no live todos, got %d", len(page.Todos))
+		}
+		if todos := trash(); len(todos) != 1 || todos[0].ID != parent.ID {
+			t.Errorf("expected only the parent in the trash, got %+v", todos)
+		}
+		if _, err := service.RestoreTodo(ctx, hotel.ID); !errors.Is(err, todo.ErrNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+
+		restored, err := service.RestoreTodo(ctx, parent.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if restored.DeletedAt != nil || restored.Progress == nil || restored.Progress.Total != 1 {
+			t.Errorf("expected the parent back with the subtask deleted along with it, got %+v", restored)
+		}
+		if _, err := service.GetTodo(ctx, hotel.ID); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := service.RestoreTodo(ctx, parent.ID); !errors.Is(err, todo.ErrNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+	})
+
+	t.Run("purges todos past the retention", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		n, err := service.PurgeTrash(ctx, 90*time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 || len(trash()) != 0 {
+			t.Errorf("expected the subtask deleted two hours ago to be purged, got %d purged", n)
+		}
+		if n, _ := service.PurgeTrash(ctx, 0); n != 0 {
+			t.Errorf("expected nothing left to purge, got %d", n)
+		}
+	})
+}
+
+func TestService_TodoHistory(t *testing.T) {
+	repo := memory.NewRepo()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := todo.NewService(repo, todo.WithClock(func() time.Time { return now }))
+	ctx := auth.WithUserID(context.Background(), 1)
+
+	created, _ := service.CreateTodo(ctx, "Report", "")
+
+	t.Run("records the fields an update changed", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		due := time.Date(2024, 3, 2, 9, 0, 0, 0, time.FixedZone("CET", 3600))
+		description := "Quarterly"
+		if _, err := service.PatchTodo(ctx, created.ID, 0, todo.Patch{Description: &description, DueAt: &due}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// The same instant in another zone is not a change.
+		due = due.UTC()
+		if _, err := service.PatchTodo(ctx, created.ID, 0, todo.Patch{DueAt: &due}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		entries, err := service.TodoHistory(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(entries) != 3 || entries[0].Action != todo.ActionCreated || entries[1].Action != todo.ActionUpdated {
+			t.Fatalf("expected a created and two updated entries, got %+v", entries)
+		}
+		changes := entries[1].Changes
+		if c := changes["description"]; len(changes) != 2 || string(c.Old) != "null" || string(c.New) != `"Quarterly"` {
+			t.Errorf("expected description and due_at to change, got %v", changes)
+		}
+		if c := changes["due_at"]; string(c.New) != `"2024-03-02T08:00:00Z"` {
+			t.Errorf("expected the new due date in UTC, got %s", c.New)
+		}
+		if !entries[1].At.Equal(now) || entries[1].ActorID != 1 || entries[1].Version != 2 {
+			t.Errorf("expected the update by user 1 at version 2 and %v, got %+v", now, entries[1])
+		}
+		if len(entries[2].Changes) != 0 {
+			t.Errorf("expected no changes, got %v", entries[2].Changes)
+		}
+	})
+
+	t.Run("keeps the history of a todo in the trash", func(t *testing.T) {
+		trashed, _ := service.CreateTodo(ctx, "Scrap", "")
+		if err := service.DeleteTodo(ctx, trashed.ID, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		entries, err := service.TodoHistory(ctx, trashed.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(entries) != 2 || entries[1].Action != todo.ActionDeleted {
+			t.Errorf("expected a created and a deleted entry, got %+v", entries)
+		}
+	})
+
+	t.Run("returns not found for other users' todos", func(t *testing.T) {
+		other := auth.WithUserID(context.Background(), 2)
+		if _, err := service.TodoHistory(other, created.ID); !errors.Is(err, todo.ErrNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+	})
+}
+
+func TestService_Search(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	service.CreateTodo(ctx, "Call the plumber", "About the leaking milk frother")
+	service.CreateTodo(ctx, "Buy milk", "Oat milk from the corner shop")
+	service.CreateTodo(ctx, "Write report", "")
+
+	t.Run("ranks matches by relevance", func(t *testing.T) {
+		page, err := service.ListTodos(ctx, todo.ListOptions{Query: "Milk"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Todos) != 2 || page.Todos[0].Title != "Buy milk" {
+			t.Fatalf("expected the title match first, got %+v", page.Todos)
+		}
+		if got, want := page.Todos[0].Match.Snippet, "Buy <mark>milk</mark>"; got != want {
+			t.Errorf("expected snippet %q, got %q", want, got)
+		}
+		if got, want := page.Todos[1].Match.Snippet, "About the leaking <mark>milk</mark> frother"; got != want {
+			t.Errorf("expected snippet %q, got %q", want, got)
+		}
+	})
+
+	t.Run("escapes snippets as HTML", func(t *testing.T) {
+		service.CreateTodo(ctx, `<script>alert("milk")</script>`, "")
+		page, err := service.ListTodos(ctx, todo.ListOptions{Query: "alert"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "&lt;script&gt;<mark>alert</mark>(&#34;milk&#34;)&lt;/script&gt;"
+		if len(page.Todos) != 1 || page.Todos[0].Match.Snippet != want {
+			t.Errorf("expected snippet %q, got %+v", want, page.Todos)
+		}
+		service.DeleteTodo(ctx, page.Todos[0].ID, 0)
+	})
+
+	t.Run("matches every word as a prefix", func(t *testing.T) {
+		page, _ := service.ListTodos(ctx, todo.ListOptions{Query: "wri rep"})
+		if len(page.Todos) != 1 || page.Todos[0].Title != "Write report" {
+			t.Errorf("expected only %q, got %+v", "Write report", page.Todos)
+		}
+		page, _ = service.ListTodos(ctx, todo.ListOptions{Query: "milk report"})
+		if len(page.Todos) != 0 {
+			t.Errorf("expected no matches, got %+v", page.Todos)
+		}
+	})
+
+	t.Run("rejects queries without words", func(t *testing.T) {
+		if _, err := service.ListTodos(ctx, todo.ListOptions{Query: "?!"}); !errors.Is(err, todo.ErrInvalidQuery) {
+			t.Errorf("expected error %v, got %v", todo.ErrInvalidQuery, err)
+		}
+		if _, err := service.ListTodos(ctx, todo.ListOptions{Sort: todo.SortRelevance}); !errors.Is(err, todo.ErrInvalidQuery) {
+			t.Errorf("expected error %v, got %v", todo.ErrInvalidQuery, err)
+		}
+	})
+}
+
+func TestService_Batch(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := context.Background()
+
+	keep, _ := service.CreateTodo(ctx, "Keep", "")
+	drop, _ := service.CreateTodo(ctx, "Drop", "")
+	title, done := "New", true
+
+	t.Run("applies every operation", func(t *testing.T) {
+		todos, err := service.Batch(ctx, []todo.BatchOp{
+			{Op: todo.OpCreate, Patch: todo.Patch{Title: &title}},
+			{Op: todo.OpUpdate, ID: keep.ID, Version: keep.Version, Patch: todo.Patch{Completed: &done}},
+			{Op: todo.OpDelete, ID: drop.ID},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(todos) != 3 || todos[0].ID == 0 || !todos[1].Completed || todos[2] != nil {
+			t.Errorf("expected a created and an updated todo, got %+v", todos)
+		}
+		if _, err := service.GetTodo(ctx, drop.ID); !errors.Is(err, todo.ErrNotFound) {
+			t.Errorf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+	})
+
+	t.Run("applies nothing if an operation fails", func(t *testing.T) {
+		before, _ := service.ListTodos(ctx, todo.ListOptions{})
+		_, err := service.Batch(ctx, []todo.BatchOp{
+			{Op: todo.OpCreate, Patch: todo.Patch{Title: &title}},
+			{Op: todo.OpUpdate, ID: keep.ID, Patch: todo.Patch{Title: &title}},
+			{Op: todo.OpDelete, ID: keep.ID},
+		})
+		var batchErr *todo.BatchError
+		if !errors.As(err, &batchErr) || batchErr.Index != 2 || !errors.Is(err, todo.ErrDuplicateOp) {
+			t.Fatalf("expected operation 2 to fail with %v, got %v", todo.ErrDuplicateOp, err)
+		}
+
+		_, err = service.Batch(ctx, []todo.BatchOp{
+			{Op: todo.OpCreate, Patch: todo.Patch{Title: &title}},
+			{Op: todo.OpUpdate, ID: keep.ID, Version: 1, Patch: todo.Patch{Title: &title}},
+		})
+		if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, todo.ErrConflict) {
+			t.Fatalf("expected operation 1 to fail with %v, got %v", todo.ErrConflict, err)
+		}
+
+		after, _ := service.ListTodos(ctx, todo.ListOptions{})
+		if len(after.Todos) != len(before.Todos) {
+			t.Errorf("expected %d todos, got %d", len(before.Todos), len(after.Todos))
+		}
+	})
+
+	t.Run("deletes all completed todos", func(t *testing.T) {
+		n, err := service.DeleteTodos(ctx, todo.ListOptions{Completed: &done})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 todo deleted, got %d", n)
+		}
+		page, _ := service.ListTodos(ctx, todo.ListOptions{})
+		if len(page.Todos) != 1 || page.Todos[0].Title != "New" {
+			t.Errorf("expected only the incomplete todo left, got %+v", page.Todos)
+		}
+	})
+
+	t.Run("returns parents as rolled up", func(t *testing.T) {
+		name, renamed, auto := "Parent", "Renamed parent", true
+		parent, _ := service.CreateTodoWith(ctx, todo.Patch{Title: &name, AutoComplete: &auto})
+		sub, _ := service.CreateSubtask(ctx, parent.ID, todo.Patch{Title: &title})
+
+		todos, err := service.Batch(ctx, []todo.BatchOp{
+			{Op: todo.OpUpdate, ID: parent.ID, Patch: todo.Patch{Title: &renamed}},
+			{Op: todo.OpUpdate, ID: sub.ID, Patch: todo.Patch{Completed: &done}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		current, _ := service.GetTodo(ctx, parent.ID)
+		if !todos[0].Completed || todos[0].Title != renamed || todos[0].Version != current.Version {
+			t.Errorf("expected the completed parent at version %d, got %+v", current.Version, todos[0])
+		}
+	})
+}
+
+func TestService_Events(t *testing.T) {
+	repo := memory.NewRepo()
+	service := todo.NewService(repo)
+	ctx := auth.WithUserID(context.Background(), 1)
+
+	next := func(t *testing.T, sub *todo.Subscription) todo.Event {
+		t.Helper()
+		select {
+		case e := <-sub.Events():
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("expected an event")
+			return todo.Event{}
+		}
+	}
+
+	sub := service.Subscribe(ctx, 0)
+	defer sub.Close()
+	other := service.Subscribe(auth.WithUserID(context.Background(), 2), 0)
+	defer other.Close()
+
+	created, _ := service.CreateTodo(ctx, "Watched", "")
+	done := true
+	service.PatchTodo(ctx, created.ID, 0, todo.Patch{Completed: &done})
+	service.DeleteTodo(ctx, created.ID, 0)
+
+	var last int64
+	for _, want := range []string{todo.ActionCreated, todo.ActionUpdated, todo.ActionDeleted} {
+		e := next(t, sub)
+		if e.Type != want || e.Todo.ID != created.ID || e.ID <= last {
+			t.Errorf("expected a %s event after %d, got %+v", want, last, e)
+		}
+		last = e.ID
+	}
+	select {
+	case e := <-other.Events():
+		t.Errorf("expected no events for another user, got %+v", e)
+	default:
+	}
+
+	t.Run("publishes nothing for failed writes", func(t *testing.T) {
+		if _, err := service.PatchTodo(ctx, created.ID, 0, todo.Patch{}); !errors.Is(err, todo.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v", todo.ErrNotFound, err)
+		}
+		title := "Batched"
+		service.Batch(ctx, []todo.BatchOp{
+			{Op: todo.OpCreate, Patch: todo.Patch{Title: &title}},
+			{Op: todo.OpDelete, ID: created.ID},
+		})
+		select {
+		case e := <-sub.Events():
+			t.Errorf("expected no event, got %+v", e)
+		default:
+		}
+	})
+
+	t.Run("resumes after the last event seen", func(t *testing.T) {
+		resumed := service.Subscribe(ctx, last-1)
+		defer resumed.Close()
+		if e := next(t, resumed); resumed.Lost || e.ID != last || e.Type != todo.ActionDeleted {
+			t.Errorf("expected the delete event again, got %+v", e)
+		}
+	})
+
+	t.Run("reports events that are no longer kept", func(t *testing.T) {
+		publish := func(bus *todo.Bus, n int) []int64 {
+			sub := bus.Subscribe(1, 0)
+			defer sub.Close()
+			var ids []int64
+			for i := 0; i < n; i++ {
+				bus.Publish(todo.Event{OwnerID: 1})
+				ids = append(ids, next(t, sub).ID)
+			}
+			return ids
+		}
+
+		bus := todo.NewBus(2)
+		ids := publish(bus, 3)
+		if sub := bus.Subscribe(1, ids[0]); sub.Lost || len(sub.Events()) != 2 {
+			t.Errorf("expected to resume after the first event, got %d events", len(sub.Events()))
+		}
+		if sub := bus.Subscribe(1, 0); sub.Lost || len(sub.Events()) != 0 {
+			t.Errorf("expected no backlog for a new subscriber")
+		}
+		bus = todo.NewBus(1)
+		ids = publish(bus, 3)
+		if sub := bus.Subscribe(1, ids[0]); !sub.Lost {
+			t.Errorf("expected events to be lost")
+		}
+
+		// A restarted process has no events of the previous one.
+		time.Sleep(time.Millisecond)
+		restarted := todo.NewBus(2)
+		publish(restarted, 5)
+		if sub := restarted.Subscribe(1, ids[2]); !sub.Lost {
+			t.Errorf("expected events to be lost after a restart")
+		}
+		if sub := todo.NewBus(2).Subscribe(1, ids[2]); !sub.Lost {
+			t.Errorf("expected events to be lost after a restart without events")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package todo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// CreateSubtask creates a todo from the fields set in p as a subtask of the
+// given todo. Subtasks cannot have subtasks of their own.
+func (s *Service) CreateSubtask(ctx context.Context, parentID int64, p Patch) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.CreateSubtask")
+	defer tracing.End(span, &err)
+
+	var todo *Todo
+	err = s.inTx(ctx, func(tx *Service) error {
+		parent, err := tx.repo.FindByID(ctx, auth.UserID(ctx), parentID)
+		if err != nil {
+			return err
+		}
+		if parent.ParentID != 0 {
+			return ErrNestedSubtask
+		}
+
+		if todo, err = tx.create(ctx, parentID, p); err != nil {
+			return err
+		}
+		return tx.rollUp(ctx, parentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// ListSubtasks lists the subtasks of a todo in creation order.
+func (s *Service) ListSubtasks(ctx context.Context, parentID int64) (_ []*Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.ListSubtasks")
+	defer tracing.End(span, &err)
+
+	if _, err := s.repo.FindByID(ctx, auth.UserID(ctx), parentID); err != nil {
+		return nil, err
+	}
+	todos, err := s.repo.FindAll(ctx, ListOptions{
+		OwnerID:         auth.UserID(ctx),
+		ParentID:        &parentID,
+		IncludeArchived: true,
+		Sort:            SortCreated,
+		Now:             s.now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if todos == nil {
+		todos = []*Todo{}
+	}
+	return todos, nil
+}
+
+// rollUp records a change to the subtasks of a todo. The todo's progress is
+// part of its representation, so its version advances, and auto-completing
+// todos follow their subtasks. Completing an occurrence of a recurring todo
+// this way creates the next occurrence, as completing it directly does. It
+// must run in the transaction that changed the subtasks.
+func (s *Service) rollUp(ctx context.Context, parentID int64) error {
+	parent, err := s.repo.FindByID(ctx, auth.UserID(ctx), parentID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	u, err := s.prepareUpdate(ctx, parent, Patch{})
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, parent); err != nil {
+		return err
+	}
+	s.emit(ActionUpdated, parent)
+	if u.next != nil {
+		if err := s.repo.Create(ctx, u.next); err != nil {
+			return err
+		}
+		s.emit(ActionCreated, u.next)
+	}
+	return nil
+}
+
+// syncCompletion completes an auto-completing todo whose subtasks are all
+// done and reopens it otherwise.
+func (t *Todo) syncCompletion() {
+	if t.AutoComplete && t.Progress != nil && t.Progress.Total > 0 {
+		t.Completed = t.Progress.Done == t.Progress.Total
+	}
+}
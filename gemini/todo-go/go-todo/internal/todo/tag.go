@@ -0,0 +1,63 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTagLength is the longest tag name, in characters.
+const MaxTagLength = 32
+
+var (
+	// ErrInvalidTag is returned when a tag name is empty, too long or
+	// contains commas or control characters.
+	ErrInvalidTag = fmt.Errorf("%w: invalid tag", ErrInvalid)
+	// ErrTagNotFound is returned when a tag is not found.
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrTagExists is returned when creating or renaming to a tag name that
+	// is already in use.
+	ErrTagExists = errors.New("tag already exists")
+)
+
+// Tag is a label a user can attach to any number of their todos.
+type Tag struct {
+	Name string `json:"name"`
+	// Count is the number of todos carrying the tag.
+	Count int `json:"count"`
+}
+
+// NormalizeTag trims and lower-cases a tag name and checks that it is valid.
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || utf8.RuneCountInString(name) > MaxTagLength {
+		return "", ErrInvalidTag
+	}
+	for _, r := range name {
+		if r == ',' || unicode.IsControl(r) {
+			return "", ErrInvalidTag
+		}
+	}
+	return name, nil
+}
+
+// normalizeTags normalizes, de-duplicates and sorts tag names.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
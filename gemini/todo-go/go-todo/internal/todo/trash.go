@@ -0,0 +1,45 @@
+package todo
+
+import (
+	"context"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/tracing"
+)
+
+// RestoreTodo takes a todo out of the trash, together with the subtasks
+// that were deleted along with it.
+func (s *Service) RestoreTodo(ctx context.Context, id int64) (_ *Todo, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.RestoreTodo")
+	defer tracing.End(span, &err)
+
+	var todo *Todo
+	err = s.inTx(ctx, func(tx *Service) error {
+		if err := tx.repo.Restore(ctx, auth.UserID(ctx), id, tx.now()); err != nil {
+			return err
+		}
+		var err error
+		if todo, err = tx.repo.FindByID(ctx, auth.UserID(ctx), id); err != nil {
+			return err
+		}
+		tx.emit(ActionRestored, todo)
+		if todo.ParentID != 0 {
+			return tx.rollUp(ctx, todo.ParentID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// PurgeTrash permanently deletes the todos of all users that have been in
+// the trash for longer than retention, and returns how many it deleted.
+func (s *Service) PurgeTrash(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "todo.Service.PurgeTrash")
+	defer tracing.End(span, &err)
+
+	return s.repo.Purge(ctx, s.now().Add(-retention))
+}
@@ -0,0 +1,97 @@
+// Package tracing sets up OpenTelemetry tracing. The HTTP handlers, the
+// todo service and the SQLite repository trace through the global tracer
+// provider, which is a no-op until Setup or Install replaces it.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The exporters Setup supports.
+const (
+	// ExporterNone disables tracing.
+	ExporterNone = "none"
+	// ExporterOTLP sends spans over OTLP/HTTP, configured by the standard
+	// OTEL_EXPORTER_OTLP_* environment variables.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to standard output as JSON.
+	ExporterStdout = "stdout"
+)
+
+// ServiceName is the default service name of the spans, which the
+// OTEL_SERVICE_NAME environment variable overrides.
+const ServiceName = "go-todo"
+
+// Setup installs a global tracer provider sending spans to the named
+// exporter, and the W3C trace context propagator. The returned function
+// flushes the spans not yet exported and stops the provider.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		otel.SetTextMapPropagator(propagator())
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator())
+	return tp.Shutdown, nil
+}
+
+// Install installs a global tracer provider exporting every span to exp as
+// soon as it ends, and the W3C trace context propagator. Tests use it with
+// an in-memory exporter from go.opentelemetry.io/otel/sdk/trace/tracetest.
+func Install(exp sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator())
+	return tp
+}
+
+func propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// End ends span, recording *errp as its error if it is set. It is meant to
+// be deferred by functions with a named error result:
+//
+//	ctx, span := tracer.Start(ctx, "op")
+//	defer tracing.End(span, &err)
+func End(span trace.Span, errp *error) {
+	if err := *errp; err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,26 @@
+package user
+
+import (
+	"net/mail"
+	"time"
+)
+
+// MinPasswordLength is the shortest password accepted at registration.
+const MinPasswordLength = 8
+
+// MaxPasswordLength is the longest password accepted at registration, in
+// bytes. bcrypt only hashes the first 72 bytes of a password.
+const MaxPasswordLength = 72
+
+// User is an account that owns todos.
+type User struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrNotFound is returned when a user is not found.
+	ErrNotFound = errors.New("user not found")
+	// ErrEmailTaken is returned when registering an email that is in use.
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrInvalidEmail is returned for a malformed email address.
+	ErrInvalidEmail = errors.New("invalid email")
+	// ErrPasswordTooShort is returned for passwords under MinPasswordLength.
+	ErrPasswordTooShort = errors.New("password too short")
+	// ErrPasswordTooLong is returned for passwords over MaxPasswordLength.
+	ErrPasswordTooLong = errors.New("password too long")
+	// ErrInvalidCredentials is returned when a login fails.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Repository defines the interface for user storage.
+type Repository interface {
+	// Create stores a new user, returning ErrEmailTaken if the email is in use.
+	Create(ctx context.Context, user *User) error
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByID(ctx context.Context, id int64) (*User, error)
+}
+
+// Service provides registration and login.
+type Service struct {
+	repo Repository
+	cost int
+}
+
+// NewService creates a new user service.
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo, cost: bcrypt.DefaultCost}
+}
+
+// dummyHash is compared against on logins for unknown emails so that they
+// take as long as logins with a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// Register creates a user with a bcrypt-hashed password.
+func (s *Service) Register(ctx context.Context, email, password string) (*User, error) {
+	email = normalizeEmail(email)
+	if !validEmail(email) {
+		return nil, ErrInvalidEmail
+	}
+	if len(password) < MinPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordLength {
+		return nil, ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Email:        email,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Login returns the user with the given email and password, or
+// ErrInvalidCredentials.
+func (s *Service) Login(ctx context.Context, email, password string) (*User, error) {
+	user, err := s.repo.FindByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// GetUser gets a single user by ID.
+func (s *Service) GetUser(ctx context.Context, id int64) (*User, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,76 @@
+package user_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/user"
+)
+
+func TestService_Register(t *testing.T) {
+	service := user.NewService(memory.NewRepo().Users())
+	ctx := context.Background()
+
+	t.Run("registers a user", func(t *testing.T) {
+		u, err := service.Register(ctx, " Alice@Example.com ", "correct horse")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if u.ID == 0 {
+			t.Errorf("expected ID to be set")
+		}
+		if u.Email != "alice@example.com" {
+			t.Errorf("expected normalized email, got %q", u.Email)
+		}
+		if u.PasswordHash == "" || u.PasswordHash == "correct horse" {
+			t.Errorf("expected password to be hashed")
+		}
+	})
+
+	t.Run("rejects a duplicate email", func(t *testing.T) {
+		_, err := service.Register(ctx, "ALICE@example.com", "another password")
+		if err != user.ErrEmailTaken {
+			t.Errorf("expected error %v, got %v", user.ErrEmailTaken, err)
+		}
+	})
+
+	t.Run("validates input", func(t *testing.T) {
+		if _, err := service.Register(ctx, "not an email", "long enough"); err != user.ErrInvalidEmail {
+			t.Errorf("expected error %v, got %v", user.ErrInvalidEmail, err)
+		}
+		if _, err := service.Register(ctx, "bob@example.com", "short"); err != user.ErrPasswordTooShort {
+			t.Errorf("expected error %v, got %v", user.ErrPasswordTooShort, err)
+		}
+		if _, err := service.Register(ctx, "bob@example.com", strings.Repeat("x", user.MaxPasswordLength+1)); err != user.ErrPasswordTooLong {
+			t.Errorf("expected error %v, got %v", user.ErrPasswordTooLong, err)
+		}
+	})
+}
+
+func TestService_Login(t *testing.T) {
+	service := user.NewService(memory.NewRepo().Users())
+	ctx := context.Background()
+
+	registered, _ := service.Register(ctx, "alice@example.com", "correct horse")
+
+	t.Run("logs in with the right password", func(t *testing.T) {
+		u, err := service.Login(ctx, "Alice@example.com", "correct horse")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if u.ID != registered.ID {
+			t.Errorf("expected user %d, got %d", registered.ID, u.ID)
+		}
+	})
+
+	t.Run("rejects a wrong password or unknown email", func(t *testing.T) {
+		if _, err := service.Login(ctx, "alice@example.com", "battery staple"); err != user.ErrInvalidCredentials {
+			t.Errorf("expected error %v, got %v", user.ErrInvalidCredentials, err)
+		}
+		if _, err := service.Login(ctx, "bob@example.com", "correct horse"); err != user.ErrInvalidCredentials {
+			t.Errorf("expected error %v, got %v", user.ErrInvalidCredentials, err)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package webhook_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gemini/go-todo/internal/webhook"
+)
+
+func TestClient(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	t.Run("refuses internal addresses", func(t *testing.T) {
+		for _, url := range []string{
+			srv.URL,
+			"http://169.254.169.254/latest/meta-data",
+			"http://10.0.0.1/hook",
+			"http://[::1]:1/hook",
+			"http://localhost" + strings.TrimPrefix(srv.URL, "http://127.0.0.1"),
+		} {
+			_, err := webhook.NewClient(false).Post(url, "application/json", nil)
+			if !errors.Is(err, webhook.ErrForbiddenAddress) {
+				t.Errorf("%s: expected ErrForbiddenAddress, got %v", url, err)
+			}
+		}
+		if n := len(rc.received()); n != 0 {
+			t.Errorf("expected no requests, got %d", n)
+		}
+	})
+
+	t.Run("allows internal addresses when asked to", func(t *testing.T) {
+		resp, err := webhook.NewClient(true).Post(srv.URL, "application/json", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("does not follow redirects", func(t *testing.T) {
+		redirect := httptest.NewServer(http.RedirectHandler(srv.URL, http.StatusTemporaryRedirect))
+		defer redirect.Close()
+
+		before := len(rc.received())
+		resp, err := webhook.NewClient(true).Post(redirect.URL, "application/json", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTemporaryRedirect {
+			t.Errorf("expected status %d, got %d", http.StatusTemporaryRedirect, resp.StatusCode)
+		}
+		if n := len(rc.received()); n != before {
+			t.Errorf("expected the redirect not to be followed")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Subscription asks for the todo events of its owner to be POSTed to a URL.
+type Subscription struct {
+	ID      int64  `json:"id"`
+	OwnerID int64  `json:"-"`
+	URL     string `json:"url"`
+	// Events lists the event types delivered, such as todo.ActionCreated,
+	// or is empty to deliver all of them.
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+	// Secret signs the payloads. It is only shown when the subscription is
+	// created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Wants reports whether events of the given type are delivered to s.
+func (s *Subscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Patch describes a partial update of a subscription. Nil fields are left
+// unchanged.
+type Patch struct {
+	URL    *string
+	Events *[]string
+	Active *bool
+}
+
+// Event is a todo event taken from the outbox.
+type Event struct {
+	ID      int64
+	OwnerID int64
+	Type    string
+	// Todo is the JSON encoded todo the event reports.
+	Todo      json.RawMessage
+	CreatedAt time.Time
+}
+
+// Delivery is the delivery of an event to a subscription, which may take
+// several attempts.
+type Delivery struct {
+	ID           int64
+	Subscription *Subscription
+	Event        Event
+	Status       string
+	// Attempts counts the attempts made so far.
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Attempt is an entry in a subscription's delivery log, recording one
+// attempt to deliver an event.
+type Attempt struct {
+	ID             int64  `json:"id"`
+	DeliveryID     int64  `json:"delivery_id"`
+	SubscriptionID int64  `json:"-"`
+	EventID        int64  `json:"event_id"`
+	EventType      string `json:"event_type"`
+	// Attempt numbers the attempts of a delivery from 1.
+	Attempt int `json:"attempt"`
+	// StatusCode is the receiver's response status, or 0 if no response was
+	// received, in which case Error says why.
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	At         time.Time `json:"at"`
+	// Status is the delivery's status after the attempt.
+	Status string `json:"status"`
+}
+
+// payload is the body POSTed for an event.
+type payload struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Todo      json.RawMessage `json:"todo"`
+}
@@ -0,0 +1,232 @@
+// Package webhook delivers todo events to the URLs users subscribe to.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/todo"
+)
+
+// MaxLogEntries is the largest number of delivery log entries returned at
+// once.
+const MaxLogEntries = 100
+
+var (
+	// ErrNotFound is returned when a subscription is not found.
+	ErrNotFound = errors.New("webhook subscription not found")
+	// ErrInvalid is returned when a subscription is invalid.
+	ErrInvalid = errors.New("webhook subscription invalid")
+	// ErrInvalidURL is returned for URLs that are not absolute http or
+	// https URLs.
+	ErrInvalidURL = fmt.Errorf("%w: invalid url", ErrInvalid)
+	// ErrUnknownEvent is returned when subscribing to an unknown event
+	// type.
+	ErrUnknownEvent = fmt.Errorf("%w: unknown event type", ErrInvalid)
+)
+
+// eventTypes are the event types that can be subscribed to.
+var eventTypes = map[string]bool{
+	todo.ActionCreated:  true,
+	todo.ActionUpdated:  true,
+	todo.ActionDeleted:  true,
+	todo.ActionRestored: true,
+}
+
+// EventTypes returns the event types that can be subscribed to, sorted.
+func EventTypes() []string {
+	types := make([]string, 0, len(eventTypes))
+	for t := range eventTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Repository defines the interface for webhook storage. The subscription
+// methods are scoped to a single owner.
+type Repository interface {
+	// ListSubscriptions returns the owner's subscriptions by ID.
+	ListSubscriptions(ctx context.Context, ownerID int64) ([]*Subscription, error)
+	CreateSubscription(ctx context.Context, s *Subscription) error
+	FindSubscription(ctx context.Context, ownerID, id int64) (*Subscription, error)
+	// UpdateSubscription stores the URL, events and active state of a
+	// subscription.
+	UpdateSubscription(ctx context.Context, s *Subscription) error
+	// DeleteSubscription removes a subscription with its deliveries.
+	DeleteSubscription(ctx context.Context, ownerID, id int64) error
+	// ListAttempts returns up to limit of the latest delivery attempts to a
+	// subscription, newest first.
+	ListAttempts(ctx context.Context, subscriptionID int64, limit int) ([]Attempt, error)
+
+	// Dispatch takes the events out of the outbox, creating a pending
+	// delivery, due at the given time, to each active subscription of the
+	// event's owner that wants it.
+	Dispatch(ctx context.Context, at time.Time) error
+	// DueDeliveries returns up to limit pending deliveries to active
+	// subscriptions that are due at the given time, oldest first.
+	DueDeliveries(ctx context.Context, at time.Time, limit int) ([]*Delivery, error)
+	// RecordAttempt appends an attempt to the delivery log and stores the
+	// status, attempt count and next attempt time of its delivery.
+	RecordAttempt(ctx context.Context, d *Delivery, a *Attempt) error
+	// Prune removes the deliveries that succeeded or failed before the
+	// given time, with their attempts, and the events no longer needed.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Service manages the webhook subscriptions of the user authenticated in
+// the request context.
+type Service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+// NewService creates a new webhook service.
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo, now: time.Now}
+}
+
+// ListSubscriptions lists the subscriptions.
+func (s *Service) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	subs, err := s.repo.ListSubscriptions(ctx, auth.UserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if subs == nil {
+		subs = []*Subscription{}
+	}
+	for _, sub := range subs {
+		sub.Secret = ""
+	}
+	return subs, nil
+}
+
+// CreateSubscription subscribes a URL to the given event types, or to all
+// of them if there are none. The subscription is returned with the secret
+// its payloads are signed with.
+func (s *Service) CreateSubscription(ctx context.Context, rawURL string, events []string) (*Subscription, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	sub := &Subscription{
+		OwnerID:   auth.UserID(ctx),
+		URL:       rawURL,
+		Events:    events,
+		Active:    true,
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := validate(sub); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// GetSubscription gets a single subscription by its ID.
+func (s *Service) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	sub, err := s.repo.FindSubscription(ctx, auth.UserID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+// UpdateSubscription changes the URL, event types or active state of a
+// subscription. Deliveries to inactive subscriptions are held back until
+// they are activated again.
+func (s *Service) UpdateSubscription(ctx context.Context, id int64, p Patch) (*Subscription, error) {
+	sub, err := s.repo.FindSubscription(ctx, auth.UserID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if p.URL != nil {
+		sub.URL = *p.URL
+	}
+	if p.Events != nil {
+		sub.Events = *p.Events
+	}
+	if p.Active != nil {
+		sub.Active = *p.Active
+	}
+	sub.UpdatedAt = s.now()
+
+	if err := validate(sub); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+// DeleteSubscription deletes a subscription and its pending deliveries.
+func (s *Service) DeleteSubscription(ctx context.Context, id int64) error {
+	return s.repo.DeleteSubscription(ctx, auth.UserID(ctx), id)
+}
+
+// ListAttempts returns up to limit of the latest entries of a
+// subscription's delivery log, newest first. The limit is capped at
+// MaxLogEntries.
+func (s *Service) ListAttempts(ctx context.Context, id int64, limit int) ([]Attempt, error) {
+	if _, err := s.repo.FindSubscription(ctx, auth.UserID(ctx), id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxLogEntries {
+		limit = MaxLogEntries
+	}
+	attempts, err := s.repo.ListAttempts(ctx, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	if attempts == nil {
+		attempts = []Attempt{}
+	}
+	return attempts, nil
+}
+
+// validate checks the URL and event types of a subscription, removing
+// duplicate event types.
+func validate(s *Subscription) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+
+	seen := make(map[string]bool)
+	events := []string{}
+	for _, e := range s.Events {
+		if !eventTypes[e] {
+			return ErrUnknownEvent
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	s.Events = events
+	return nil
+}
+
+// newSecret generates a random signing secret.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
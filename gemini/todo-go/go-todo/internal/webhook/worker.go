@@ -0,0 +1,263 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gemini/go-todo/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces every delivery attempt. The W3C traceparent header of the
+// request lets receivers continue the trace.
+var tracer = otel.Tracer("github.com/gemini/go-todo/internal/webhook")
+
+const (
+	// SignatureHeader carries the signature of a payload, in the form
+	// "t=<unix time>,v1=<hex HMAC-SHA256>". The HMAC is computed with the
+	// subscription's secret over the time, a dot, and the body.
+	SignatureHeader = "X-Webhook-Signature"
+	// EventIDHeader and EventTypeHeader carry the ID and type of the event
+	// delivered. Receivers should use the ID to ignore redeliveries.
+	EventIDHeader   = "X-Webhook-ID"
+	EventTypeHeader = "X-Webhook-Event"
+)
+
+// Worker delivers the events in the outbox to the subscriptions wanting
+// them, retrying failed deliveries with exponential backoff.
+type Worker struct {
+	repo   Repository
+	client *http.Client
+	logger *slog.Logger
+	now    func() time.Time
+
+	batchSize   int
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	retention   time.Duration
+}
+
+// WorkerOption configures a Worker.
+type WorkerOption func(*Worker)
+
+// WithClient makes the worker deliver through client instead of one made
+// by NewClient, which refuses to connect to internal addresses.
+func WithClient(client *http.Client) WorkerOption {
+	return func(w *Worker) {
+		w.client = client
+	}
+}
+
+// WithClock makes the worker read the current time from now, which is
+// useful in tests.
+func WithClock(now func() time.Time) WorkerOption {
+	return func(w *Worker) {
+		w.now = now
+	}
+}
+
+// WithBackoff sets the delay before the first retry of a failed delivery,
+// which doubles for every further retry up to max.
+func WithBackoff(min, max time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.minBackoff, w.maxBackoff = min, max
+	}
+}
+
+// WithMaxAttempts sets how often a delivery is attempted before it fails.
+func WithMaxAttempts(n int) WorkerOption {
+	return func(w *Worker) {
+		w.maxAttempts = n
+	}
+}
+
+// WithRetention sets how long finished deliveries stay in the delivery log.
+func WithRetention(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.retention = d
+	}
+}
+
+// NewWorker creates a new delivery worker.
+func NewWorker(repo Repository, logger *slog.Logger, opts ...WorkerOption) *Worker {
+	w := &Worker{
+		repo:        repo,
+		client:      NewClient(false),
+		logger:      logger,
+		now:         time.Now,
+		batchSize:   50,
+		maxAttempts: 8,
+		minBackoff:  30 * time.Second,
+		maxBackoff:  time.Hour,
+		retention:   7 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Run delivers events every interval until ctx is done.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Error("failed to deliver webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce dispatches the events in the outbox and attempts the deliveries
+// that are due.
+func (w *Worker) RunOnce(ctx context.Context) error {
+	now := w.now()
+	if err := w.repo.Dispatch(ctx, now); err != nil {
+		return err
+	}
+	if err := w.repo.Prune(ctx, now.Add(-w.retention)); err != nil {
+		return err
+	}
+
+	for {
+		deliveries, err := w.repo.DueDeliveries(ctx, now, w.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, d := range deliveries {
+			if err := w.deliver(ctx, d); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < w.batchSize {
+			return nil
+		}
+	}
+}
+
+// deliver attempts a delivery and records the outcome.
+func (w *Worker) deliver(ctx context.Context, d *Delivery) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook delivery",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int64("webhook.subscription_id", d.Subscription.ID),
+			attribute.Int64("webhook.event_id", d.Event.ID),
+			attribute.String("webhook.event_type", d.Event.Type),
+		),
+	)
+	defer tracing.End(span, &err)
+
+	start := w.now()
+	status, err := w.post(ctx, d)
+	if ctx.Err() != nil {
+		// Shutting down is no fault of the receiver.
+		return ctx.Err()
+	}
+	d.Attempts++
+	a := &Attempt{
+		DeliveryID:     d.ID,
+		SubscriptionID: d.Subscription.ID,
+		EventID:        d.Event.ID,
+		EventType:      d.Event.Type,
+		Attempt:        d.Attempts,
+		StatusCode:     status,
+		DurationMS:     w.now().Sub(start).Milliseconds(),
+		At:             start,
+	}
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		d.Status = StatusDelivered
+	case d.Attempts >= w.maxAttempts:
+		d.Status = StatusFailed
+	default:
+		d.NextAttemptAt = start.Add(w.backoff(d.Attempts))
+	}
+	if err != nil {
+		a.Error = err.Error()
+	} else if d.Status != StatusDelivered {
+		a.Error = fmt.Sprintf("unexpected status %d", status)
+	}
+	a.Status = d.Status
+	d.UpdatedAt = start
+	if a.Error != "" {
+		span.SetStatus(codes.Error, a.Error)
+	}
+	return w.repo.RecordAttempt(ctx, d, a)
+}
+
+// post sends an event to a subscription and returns the response status.
+func (w *Worker) post(ctx context.Context, d *Delivery) (int, error) {
+	body, err := json.Marshal(payload{
+		ID:        d.Event.ID,
+		Type:      d.Event.Type,
+		CreatedAt: d.Event.CreatedAt,
+		Todo:      d.Event.Todo,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-todo-webhooks")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(d.Event.ID, 10))
+	req.Header.Set(EventTypeHeader, d.Event.Type)
+	req.Header.Set(SignatureHeader, Sign(d.Subscription.Secret, w.now(), body))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.minBackoff
+	for i := 1; i < attempts && d < w.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.maxBackoff {
+		d = w.maxBackoff
+	}
+	return d
+}
+
+// Sign returns the signature header value of a payload sent at the given
+// time.
+func Sign(secret string, at time.Time, body []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
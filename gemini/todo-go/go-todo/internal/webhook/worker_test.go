@@ -0,0 +1,225 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gemini/go-todo/internal/auth"
+	"github.com/gemini/go-todo/internal/storage/memory"
+	"github.com/gemini/go-todo/internal/todo"
+	"github.com/gemini/go-todo/internal/webhook"
+)
+
+// receiver records the requests it receives and answers with the next of
+// its status codes, or 200 once they run out.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, received{header: r.Header, body: body})
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []received {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]received{}, rc.requests...)
+}
+
+func TestWorker(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	setup := func(t *testing.T, statuses ...int) (context.Context, *todo.Service, *webhook.Service, *webhook.Worker, *receiver, string) {
+		t.Helper()
+		rc := &receiver{statuses: statuses}
+		srv := httptest.NewServer(rc)
+		t.Cleanup(srv.Close)
+
+		repo := memory.NewRepo()
+		worker := webhook.NewWorker(repo.Webhooks(), logger,
+			webhook.WithClient(srv.Client()),
+			webhook.WithClock(clock),
+			webhook.WithBackoff(time.Minute, 4*time.Minute),
+			webhook.WithMaxAttempts(3),
+		)
+		return auth.WithUserID(context.Background(), 1), todo.NewService(repo), webhook.NewService(repo.Webhooks()), worker, rc, srv.URL
+	}
+
+	t.Run("delivers signed payloads of wanted events", func(t *testing.T) {
+		ctx, todos, webhooks, worker, rc, url := setup(t)
+		sub, err := webhooks.CreateSubscription(ctx, url, []string{todo.ActionCreated})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sub.Secret == "" {
+			t.Fatal("expected the new subscription to carry its secret")
+		}
+
+		created, err := todos.CreateTodo(ctx, "Ship it", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := todos.DeleteTodo(ctx, created.ID, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Events of other users are never delivered.
+		if _, err := todos.CreateTodo(auth.WithUserID(context.Background(), 2), "Other", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := worker.RunOnce(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		requests := rc.received()
+		if len(requests) != 1 {
+			t.Fatalf("expected 1 delivery, got %d", len(requests))
+		}
+		req := requests[0]
+		if got, want := req.header.Get(webhook.SignatureHeader), webhook.Sign(sub.Secret, now, req.body); got != want {
+			t.Errorf("expected signature %q, got %q", want, got)
+		}
+		if got := req.header.Get(webhook.EventTypeHeader); got != todo.ActionCreated {
+			t.Errorf("expected event type %q, got %q", todo.ActionCreated, got)
+		}
+
+		var payload struct {
+			ID   int64     `json:"id"`
+			Type string    `json:"type"`
+			Todo todo.Todo `json:"todo"`
+		}
+		if err := json.Unmarshal(req.body, &payload); err != nil {
+			t.Fatalf("could not decode payload: %v", err)
+		}
+		if payload.Type != todo.ActionCreated || payload.Todo.ID != created.ID || payload.Todo.Title != "Ship it" {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+		if got := req.header.Get(webhook.EventIDHeader); got != strconv.FormatInt(payload.ID, 10) {
+			t.Errorf("expected event ID %d, got %q", payload.ID, got)
+		}
+
+		// Delivered events are not delivered again.
+		if err := worker.RunOnce(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := len(rc.received()); n != 1 {
+			t.Errorf("expected 1 delivery, got %d", n)
+		}
+	})
+
+	t.Run("retries with backoff until it fails", func(t *testing.T) {
+		ctx, todos, webhooks, worker, rc, url := setup(t,
+			http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+		sub, err := webhooks.CreateSubscription(ctx, url, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := todos.CreateTodo(ctx, "Flaky", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		run := func(after time.Duration) int {
+			t.Helper()
+			now = now.Add(after)
+			if err := worker.RunOnce(ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return len(rc.received())
+		}
+		if n := run(0); n != 1 {
+			t.Fatalf("expected 1 attempt, got %d", n)
+		}
+		if n := run(59 * time.Second); n != 1 {
+			t.Errorf("expected no retry before the backoff, got %d attempts", n)
+		}
+		if n := run(time.Second); n != 2 {
+			t.Errorf("expected a retry after a minute, got %d attempts", n)
+		}
+		if n := run(time.Minute); n != 2 {
+			t.Errorf("expected the backoff to double, got %d attempts", n)
+		}
+		if n := run(time.Minute); n != 3 {
+			t.Errorf("expected a retry after two minutes, got %d attempts", n)
+		}
+		if n := run(time.Hour); n != 3 {
+			t.Errorf("expected no attempts after the last one, got %d", n)
+		}
+
+		log, err := webhooks.ListAttempts(ctx, sub.ID, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(log) != 3 {
+			t.Fatalf("expected 3 log entries, got %d", len(log))
+		}
+		if log[0].Attempt != 3 || log[0].StatusCode != http.StatusServiceUnavailable || log[0].Status != webhook.StatusFailed {
+			t.Errorf("unexpected latest entry %+v", log[0])
+		}
+		if log[2].Attempt != 1 || log[2].Error == "" || log[2].EventType != todo.ActionCreated {
+			t.Errorf("unexpected first entry %+v", log[2])
+		}
+	})
+
+	t.Run("holds deliveries to inactive subscriptions", func(t *testing.T) {
+		ctx, todos, webhooks, worker, rc, url := setup(t)
+		sub, err := webhooks.CreateSubscription(ctx, url, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		active := false
+		if _, err := webhooks.UpdateSubscription(ctx, sub.ID, webhook.Patch{Active: &active}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Inactive subscriptions get no deliveries for new events.
+		if _, err := todos.CreateTodo(ctx, "Skipped", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := worker.RunOnce(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := len(rc.received()); n != 0 {
+			t.Fatalf("expected no deliveries, got %d", n)
+		}
+
+		active = true
+		if _, err := webhooks.UpdateSubscription(ctx, sub.ID, webhook.Patch{Active: &active}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := todos.CreateTodo(ctx, "Delivered", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := worker.RunOnce(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := len(rc.received()); n != 1 {
+			t.Errorf("expected 1 delivery, got %d", n)
+		}
+	})
+}
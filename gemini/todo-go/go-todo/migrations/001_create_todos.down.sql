@@ -0,0 +1,3 @@
+-- 001_create_todos.down.sql
+DROP INDEX IF EXISTS idx_todos_completed;
+DROP TABLE IF EXISTS todos;
@@ -1,4 +1,4 @@
--- 001_create_todos.sql
+-- 001_create_todos.up.sql
 CREATE TABLE IF NOT EXISTS todos (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     title TEXT NOT NULL,
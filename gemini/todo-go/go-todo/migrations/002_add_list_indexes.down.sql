@@ -0,0 +1,4 @@
+-- 002_add_list_indexes.down.sql
+DROP INDEX IF EXISTS idx_todos_title;
+DROP INDEX IF EXISTS idx_todos_updated_at;
+DROP INDEX IF EXISTS idx_todos_created_at;
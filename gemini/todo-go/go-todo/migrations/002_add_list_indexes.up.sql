@@ -0,0 +1,4 @@
+-- 002_add_list_indexes.up.sql
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_todos_updated_at ON todos(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_todos_title ON todos(title, id);
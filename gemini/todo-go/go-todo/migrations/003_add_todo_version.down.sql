@@ -0,0 +1,2 @@
+-- 003_add_todo_version.down.sql
+ALTER TABLE todos DROP COLUMN version;
@@ -0,0 +1,2 @@
+-- 003_add_todo_version.up.sql
+ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,12 @@
+-- 004_add_users.down.sql
+DROP INDEX IF EXISTS idx_todos_owner_title;
+DROP INDEX IF EXISTS idx_todos_owner_updated_at;
+DROP INDEX IF EXISTS idx_todos_owner_created_at;
+DROP INDEX IF EXISTS idx_todos_owner_completed;
+CREATE INDEX IF NOT EXISTS idx_todos_completed ON todos(completed);
+CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_todos_updated_at ON todos(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_todos_title ON todos(title, id);
+
+ALTER TABLE todos DROP COLUMN owner_id;
+DROP TABLE IF EXISTS users;
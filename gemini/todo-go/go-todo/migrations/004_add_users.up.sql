@@ -0,0 +1,20 @@
+-- 004_add_users.up.sql
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Todos created before users existed belong to owner 0 and stay unreachable
+-- through the authenticated API.
+ALTER TABLE todos ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS idx_todos_completed;
+DROP INDEX IF EXISTS idx_todos_created_at;
+DROP INDEX IF EXISTS idx_todos_updated_at;
+DROP INDEX IF EXISTS idx_todos_title;
+CREATE INDEX idx_todos_owner_completed ON todos(owner_id, completed);
+CREATE INDEX idx_todos_owner_created_at ON todos(owner_id, created_at, id);
+CREATE INDEX idx_todos_owner_updated_at ON todos(owner_id, updated_at, id);
+CREATE INDEX idx_todos_owner_title ON todos(owner_id, title, id);
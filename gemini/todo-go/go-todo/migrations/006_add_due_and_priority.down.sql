@@ -0,0 +1,5 @@
+-- 006_add_due_and_priority.down.sql
+DROP INDEX IF EXISTS idx_todos_owner_priority;
+DROP INDEX IF EXISTS idx_todos_owner_due_at;
+ALTER TABLE todos DROP COLUMN priority;
+ALTER TABLE todos DROP COLUMN due_at;
@@ -0,0 +1,6 @@
+-- 006_add_due_and_priority.up.sql
+ALTER TABLE todos ADD COLUMN due_at TIMESTAMP;
+ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_todos_owner_due_at ON todos(owner_id, due_at, id);
+CREATE INDEX idx_todos_owner_priority ON todos(owner_id, priority, id);
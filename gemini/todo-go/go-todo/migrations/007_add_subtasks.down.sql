@@ -0,0 +1,5 @@
+-- 007_add_subtasks.down.sql
+DROP INDEX IF EXISTS idx_todos_parent_id;
+DELETE FROM todos WHERE parent_id IS NOT NULL;
+ALTER TABLE todos DROP COLUMN auto_complete;
+ALTER TABLE todos DROP COLUMN parent_id;
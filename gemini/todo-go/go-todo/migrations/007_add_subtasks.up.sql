@@ -0,0 +1,7 @@
+-- 007_add_subtasks.up.sql
+-- Subtasks are removed together with their parent by the repository rather
+-- than by a foreign key, which SQLite could not drop again on the way down.
+ALTER TABLE todos ADD COLUMN parent_id INTEGER;
+ALTER TABLE todos ADD COLUMN auto_complete BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_todos_parent_id ON todos(parent_id, completed);
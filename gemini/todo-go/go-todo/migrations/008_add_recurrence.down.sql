@@ -0,0 +1,2 @@
+-- 008_add_recurrence.down.sql
+ALTER TABLE todos DROP COLUMN recurrence;
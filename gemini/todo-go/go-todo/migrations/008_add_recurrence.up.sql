@@ -0,0 +1,4 @@
+-- 008_add_recurrence.up.sql
+-- The recurrence of a todo is stored as JSON; it is only ever read and
+-- written together with the todo.
+ALTER TABLE todos ADD COLUMN recurrence TEXT;
@@ -0,0 +1,16 @@
+-- 009_add_projects.up.sql
+CREATE TABLE IF NOT EXISTS projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    archived BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (owner_id, name)
+);
+
+-- As with parent_id, the repository moves todos out of a deleted project
+-- rather than a foreign key, so that the column can be dropped again.
+ALTER TABLE todos ADD COLUMN project_id INTEGER;
+
+CREATE INDEX idx_todos_project_id ON todos(project_id);
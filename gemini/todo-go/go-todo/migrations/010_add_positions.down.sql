@@ -0,0 +1,3 @@
+-- 010_add_positions.down.sql
+DROP INDEX IF EXISTS idx_todos_owner_position;
+ALTER TABLE todos DROP COLUMN position;
@@ -0,0 +1,8 @@
+-- 010_add_positions.up.sql
+-- Positions are lexicographic ranks (see internal/rank). Existing todos keep
+-- their creation order: zero-padded IDs followed by a non-zero digit are
+-- valid ranks that sort like the IDs.
+ALTER TABLE todos ADD COLUMN position TEXT NOT NULL DEFAULT '';
+UPDATE todos SET position = printf('%010dV', id);
+
+CREATE INDEX idx_todos_owner_position ON todos(owner_id, position, id);
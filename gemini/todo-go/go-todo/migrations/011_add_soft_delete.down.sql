@@ -0,0 +1,4 @@
+-- 011_add_soft_delete.down.sql
+DROP INDEX IF EXISTS idx_todos_deleted_at;
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+ALTER TABLE todos DROP COLUMN deleted_at;
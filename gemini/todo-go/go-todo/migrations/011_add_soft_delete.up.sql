@@ -0,0 +1,6 @@
+-- 011_add_soft_delete.up.sql
+-- Deleted todos stay in the trash until deleted_at is older than the
+-- configured retention.
+ALTER TABLE todos ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_todos_deleted_at ON todos(deleted_at);
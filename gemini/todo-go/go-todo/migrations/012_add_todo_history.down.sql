@@ -0,0 +1,3 @@
+-- 012_add_todo_history.down.sql
+DROP INDEX IF EXISTS idx_todo_history_todo_id;
+DROP TABLE IF EXISTS todo_history;
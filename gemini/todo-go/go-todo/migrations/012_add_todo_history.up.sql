@@ -0,0 +1,15 @@
+-- 012_add_todo_history.up.sql
+-- Append-only history of the changes made to each todo. changes holds a
+-- JSON object mapping field names to their old and new values.
+CREATE TABLE IF NOT EXISTS todo_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    owner_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    changes TEXT,
+    version INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_history_todo_id ON todo_history(todo_id, id);
@@ -0,0 +1,27 @@
+-- 013_add_search.up.sql
+-- requires: ENABLE_FTS5
+-- Full-text index over todo titles and descriptions, kept in sync with
+-- the todos table by triggers. The rowid of an entry is the todo's ID.
+-- Title matches weigh twice as much as description matches.
+--
+-- Binaries whose SQLite lacks FTS5 skip this migration, and undo it in
+-- databases they open by dropping the triggers, which they cannot run, and
+-- unrecording it. They cannot drop the table, so a stale one may be left
+-- behind to be replaced here.
+DROP TABLE IF EXISTS todos_fts;
+CREATE VIRTUAL TABLE todos_fts USING fts5(fts_title, fts_description, tokenize = 'unicode61 remove_diacritics 2');
+INSERT INTO todos_fts (todos_fts, rank) VALUES ('rank', 'bm25(2.0, 1.0)');
+
+INSERT INTO todos_fts (rowid, fts_title, fts_description) SELECT id, title, description FROM todos;
+
+CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+    INSERT INTO todos_fts (rowid, fts_title, fts_description) VALUES (new.id, new.title, new.description);
+END;
+
+CREATE TRIGGER todos_fts_update AFTER UPDATE OF title, description ON todos BEGIN
+    UPDATE todos_fts SET fts_title = new.title, fts_description = new.description WHERE rowid = new.id;
+END;
+
+CREATE TRIGGER todos_fts_delete AFTER DELETE ON todos BEGIN
+    DELETE FROM todos_fts WHERE rowid = old.id;
+END;
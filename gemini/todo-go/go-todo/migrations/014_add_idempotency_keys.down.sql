@@ -0,0 +1,3 @@
+-- 014_add_idempotency_keys.down.sql
+DROP INDEX IF EXISTS idx_idempotency_keys_expires_at;
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,17 @@
+-- 014_add_idempotency_keys.up.sql
+-- Responses to requests made with an Idempotency-Key, kept until expires_at
+-- to answer retries with. status is NULL while the first request is in
+-- progress, and header holds a JSON object of the response headers.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status INTEGER,
+    header TEXT,
+    body BLOB,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
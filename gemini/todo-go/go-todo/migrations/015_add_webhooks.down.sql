@@ -0,0 +1,10 @@
+-- 015_add_webhooks.down.sql
+DROP INDEX IF EXISTS idx_webhook_attempts_subscription_id;
+DROP TABLE IF EXISTS webhook_attempts;
+DROP INDEX IF EXISTS idx_webhook_deliveries_event_id;
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS idx_webhook_subscriptions_owner_id;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP INDEX IF EXISTS idx_outbox_undispatched;
+DROP TABLE IF EXISTS outbox;
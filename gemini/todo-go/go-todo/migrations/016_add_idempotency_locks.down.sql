@@ -0,0 +1,2 @@
+-- 016_add_idempotency_locks.down.sql
+ALTER TABLE idempotency_keys DROP COLUMN locked_until;
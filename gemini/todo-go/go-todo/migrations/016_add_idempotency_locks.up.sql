@@ -0,0 +1,5 @@
+-- 016_add_idempotency_locks.up.sql
+-- Requests in progress whose lock has expired are given up on, and their
+-- keys can be reserved again. Reservations made before this migration have
+-- no lock and are free at once.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMP;
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so they ship with the binary.
+package migrations
+
+import "embed"
+
+// FS holds the migration files. Each migration is a NNN_name.up.sql file with
+// an optional NNN_name.down.sql counterpart.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -5,24 +5,30 @@ import (
 	"os"
 )
 
-// New returns a new logger based on the provided log level.
-func New(level string) *slog.Logger {
-	var logLevel slog.Level
+// New returns a new logger that logs records at or above level. Passing a
+// *slog.LevelVar lets the level be changed while the logger is in use.
+// Records logged with a context carrying a span include its trace_id and
+// span_id.
+func New(level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, opts)
+	return slog.New(traceHandler{handler})
+}
+
+// ParseLevel returns the level named by level: "debug", "info", "warn" or
+// "error". Any other name is treated as "info".
+func ParseLevel(level string) slog.Level {
 	switch level {
 	case "debug":
-		logLevel = slog.LevelDebug
+		return slog.LevelDebug
 	case "warn":
-		logLevel = slog.LevelWarn
+		return slog.LevelWarn
 	case "error":
-		logLevel = slog.LevelError
+		return slog.LevelError
 	default:
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo
 	}
-
-	opts := &slog.HandlerOptions{
-		Level: logLevel,
-	}
-
-	handler := slog.NewJSONHandler(os.Stdout, opts)
-	return slog.New(handler)
 }